@@ -0,0 +1,185 @@
+package adcs
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Maximum number of CA certificates fetched for a chain.
+	maxAiaDepth = 5
+	// Maximum size of a fetched CA certificate.
+	maxAiaResponseSize = 1 << 20
+	aiaTimeout         = 10 * time.Second
+)
+
+// ChainCompleter completes CA chains by following the Authority Information Access
+// caIssuers URLs of the certificates until a self-signed root or a trust anchor is reached.
+type ChainCompleter struct {
+	httpClient *http.Client
+	// Hosts the CA certificates may be fetched from. Empty means any host.
+	allowedHosts []string
+	// The chain is complete once it reaches one of these certificates.
+	trustAnchors []*x509.Certificate
+}
+
+func NewChainCompleter(allowedHosts []string, trustAnchors []*x509.Certificate) *ChainCompleter {
+	c := &ChainCompleter{
+		allowedHosts: allowedHosts,
+		trustAnchors: trustAnchors,
+	}
+	c.httpClient = &http.Client{Timeout: aiaTimeout, CheckRedirect: c.checkRedirect}
+	return c
+}
+
+// Complete the CA chain of the leaf certificate.
+// Returns the chain ordered from the leaf's issuer up to the root (or trust anchor).
+// If the chain can't be completed the certificates found so far are returned with an error.
+func (c *ChainCompleter) Complete(ctx context.Context, leaf *x509.Certificate, chain []*x509.Certificate) ([]*x509.Certificate, error) {
+	chain = OrderCertificateChain(chain, leaf)
+	// Drop the certificates not in the leaf's chain.
+	last := leaf
+	for idx, cert := range chain {
+		if !IssuedBy(last, cert) {
+			chain = chain[:idx]
+			break
+		}
+		last = cert
+	}
+
+	for depth := 0; ; depth++ {
+		if IsSelfSigned(last) || c.isTrustAnchor(last) {
+			return chain, nil
+		}
+		if anchor := c.trustAnchorFor(last); anchor != nil {
+			return append(chain, anchor), nil
+		}
+		if depth >= maxAiaDepth {
+			return chain, fmt.Errorf("CA chain longer than %d certificates", maxAiaDepth)
+		}
+		issuer, err := c.fetchIssuer(ctx, last)
+		if err != nil {
+			return chain, err
+		}
+		chain = append(chain, issuer)
+		last = issuer
+	}
+}
+
+func (c *ChainCompleter) isTrustAnchor(cert *x509.Certificate) bool {
+	for _, anchor := range c.trustAnchors {
+		if bytes.Equal(anchor.Raw, cert.Raw) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ChainCompleter) trustAnchorFor(cert *x509.Certificate) *x509.Certificate {
+	for _, anchor := range c.trustAnchors {
+		if IssuedBy(cert, anchor) && cert.CheckSignatureFrom(anchor) == nil {
+			return anchor
+		}
+	}
+	return nil
+}
+
+// Fetch the certificate's issuer from its caIssuers URLs.
+func (c *ChainCompleter) fetchIssuer(ctx context.Context, cert *x509.Certificate) (*x509.Certificate, error) {
+	if len(cert.IssuingCertificateURL) == 0 {
+		return nil, fmt.Errorf("no caIssuers URL in %q", cert.Subject)
+	}
+	var errs []string
+	for _, issuerURL := range cert.IssuingCertificateURL {
+		issuer, err := c.fetch(ctx, issuerURL, cert)
+		if err == nil {
+			return issuer, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return nil, fmt.Errorf("cannot get the issuer of %q: %s", cert.Subject, strings.Join(errs, "; "))
+}
+
+func (c *ChainCompleter) fetch(ctx context.Context, issuerURL string, cert *x509.Certificate) (*x509.Certificate, error) {
+	u, err := url.Parse(issuerURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	log := LoggerFrom(ctx).WithValues("operation", "FetchCaIssuer", "endpoint", issuerURL)
+	log.Info("Fetching CA certificate")
+	req, err := http.NewRequestWithContext(ctx, "GET", issuerURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	log.V(1).Info("CA certificate fetched", "status", res.Status, "duration", time.Since(start))
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s response status %s", issuerURL, res.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxAiaResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	// caIssuers is usually a DER certificate but may be PEM or PKCS#7 (.p7c).
+	var candidates []*x509.Certificate
+	if issuer, err := x509.ParseCertificate(body); err == nil {
+		candidates = []*x509.Certificate{issuer}
+	} else if candidates, err = ParsePkcs7Certificates(body); err != nil {
+		return nil, fmt.Errorf("%s: %v", issuerURL, err)
+	}
+	for _, candidate := range candidates {
+		if IssuedBy(cert, candidate) && cert.CheckSignatureFrom(candidate) == nil {
+			return candidate, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not the issuer of %q", issuerURL, cert.Subject)
+}
+
+func (c *ChainCompleter) checkURL(u *url.URL) error {
+	// LDAP URLs are common in AD but not supported.
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported caIssuers URL %s", u)
+	}
+	if !c.hostAllowed(u.Hostname()) {
+		return fmt.Errorf("caIssuers host %s not allowed", u.Hostname())
+	}
+	return nil
+}
+
+// Redirects are followed only to the allowed hosts.
+func (c *ChainCompleter) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxAiaDepth {
+		return fmt.Errorf("stopped after %d redirects", len(via))
+	}
+	return c.checkURL(req.URL)
+}
+
+func (c *ChainCompleter) hostAllowed(host string) bool {
+	if len(c.allowedHosts) == 0 {
+		return true
+	}
+	for _, allowed := range c.allowedHosts {
+		if strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	return false
+}
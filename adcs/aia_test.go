@@ -0,0 +1,117 @@
+package adcs
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainCompleterFromSimulator(t *testing.T) {
+	sim, _, simURL, cleanup := newSimulator(t)
+	defer cleanup()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	csrDer, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "test.example.com"},
+		DNSNames: []string{"test.example.com"},
+	}, key)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(csrDer)
+	require.NoError(t, err)
+	certPem, err := sim.CreateCertificatePem(csr)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(mustDecodePem(t, certPem))
+	require.NoError(t, err)
+
+	// The simulator returns only the issuing CA.
+	cs, err := NewNtlmCertsrv(simURL, "", "", nil, false, nil, false)
+	require.NoError(t, err)
+	caPem, err := cs.GetCaCertificateChain(context.Background())
+	require.NoError(t, err)
+	issuing, err := ParsePkcs7Certificates([]byte(caPem))
+	require.NoError(t, err)
+	require.Len(t, issuing, 1)
+
+	u, err := url.Parse(simURL)
+	require.NoError(t, err)
+
+	chain, err := NewChainCompleter([]string{u.Hostname()}, nil).Complete(context.Background(), leaf, issuing)
+	require.NoError(t, err)
+	require.Len(t, chain, 2)
+	assert.Equal(t, issuing[0], chain[0])
+	assert.True(t, IsSelfSigned(chain[1]))
+	assert.NoError(t, chain[0].CheckSignatureFrom(chain[1]))
+
+	// Without the issuing CA both CA certificates are fetched.
+	fetched, err := NewChainCompleter(nil, nil).Complete(context.Background(), leaf, nil)
+	require.NoError(t, err)
+	assert.Equal(t, chain, fetched)
+
+	// The chain ends at the trust anchor.
+	anchored, err := NewChainCompleter(nil, issuing).Complete(context.Background(), leaf, nil)
+	require.NoError(t, err)
+	assert.Equal(t, issuing, anchored)
+
+	// Hosts not allowed aren't contacted.
+	partial, err := NewChainCompleter([]string{"pki.example.com"}, nil).Complete(context.Background(), leaf, issuing)
+	assert.Error(t, err)
+	assert.Equal(t, issuing, partial)
+}
+
+func TestChainCompleterWithoutAia(t *testing.T) {
+	root, rootKey := newTestCA(t, "Test Root", nil, nil)
+	intermediate, intermediateKey := newTestCA(t, "Test Intermediate", root, rootKey)
+	leaf, _ := newTestCA(t, "Test Leaf", intermediate, intermediateKey)
+	other, _ := newTestCA(t, "Other Root", nil, nil)
+
+	// Complete chains are kept, certificates not in the chain are dropped.
+	chain, err := NewChainCompleter(nil, nil).Complete(context.Background(), leaf, []*x509.Certificate{root, other, intermediate})
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{intermediate, root}, chain)
+
+	// The root is taken from the trust anchors.
+	chain, err = NewChainCompleter(nil, []*x509.Certificate{root}).Complete(context.Background(), leaf, []*x509.Certificate{intermediate})
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{intermediate, root}, chain)
+
+	_, err = NewChainCompleter(nil, nil).Complete(context.Background(), leaf, []*x509.Certificate{intermediate})
+	assert.Error(t, err)
+}
+
+func TestChainCompleterRedirects(t *testing.T) {
+	root, rootKey := newTestCA(t, "Test Root", nil, nil)
+	leaf, _ := newTestCA(t, "Test Leaf", root, rootKey)
+	var target string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+		w.Write(root.Raw)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	// The same server by another host name.
+	target = "http://localhost:" + u.Port() + "/root.crt"
+	leaf.IssuingCertificateURL = []string{server.URL + "/redirect"}
+
+	// The redirect target must be allowed too.
+	_, err = NewChainCompleter([]string{u.Hostname()}, nil).Complete(context.Background(), leaf, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "caIssuers host localhost not allowed")
+	}
+	chain, err := NewChainCompleter([]string{u.Hostname(), "localhost"}, nil).Complete(context.Background(), leaf, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{root}, chain)
+}
@@ -1,5 +1,9 @@
 package adcs
 
+import (
+	"context"
+)
+
 type AdcsResponseStatus int
 
 const (
@@ -10,6 +14,21 @@ const (
 	Rejected AdcsResponseStatus = 4
 )
 
+func (s AdcsResponseStatus) String() string {
+	switch s {
+	case Pending:
+		return "Pending"
+	case Ready:
+		return "Ready"
+	case Errored:
+		return "Errored"
+	case Rejected:
+		return "Rejected"
+	}
+	return "Unknown"
+}
+
+// The implementations log through the logger carried by the context (see NewContext).
 type AdcsCertsrv interface {
 	// Request new certificate.
 	// Returns (cert status, certificate or description, id, error)
@@ -17,7 +36,7 @@ type AdcsCertsrv interface {
 	// If cert status is 'Ready' the cert is returned immediately in 'certificate'.
 	// If cert status is 'Pending' the cert can be obtained later with getExistingCertificate using the 'id' (see 'description' for more details)
 	// If cert status is 'Error' see 'description' for details.
-	RequestCertificate(csr string, template string) (AdcsResponseStatus, string, string, error)
+	RequestCertificate(ctx context.Context, csr string, template string) (AdcsResponseStatus, string, string, error)
 
 	// Get previously requested certicate from Certserv
 	// Returns (cert status, certificate or description, id, error)
@@ -25,13 +44,22 @@ type AdcsCertsrv interface {
 	// If cert status is 'Ready' the cert is returned in 'certificate'.
 	// If cert status is 'Pending' the cert can be obtained later with getExistingCertificate using the 'id' (see 'description' for more details)
 	// If cert status is 'Error' see 'description' for details.
-	GetExistingCertificate(id string) (AdcsResponseStatus, string, string, error)
+	GetExistingCertificate(ctx context.Context, id string) (AdcsResponseStatus, string, string, error)
 
 	// Get the certsrv' CA cert
 	// Returns ( certificate, error)
-	GetCaCertificate() (string, error)
+	GetCaCertificate(ctx context.Context) (string, error)
+
+	// Get the certsrv' CA certs of all the CA renewals
+	// Returns (certificates indexed by the renewal number, error)
+	GetCaCertificates(ctx context.Context) ([]string, error)
 
 	// Get the certsrv' CA chain
-	// Returns (certificate, error)
-	GetCaCertificateChain() (string, error)
+	// Returns (PEM certificates ordered from the CA up to the root, error)
+	GetCaCertificateChain(ctx context.Context) (string, error)
+
+	// Get the issued certificate together with the chain of the CA that issued it
+	// (which may not be the CA's newest renewal).
+	// Returns (PEM certificate, PEM certificates ordered from the issuing CA up to the root, error)
+	GetCertificateChain(ctx context.Context, id string) (string, string, error)
 }
@@ -0,0 +1,400 @@
+package adcs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Result of the certnew.cer page of a request that isn't issued (pending, denied or failed).
+type DispositionPage struct {
+	// Pending, Rejected or Errored
+	Status             AdcsResponseStatus
+	DispositionMessage string
+	LastStatus         string
+}
+
+// Result of the certfnsh.asp page returned for a submitted request.
+type SubmissionPage struct {
+	// ADCS request ID. Empty if ADCS didn't accept the request.
+	RequestId string
+	// Why the request wasn't accepted.
+	DispositionMessage string
+}
+
+// Result of the certcarc.asp page.
+type CaPage struct {
+	// Number of the newest CA renewal.
+	Renewals int
+}
+
+// PageParser parses the certsrv pages with the page profiles of the supported Windows Server versions.
+// The pages are parsed with the given profile or, if not set, with each known profile until one succeeds.
+// The texts are matched with the built-in phrases of all languages and the custom phrases. Where possible
+// language independent markers (element IDs, ReqID links, HRESULT and disposition codes) are used instead.
+type PageParser struct {
+	profiles []*PageProfile
+	phrases  *phraseMatcher
+}
+
+// Create a parser for the profile name (one of the PageProfile* constants). Empty name means any profile.
+// The custom phrases (optional) are matched in addition to the built-in ones.
+func NewPageParser(profile string, custom *Phrases) (*PageParser, error) {
+	phrases := allBuiltinPhrases()
+	if custom != nil {
+		phrases = mergePhrases(*custom, phrases)
+	}
+	matcher, err := newPhraseMatcher(phrases)
+	if err != nil {
+		return nil, err
+	}
+	if profile == "" {
+		return &PageParser{profiles: pageProfiles, phrases: matcher}, nil
+	}
+	for _, p := range pageProfiles {
+		if strings.EqualFold(p.Name, profile) {
+			return &PageParser{profiles: []*PageProfile{p}, phrases: matcher}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown certsrv page profile %q", profile)
+}
+
+// Parse the certnew.cer page returned instead of a certificate.
+func (p *PageParser) ParseCertnewPage(body []byte) (*DispositionPage, error) {
+	doc, err := tokenizePage(body)
+	if err != nil {
+		return nil, err
+	}
+	var errs []string
+	for _, profile := range p.profiles {
+		page, err := profile.parseCertnew(doc, p.phrases)
+		if err == nil {
+			return page, nil
+		}
+		errs = append(errs, fmt.Sprintf("profile %s: %v", profile.Name, err))
+	}
+	return nil, &PageParseError{Page: certnew_cer, Errors: errs}
+}
+
+// Parse the certfnsh.asp page returned for a submitted request.
+func (p *PageParser) ParseCertfnshPage(body []byte) (*SubmissionPage, error) {
+	doc, err := tokenizePage(body)
+	if err != nil {
+		return nil, err
+	}
+	var errs []string
+	for _, profile := range p.profiles {
+		page, err := profile.parseCertfnsh(doc, p.phrases)
+		if err == nil {
+			return page, nil
+		}
+		errs = append(errs, fmt.Sprintf("profile %s: %v", profile.Name, err))
+	}
+	return nil, &PageParseError{Page: certfnsh, Errors: errs}
+}
+
+// Parse the certcarc.asp page.
+func (p *PageParser) ParseCertcarcPage(body []byte) (*CaPage, error) {
+	doc, err := tokenizePage(body)
+	if err != nil {
+		return nil, err
+	}
+	var errs []string
+	for _, profile := range p.profiles {
+		page, err := profile.parseCertcarc(doc, p.phrases)
+		if err == nil {
+			return page, nil
+		}
+		errs = append(errs, fmt.Sprintf("profile %s: %v", profile.Name, err))
+	}
+	return nil, &PageParseError{Page: certcarc, Errors: errs}
+}
+
+// PageParseError is returned when none of the profiles can parse a page.
+type PageParseError struct {
+	Page string
+	// Why each of the attempted profiles failed.
+	Errors []string
+}
+
+func (e *PageParseError) Error() string {
+	return fmt.Sprintf("cannot parse %s page: %s", e.Page, strings.Join(e.Errors, "; "))
+}
+
+// The parts of a certsrv page used by the profiles.
+type htmlPage struct {
+	// Visible text with collapsed white space.
+	text string
+	// Text of the <DD> element following a <DT>, by the ID and by the normalized text of the <DT>.
+	fields map[string]string
+	// Text of the elements with an ID, by the ID.
+	ids map[string]string
+	// Link targets.
+	links []string
+	// Contents of the <script> elements.
+	scripts []string
+}
+
+// States of collecting the <DT> label and <DD> value of a field.
+const (
+	outsideField = iota
+	inLabel
+	afterLabel
+	inValue
+)
+
+// Tokenize the HTML page.
+func tokenizePage(body []byte) (*htmlPage, error) {
+	doc := &htmlPage{fields: map[string]string{}, ids: map[string]string{}}
+	var text, label, value, script strings.Builder
+	var labelId string
+	state := outsideField
+	// Inside <script> or <style>
+	var raw string
+	// Open elements with an ID
+	type idElement struct {
+		tag, id string
+		start   int
+	}
+	var open []idElement
+	// Close the topmost open element with the tag and the elements opened after it.
+	closeElement := func(tag string) {
+		for i := len(open) - 1; i >= 0; i-- {
+			if tag == "" || open[i].tag == tag {
+				for _, e := range open[i:] {
+					doc.ids[e.id] = collapseSpace(text.String()[e.start:])
+				}
+				open = open[:i]
+				if tag != "" {
+					return
+				}
+			}
+		}
+	}
+	endField := func() {
+		if state == inValue {
+			v := collapseSpace(value.String())
+			if labelId != "" {
+				doc.fields[labelId] = v
+			}
+			if l := normalizeLabel(label.String()); l != "" {
+				doc.fields[l] = v
+			}
+		}
+		label.Reset()
+		value.Reset()
+		labelId = ""
+		state = outsideField
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() != io.EOF {
+				return nil, z.Err()
+			}
+			endField()
+			closeElement("")
+			doc.text = collapseSpace(text.String())
+			return doc, nil
+		case html.TextToken:
+			data := string(z.Text())
+			if raw == "script" {
+				script.WriteString(data)
+				continue
+			} else if raw != "" {
+				continue
+			}
+			text.WriteString(data)
+			text.WriteString(" ")
+			switch state {
+			case inLabel:
+				label.WriteString(data)
+			case inValue:
+				value.WriteString(data)
+				value.WriteString(" ")
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := map[string]string{}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				attrs[string(key)] = string(val)
+			}
+			if string(name) == "p" {
+				// Paragraphs are often not closed.
+				closeElement("p")
+			}
+			if id := attrs["id"]; id != "" && tt == html.StartTagToken {
+				open = append(open, idElement{tag: string(name), id: id, start: text.Len()})
+			}
+			switch string(name) {
+			case "script", "style":
+				if tt == html.StartTagToken {
+					raw = string(name)
+				}
+			case "a":
+				if href, ok := attrs["href"]; ok {
+					doc.links = append(doc.links, href)
+				}
+			case "dt":
+				endField()
+				state = inLabel
+				labelId = attrs["id"]
+			case "dd":
+				if state == inLabel || state == afterLabel {
+					state = inValue
+				}
+			case "br", "p", "td", "tr", "li", "div":
+				text.WriteString(" ")
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			closeElement(string(name))
+			switch string(name) {
+			case "script", "style":
+				if raw == "script" {
+					doc.scripts = append(doc.scripts, script.String())
+					script.Reset()
+				}
+				raw = ""
+			case "dt":
+				if state == inLabel {
+					state = afterLabel
+				}
+			case "dd", "dl":
+				endField()
+			}
+		}
+	}
+}
+
+var spaceExp = regexp.MustCompile(`\s+`)
+
+func collapseSpace(s string) string {
+	return strings.TrimSpace(spaceExp.ReplaceAllString(strings.Replace(s, "\u00a0", " ", -1), " "))
+}
+
+// HRESULT error codes in the page texts, e.g. 0x80094014
+var hresultExp = regexp.MustCompile(`0x8[0-9a-fA-F]{7}`)
+
+// HRESULTs of denied requests
+var deniedHresults = []string{
+	"0x80094014", // CERTSRV_E_ADMIN_DENIED_REQUEST
+	"0x80094012", // CERTSRV_E_TEMPLATE_DENIED
+}
+
+// Request disposition codes (CR_DISP_*) shown in the 'Disposition' field.
+var dispositionCodeExp = regexp.MustCompile(`^([0-9]+)\b`)
+
+const (
+	dispositionError           = "1"
+	dispositionDenied          = "2"
+	dispositionUnderSubmission = "5"
+)
+
+func (p *PageProfile) parseCertnew(doc *htmlPage, phrases *phraseMatcher) (*DispositionPage, error) {
+	disposition, ok := doc.field(p.dispositionMessageIds, phrases.DispositionMessageLabels)
+	if !ok {
+		return nil, fmt.Errorf("disposition message not found")
+	}
+	page := &DispositionPage{DispositionMessage: disposition, Status: Errored}
+	page.LastStatus, _ = doc.field(p.lastStatusIds, phrases.LastStatusLabels)
+	if containsAnyFold(disposition, phrases.Pending) {
+		page.Status = Pending
+		return page, nil
+	}
+	if containsAnyFold(disposition, phrases.Denied) {
+		page.Status = Rejected
+		return page, nil
+	}
+
+	// Language independent markers
+	if hresult := hresultExp.FindString(page.LastStatus + " " + disposition); hresult != "" {
+		if containsAnyFold(hresult, deniedHresults) {
+			page.Status = Rejected
+		}
+		return page, nil
+	}
+	code, _ := doc.field(p.dispositionIds, nil)
+	switch dispositionCodeExp.FindString(code) {
+	case dispositionUnderSubmission:
+		page.Status = Pending
+	case dispositionDenied:
+		page.Status = Rejected
+	}
+	return page, nil
+}
+
+func (p *PageProfile) parseCertfnsh(doc *htmlPage, phrases *phraseMatcher) (*SubmissionPage, error) {
+	for _, link := range doc.links {
+		if found := p.requestIdLink.FindStringSubmatch(link); found != nil {
+			return &SubmissionPage{RequestId: found[1]}, nil
+		}
+	}
+	if phrases.requestIdText != nil {
+		if found := phrases.requestIdText.FindStringSubmatch(doc.text); found != nil {
+			return &SubmissionPage{RequestId: found[1]}, nil
+		}
+	}
+	for _, id := range p.requestIdIds {
+		if found := requestIdExp.FindString(doc.ids[id]); found != "" {
+			return &SubmissionPage{RequestId: found}, nil
+		}
+	}
+	if phrases.dispositionText != nil {
+		if found := phrases.dispositionText.FindStringSubmatch(doc.text); found != nil {
+			return &SubmissionPage{DispositionMessage: found[1]}, nil
+		}
+	}
+	// The error is usually reported with its HRESULT.
+	if found := hresultQuotedExp.FindStringSubmatch(doc.text); found != nil {
+		return &SubmissionPage{DispositionMessage: found[1]}, nil
+	}
+	if found := hresultSentenceExp.FindString(doc.text); found != "" {
+		return &SubmissionPage{DispositionMessage: strings.TrimSpace(found)}, nil
+	}
+	return nil, fmt.Errorf("neither request ID nor disposition message found")
+}
+
+var (
+	requestIdExp       = regexp.MustCompile(`[0-9]+`)
+	hresultQuotedExp   = regexp.MustCompile(`["„“«]\s*([^"„“”«»]*0x8[0-9a-fA-F]{7}[^"„“”«»]*?)\s*["“”»]`)
+	hresultSentenceExp = regexp.MustCompile(`[^.!?]*0x8[0-9a-fA-F]{7}[^!?]*?(\.\s|$)`)
+)
+
+func (p *PageProfile) parseCertcarc(doc *htmlPage, phrases *phraseMatcher) (*CaPage, error) {
+	for _, script := range doc.scripts {
+		if found := p.renewals.FindStringSubmatch(script); found != nil {
+			renewals, err := strconv.Atoi(found[1])
+			if err != nil {
+				return nil, err
+			}
+			return &CaPage{Renewals: renewals}, nil
+		}
+	}
+	return nil, fmt.Errorf("number of CA renewals not found")
+}
+
+// Get the value of the first field found by the <DT> IDs or labels.
+func (doc *htmlPage) field(ids []string, labels []string) (string, bool) {
+	for _, id := range ids {
+		if value, ok := doc.fields[id]; ok {
+			return value, true
+		}
+	}
+	for _, label := range labels {
+		if value, ok := doc.fields[normalizeLabel(label)]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,162 @@
+package adcs
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of the certsrv page fixtures")
+
+// The certsrv pages in testdata/certsrv are parsed and compared with their .golden files.
+// Pages in the top directory must be parsed the same by every profile,
+// pages in a profile's subdirectory (e.g. testdata/certsrv/2019) only by that profile.
+// The pages there now are written after the certsrv pages, not captured from a server;
+// pages captured from a server go to the subdirectory of its Windows Server version.
+// Run 'go test ./adcs -run TestPageParserGolden -update' after adding pages.
+func TestPageParserGolden(t *testing.T) {
+	common, err := filepath.Glob("testdata/certsrv/*.html")
+	require.NoError(t, err)
+	specific, err := filepath.Glob("testdata/certsrv/*/*.html")
+	require.NoError(t, err)
+	require.NotEmpty(t, common)
+
+	for _, file := range append(common, specific...) {
+		body, err := ioutil.ReadFile(file)
+		require.NoError(t, err)
+
+		profiles := []string{PageProfile2012R2, PageProfile2016, PageProfile2019, PageProfile2022}
+		var auto string
+		if dir := filepath.Base(filepath.Dir(file)); dir != "certsrv" {
+			profiles = []string{dir}
+			auto = dir
+		}
+		parser, err := NewPageParser(auto, nil)
+		require.NoError(t, err, file)
+		actual := parseFixture(t, parser, file, body)
+
+		golden := strings.TrimSuffix(file, ".html") + ".golden"
+		if *updateGolden {
+			require.NoError(t, ioutil.WriteFile(golden, actual, 0644))
+		}
+		expected, err := ioutil.ReadFile(golden)
+		require.NoError(t, err, "missing golden file, run with -update")
+		assert.JSONEq(t, string(expected), string(actual), file)
+
+		// Each profile gets the same result, parse errors name the profile.
+		for _, profile := range profiles {
+			parser, err := NewPageParser(profile, nil)
+			require.NoError(t, err)
+			result := parseFixture(t, parser, file, body)
+			if strings.Contains(string(expected), `"error"`) {
+				assert.Contains(t, string(result), "profile "+profile, file)
+			} else {
+				assert.JSONEq(t, string(expected), string(result), "%s with profile %s", file, profile)
+			}
+		}
+	}
+}
+
+// Parse the fixture as the page its name starts with. Returns the result or the error as JSON.
+func parseFixture(t *testing.T, parser *PageParser, file string, body []byte) []byte {
+	var result interface{}
+	var err error
+	switch name := filepath.Base(file); {
+	case strings.HasPrefix(name, "certnew"):
+		result, err = parser.ParseCertnewPage(body)
+	case strings.HasPrefix(name, "certfnsh"):
+		result, err = parser.ParseCertfnshPage(body)
+	case strings.HasPrefix(name, "certcarc"):
+		result, err = parser.ParseCertcarcPage(body)
+	default:
+		t.Fatalf("unknown page %s", file)
+	}
+	if err != nil {
+		result = map[string]string{"error": err.Error()}
+	}
+	data, jerr := json.MarshalIndent(result, "", "  ")
+	require.NoError(t, jerr)
+	return append(data, '\n')
+}
+
+func TestNewPageParserUnknownProfile(t *testing.T) {
+	_, err := NewPageParser("2008", nil)
+	assert.Error(t, err)
+}
+
+func TestPageParserCustomPhrases(t *testing.T) {
+	certfnsh := []byte(`<html><body><p>Il tuo ID richiesta è 42.</p></body></html>`)
+	certnew := []byte(`<html><body><dl><dt>Messaggio di disposizione:</dt><dd>Negato dal modulo criteri</dd></dl></body></html>`)
+
+	parser, err := NewPageParser("", nil)
+	require.NoError(t, err)
+	_, err = parser.ParseCertfnshPage(certfnsh)
+	assert.Error(t, err)
+	_, err = parser.ParseCertnewPage(certnew)
+	assert.Error(t, err)
+
+	parser, err = NewPageParser("", &Phrases{
+		Denied:                   []string{"Negato dal"},
+		DispositionMessageLabels: []string{"Messaggio di disposizione:"},
+		RequestId:                []string{"Il tuo ID richiesta è"},
+	})
+	require.NoError(t, err)
+	submission, err := parser.ParseCertfnshPage(certfnsh)
+	require.NoError(t, err)
+	assert.Equal(t, "42", submission.RequestId)
+	disposition, err := parser.ParseCertnewPage(certnew)
+	require.NoError(t, err)
+	assert.Equal(t, Rejected, disposition.Status)
+	assert.Equal(t, "Negato dal modulo criteri", disposition.DispositionMessage)
+}
+
+// Words like 'pending' in the message of a denied request don't make it pending.
+func TestPageParserPendingPhrases(t *testing.T) {
+	parser, err := NewPageParser("", nil)
+	require.NoError(t, err)
+	for label, message := range map[string]string{
+		"Dispositionsmeldung:":     "Verweigert von Richtlinienmodul: Ausstehende Genehmigung abgelehnt",
+		"Message de disposition :": "Refusé par le module de stratégie : approbation en attente rejetée",
+	} {
+		certnew := []byte(`<html><body><dl><dt>` + label + `</dt><dd>` + message + `</dd></dl></body></html>`)
+		disposition, err := parser.ParseCertnewPage(certnew)
+		require.NoError(t, err, message)
+		assert.Equal(t, Rejected, disposition.Status, message)
+	}
+}
+
+// The Polish pages have no built-in phrases, they must be parsed by the language independent markers.
+func TestPageParserLanguageIndependentFallback(t *testing.T) {
+	files, err := filepath.Glob("testdata/certsrv/*-pl.html")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	builtin := allBuiltinPhrases()
+	var phrases []string
+	for _, p := range [][]string{builtin.Pending, builtin.Denied, builtin.DispositionMessageLabels,
+		builtin.LastStatusLabels, builtin.RequestId, builtin.DispositionMessage} {
+		phrases = append(phrases, p...)
+	}
+	matcher, err := newPhraseMatcher(Phrases{})
+	require.NoError(t, err)
+	withoutPhrases := &PageParser{profiles: pageProfiles, phrases: matcher}
+
+	for _, file := range files {
+		body, err := ioutil.ReadFile(file)
+		require.NoError(t, err)
+		doc, err := tokenizePage(body)
+		require.NoError(t, err)
+		assert.False(t, containsAnyFold(doc.text, phrases), "%s contains a built-in phrase", file)
+
+		expected, err := ioutil.ReadFile(strings.TrimSuffix(file, ".html") + ".golden")
+		require.NoError(t, err)
+		assert.NotContains(t, string(expected), `"error"`, file)
+		assert.JSONEq(t, string(expected), string(parseFixture(t, withoutPhrases, file, body)), file)
+	}
+}
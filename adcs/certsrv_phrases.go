@@ -0,0 +1,140 @@
+package adcs
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Phrases of the certsrv pages in one language.
+type Phrases struct {
+	// Disposition messages of pending requests on the certnew.cer page e.g. 'Taken Under Submission'.
+	Pending []string
+	// Disposition messages of denied requests on the certnew.cer page e.g. 'Denied by'.
+	Denied []string
+	// Labels of the disposition message and last status fields on the certnew.cer page e.g. 'Disposition message:'.
+	DispositionMessageLabels []string
+	LastStatusLabels         []string
+	// Text before the request ID on the certfnsh.asp page of a pending request e.g. 'Your Request Id is'.
+	RequestId []string
+	// Text before the quoted disposition message on the certfnsh.asp page of a failed request
+	// e.g. 'The disposition message is'.
+	DispositionMessage []string
+}
+
+// Built-in phrases by language. Only English is taken from the pages of an English ADCS.
+// The German and French phrases are unverified translations, not taken from pages of a localized
+// ADCS (the de and fr pages in testdata/certsrv are translated English pages too). They may differ
+// from the real pages, which are then parsed by the language independent markers or custom phrases.
+// The phrases are whole disposition messages, single words like 'pending' also occur in the messages
+// of denied or failed requests.
+var BuiltinPhrases = map[string]Phrases{
+	"en": {
+		Pending:                  []string{"Taken Under Submission"},
+		Denied:                   []string{"Denied by"},
+		DispositionMessageLabels: []string{"Disposition message:"},
+		LastStatusLabels:         []string{"LastStatus:"},
+		RequestId:                []string{"Your Request Id is"},
+		DispositionMessage:       []string{"The disposition message is"},
+	},
+	"de": {
+		Pending:                  []string{"Zur Übermittlung angenommen", "Zur Übermittlung entgegengenommen"},
+		Denied:                   []string{"Verweigert von", "Abgelehnt von"},
+		DispositionMessageLabels: []string{"Dispositionsmeldung:", "Dispositionsnachricht:"},
+		LastStatusLabels:         []string{"Letzter Status:"},
+		RequestId:                []string{"Ihre Anforderungs-ID ist", "Ihre Anforderungs-ID lautet"},
+		DispositionMessage:       []string{"Die Dispositionsmeldung lautet", "Die Dispositionsnachricht lautet"},
+	},
+	"fr": {
+		Pending:                  []string{"Prise en compte pour soumission", "Pris en compte pour soumission"},
+		Denied:                   []string{"Refusé par", "Refusée par"},
+		DispositionMessageLabels: []string{"Message de disposition :", "Message de disposition:"},
+		LastStatusLabels:         []string{"Dernier état :", "Dernier statut :"},
+		RequestId:                []string{"Votre ID de demande est", "Votre numéro de demande est"},
+		DispositionMessage:       []string{"Le message de disposition est"},
+	},
+}
+
+// Merge the phrases.
+func mergePhrases(phrases ...Phrases) Phrases {
+	var merged Phrases
+	for _, p := range phrases {
+		merged.Pending = append(merged.Pending, p.Pending...)
+		merged.Denied = append(merged.Denied, p.Denied...)
+		merged.DispositionMessageLabels = append(merged.DispositionMessageLabels, p.DispositionMessageLabels...)
+		merged.LastStatusLabels = append(merged.LastStatusLabels, p.LastStatusLabels...)
+		merged.RequestId = append(merged.RequestId, p.RequestId...)
+		merged.DispositionMessage = append(merged.DispositionMessage, p.DispositionMessage...)
+	}
+	return merged
+}
+
+// The phrases of all the built-in languages, English first.
+func allBuiltinPhrases() Phrases {
+	var langs []string
+	for lang := range BuiltinPhrases {
+		if lang != "en" {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Strings(langs)
+	phrases := []Phrases{BuiltinPhrases["en"]}
+	for _, lang := range langs {
+		phrases = append(phrases, BuiltinPhrases[lang])
+	}
+	return mergePhrases(phrases...)
+}
+
+// Phrases compiled for matching.
+type phraseMatcher struct {
+	Phrases
+	requestIdText   *regexp.Regexp
+	dispositionText *regexp.Regexp
+}
+
+func newPhraseMatcher(phrases Phrases) (*phraseMatcher, error) {
+	m := &phraseMatcher{Phrases: phrases}
+	var err error
+	// The quotes differ between languages e.g. "...", „...“ or « ... ».
+	if m.requestIdText, err = phrasesRegexp(phrases.RequestId, `\s*:?\s*([0-9]+)`); err != nil {
+		return nil, err
+	}
+	if m.dispositionText, err = phrasesRegexp(phrases.DispositionMessage, `\s*:?\s*["„“«]\s*([^"„“”«»]+?)\s*["“”»]`); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Compile the regexp matching any of the phrases followed by suffix.
+func phrasesRegexp(phrases []string, suffix string) (*regexp.Regexp, error) {
+	var quoted []string
+	for _, phrase := range phrases {
+		if phrase = collapseSpace(phrase); phrase != "" {
+			quoted = append(quoted, strings.Replace(regexp.QuoteMeta(phrase), " ", `\s+`, -1))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil, nil
+	}
+	exp, err := regexp.Compile(`(?i)(?:` + strings.Join(quoted, "|") + `)` + suffix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid phrases %q: %v", phrases, err)
+	}
+	return exp, nil
+}
+
+// Normalize a field label for matching: lower case without the trailing colon.
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimRight(collapseSpace(label), ": ")))
+}
+
+func containsAnyFold(s string, phrases []string) bool {
+	s = strings.ToLower(s)
+	for _, phrase := range phrases {
+		if phrase != "" && strings.Contains(s, strings.ToLower(collapseSpace(phrase))) {
+			return true
+		}
+	}
+	return false
+}
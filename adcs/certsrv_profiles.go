@@ -0,0 +1,57 @@
+package adcs
+
+import (
+	"regexp"
+)
+
+// PageProfile describes the markup of the certsrv pages of a Windows Server version.
+// The language dependent texts are matched with the parser's phrases.
+type PageProfile struct {
+	Name string
+
+	// certnew.cer: IDs of the <DT> labels of the disposition message, the last status
+	// and the disposition (e.g. '5 - (unknown)') fields.
+	dispositionMessageIds []string
+	lastStatusIds         []string
+	dispositionIds        []string
+
+	// certfnsh.asp: the request ID in the link to the issued certificate
+	// and the ID of the element with the request ID on the page of a pending request.
+	requestIdLink *regexp.Regexp
+	requestIdIds  []string
+
+	// certcarc.asp: the number of the newest CA renewal in the page script.
+	renewals *regexp.Regexp
+}
+
+// Names of the supported page profiles.
+const (
+	PageProfile2012R2 = "2012R2"
+	PageProfile2016   = "2016"
+	PageProfile2019   = "2019"
+	PageProfile2022   = "2022"
+)
+
+// The certsrv pages of the supported versions share their markup, so the profiles start from the same settings.
+// Version specific differences found in the pages (see testdata/certsrv) go to the version's profile.
+func newPageProfile(name string) *PageProfile {
+	return &PageProfile{
+		Name:                  name,
+		dispositionMessageIds: []string{"locDispMsgLabel"},
+		lastStatusIds:         []string{"locLastStatLabel"},
+		dispositionIds:        []string{"locDispLabel"},
+		requestIdLink:         regexp.MustCompile(`(?i)certnew\.cer\?ReqID=([0-9]+)(&|$)`),
+		requestIdIds:          []string{"locReqIdMsg"},
+		renewals:              regexp.MustCompile(`var\s+nRenewals\s*=\s*([0-9]+)\s*;`),
+	}
+}
+
+var (
+	pageProfile2012R2 = newPageProfile(PageProfile2012R2)
+	pageProfile2016   = newPageProfile(PageProfile2016)
+	pageProfile2019   = newPageProfile(PageProfile2019)
+	pageProfile2022   = newPageProfile(PageProfile2022)
+)
+
+// The profiles tried when no profile is set, the newest first.
+var pageProfiles = []*PageProfile{pageProfile2022, pageProfile2019, pageProfile2016, pageProfile2012R2}
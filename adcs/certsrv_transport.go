@@ -0,0 +1,127 @@
+package adcs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/chojnack/adcs-issuer/tracing"
+)
+
+// certsrvTransport sends requests to the certsrv pages. It knows nothing about the page contents.
+type certsrvTransport struct {
+	url        string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// certsrvResponse is a fully read certsrv response.
+type certsrvResponse struct {
+	StatusCode int
+	Status     string
+	// Media type without parameters e.g. 'text/html'
+	ContentType string
+	Body        []byte
+}
+
+// GET the page with the query parameters.
+func (t *certsrvTransport) get(ctx context.Context, page string, query neturl.Values) (*certsrvResponse, error) {
+	url := fmt.Sprintf("%s/%s", t.url, page)
+	if len(query) > 0 {
+		url += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return t.do(req, page)
+}
+
+// POST the form to the page.
+func (t *certsrvTransport) post(ctx context.Context, page string, form neturl.Values) (*certsrvResponse, error) {
+	url := fmt.Sprintf("%s/%s", t.url, page)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-type", ct_urlenc)
+	return t.do(req, page)
+}
+
+// Send the request. It's logged with the fields of the logger in the request's context.
+func (t *certsrvTransport) do(req *http.Request, page string) (*certsrvResponse, error) {
+	log := LoggerFrom(req.Context()).WithValues("page", page, "method", req.Method)
+	// The span covers the whole exchange including the NTLM handshake.
+	ctx, span := tracing.Tracer().Start(req.Context(), "certsrv "+page, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(req.Method),
+			semconv.HTTPURLKey.String(redactURL(req.URL)),
+			attribute.String("adcs.page", page),
+		))
+	req = req.WithContext(ctx)
+	req.SetBasicAuth(t.username, t.password)
+	req.Header.Set("User-agent", "Mozilla")
+	start := time.Now()
+	res, err := t.httpClient.Do(req)
+	if err != nil {
+		log.V(1).Info("ADCS page request failed", "duration", time.Since(start), "error", err.Error())
+		tracing.End(span, err)
+		return nil, err
+	}
+	defer res.Body.Close()
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(res.StatusCode))
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		err = fmt.Errorf("cannot read ADCS Certsrv response: %v", err)
+		tracing.End(span, err)
+		return nil, err
+	}
+	log.V(1).Info("ADCS page requested", "status", res.Status, "duration", time.Since(start))
+	if res.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, res.Status)
+	}
+	span.End()
+	return &certsrvResponse{
+		StatusCode:  res.StatusCode,
+		Status:      res.Status,
+		ContentType: strings.TrimSpace(strings.Split(res.Header.Get("Content-Type"), ";")[0]),
+		Body:        body,
+	}, nil
+}
+
+// spanRoundTripper traces every HTTP round trip. Put below the NTLM negotiation it shows
+// the legs of the handshake under the span of the certsrv page.
+type spanRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (t spanRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	scheme := "none"
+	if auth := strings.Fields(req.Header.Get("Authorization")); len(auth) > 0 {
+		scheme = auth[0]
+	}
+	ctx, span := tracing.Tracer().Start(req.Context(), "HTTP "+req.Method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(req.Method),
+			attribute.String("adcs.auth_scheme", scheme),
+		))
+	res, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(res.StatusCode))
+	span.End()
+	return res, nil
+}
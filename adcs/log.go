@@ -0,0 +1,54 @@
+package adcs
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Log is used when the context passed to the package carries no logger.
+var Log = ctrllog.Log.WithName("adcs")
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx carrying the logger. The package logs through it
+// so its messages keep the fields of the caller (e.g. the issuer and the request name).
+func NewContext(ctx context.Context, log logr.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, log)
+}
+
+// LoggerFrom returns the logger carried by ctx or Log if there's none.
+func LoggerFrom(ctx context.Context) logr.Logger {
+	if ctx != nil {
+		if log, ok := ctx.Value(loggerKey{}).(logr.Logger); ok {
+			return log
+		}
+	}
+	return Log
+}
+
+// operation is a certsrv operation being logged.
+type operation struct {
+	log   logr.Logger
+	start time.Time
+}
+
+// Start logging the operation. Its logger carries the operation name, the ADCS endpoint
+// and the fields passed. It's put in the returned context so the page requests
+// of the operation are logged with the same fields.
+func startOperation(ctx context.Context, name string, endpoint string, keysAndValues ...interface{}) (context.Context, *operation) {
+	log := LoggerFrom(ctx).WithValues(append([]interface{}{"operation", name, "endpoint", endpoint}, keysAndValues...)...)
+	return NewContext(ctx, log), &operation{log: log, start: time.Now()}
+}
+
+// Log the outcome of the operation with its duration.
+func (o *operation) done(err error, keysAndValues ...interface{}) {
+	keysAndValues = append(keysAndValues, "duration", time.Since(o.start))
+	if err != nil {
+		o.log.Error(err, "ADCS operation failed", keysAndValues...)
+		return
+	}
+	o.log.V(1).Info("ADCS operation completed", keysAndValues...)
+}
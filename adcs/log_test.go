@@ -0,0 +1,107 @@
+package adcs
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A logged message with its fields.
+type logEntry struct {
+	msg    string
+	err    error
+	fields map[string]interface{}
+}
+
+// recordingLogger keeps the messages logged at any verbosity.
+type recordingLogger struct {
+	mu      *sync.Mutex
+	entries *[]logEntry
+	values  []interface{}
+}
+
+func newRecordingLogger() *recordingLogger {
+	return &recordingLogger{mu: &sync.Mutex{}, entries: &[]logEntry{}}
+}
+
+func (l *recordingLogger) record(msg string, err error, keysAndValues []interface{}) {
+	fields := map[string]interface{}{}
+	kv := append(append([]interface{}{}, l.values...), keysAndValues...)
+	for i := 0; i+1 < len(kv); i += 2 {
+		fields[kv[i].(string)] = kv[i+1]
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*l.entries = append(*l.entries, logEntry{msg: msg, err: err, fields: fields})
+}
+
+func (l *recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.record(msg, nil, keysAndValues)
+}
+func (l *recordingLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.record(msg, err, keysAndValues)
+}
+func (l *recordingLogger) Enabled() bool                    { return true }
+func (l *recordingLogger) V(level int) logr.InfoLogger      { return l }
+func (l *recordingLogger) WithName(name string) logr.Logger { return l }
+func (l *recordingLogger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	values := append(append([]interface{}{}, l.values...), keysAndValues...)
+	return &recordingLogger{mu: l.mu, entries: l.entries, values: values}
+}
+
+func (l *recordingLogger) find(msg string) []logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var found []logEntry
+	for _, entry := range *l.entries {
+		if entry.msg == msg {
+			found = append(found, entry)
+		}
+	}
+	return found
+}
+
+func TestLoggerFromContext(t *testing.T) {
+	assert.Equal(t, Log, LoggerFrom(context.Background()))
+	log := newRecordingLogger()
+	assert.Equal(t, log, LoggerFrom(NewContext(context.Background(), log)))
+}
+
+func TestOperationsLogWithContextFields(t *testing.T) {
+	_, _, url, cleanup := newSimulator(t)
+	defer cleanup()
+
+	cs, err := NewNtlmCertsrv(url, "", "", nil, false, nil, false)
+	require.NoError(t, err)
+	log := newRecordingLogger()
+	ctx := NewContext(context.Background(), log.WithValues("adcsrequest", "default/test"))
+	_, err = cs.GetCaCertificateChain(ctx)
+	require.NoError(t, err)
+
+	pages := log.find("ADCS page requested")
+	require.Len(t, pages, 2)
+	for _, page := range pages {
+		assert.Equal(t, "default/test", page.fields["adcsrequest"])
+		assert.Equal(t, "GetCaCertificateChain", page.fields["operation"])
+		assert.Equal(t, url, page.fields["endpoint"])
+		assert.Contains(t, page.fields, "duration")
+	}
+	assert.Equal(t, certcarc, pages[0].fields["page"])
+	assert.Equal(t, certnew_p7b, pages[1].fields["page"])
+
+	completed := log.find("ADCS operation completed")
+	require.Len(t, completed, 1)
+	assert.Equal(t, "GetCaCertificateChain", completed[0].fields["operation"])
+	assert.Contains(t, completed[0].fields, "duration")
+
+	_, _, err = cs.GetCertificateChain(ctx, "404")
+	require.Error(t, err)
+	failed := log.find("ADCS operation failed")
+	require.Len(t, failed, 1)
+	assert.Equal(t, "404", failed[0].fields["adcsRequestId"])
+	assert.Equal(t, err, failed[0].err)
+}
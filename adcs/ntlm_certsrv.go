@@ -1,25 +1,28 @@
 package adcs
 
 import (
-	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"github.com/Azure/go-ntlmssp"
-	"io/ioutil"
-	"k8s.io/klog"
+	"github.com/go-logr/logr"
 	"net/http"
 	neturl "net/url"
-	"regexp"
-	"strings"
+	"strconv"
+	"time"
 )
 
 type NtlmCertsrv struct {
-	url        string
-	username   string
-	password   string
-	ca         string
-	httpClient *http.Client
+	url       string
+	username  string
+	password  string
+	ca        string
+	transport *http.Transport
+	// Sends the requests to the certsrv pages
+	certsrv *certsrvTransport
+	// Parses the certsrv pages
+	parser *PageParser
 }
 
 const (
@@ -32,37 +35,65 @@ const (
 	ct_pkcs7  = "application/x-pkcs7-certificates"
 	ct_html   = "text/html"
 	ct_urlenc = "application/x-www-form-urlencoded"
+
+	// NTLM authenticates a connection, not a request, so keeping connections
+	// alive saves a full handshake on every call.
+	maxIdleConnsPerHost = 8
+	idleConnTimeout     = 5 * time.Minute
 )
 
-func NewNtlmCertsrv(url string, username string, password string, caCertPool *x509.CertPool, verify bool) (AdcsCertsrv, error) {
+// Create the certsrv client. The pages are parsed with the parser or, if nil,
+// with all the page profiles and built-in phrases.
+// With trace set the HTTP traffic is logged with the credentials redacted.
+func NewNtlmCertsrv(url string, username string, password string, caCertPool *x509.CertPool, verify bool, parser *PageParser, trace bool) (AdcsCertsrv, error) {
+	if parser == nil {
+		var err error
+		if parser, err = NewPageParser("", nil); err != nil {
+			return nil, err
+		}
+	}
 	var client *http.Client
 	transport := &http.Transport{
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: true, //TODO make false,
 			RootCAs:            caCertPool,
 		},
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		IdleConnTimeout:     idleConnTimeout,
+	}
+	var roundTripper http.RoundTripper = transport
+	if trace {
+		roundTripper = newTracingRoundTripper(transport)
 	}
+	roundTripper = spanRoundTripper{next: roundTripper}
 
 	if username != "" && password != "" {
 		// Set up NTLM authentication
 		client = &http.Client{
 			Transport: ntlmssp.Negotiator{
-				RoundTripper: transport,
+				RoundTripper: roundTripper,
 			},
 		}
 	} else {
 		// Plain client with no NTLM
 		client = &http.Client{
-			Transport: transport,
+			Transport: roundTripper,
 		}
-		klog.Warningf("Not using NTLM")
+		Log.Info("Not using NTLM", "endpoint", url)
 	}
 
 	c := &NtlmCertsrv{
-		url:        url,
-		username:   username,
-		password:   password,
-		httpClient: client,
+		url:       url,
+		username:  username,
+		password:  password,
+		transport: transport,
+		certsrv: &certsrvTransport{
+			url:        url,
+			username:   username,
+			password:   password,
+			httpClient: client,
+		},
+		parser: parser,
 	}
 	if verify {
 		success, err := c.verifyNtlm()
@@ -75,18 +106,32 @@ func NewNtlmCertsrv(url string, username string, password string, caCertPool *x5
 
 // Check if NTLM authentication is working for current credentials and URL
 func (s *NtlmCertsrv) verifyNtlm() (bool, error) {
-	klog.Infof("NTLM verification for user %s in URL %s", s.username, s.url)
+	log := Log.WithValues("operation", "VerifyNtlm", "endpoint", s.url, "username", s.username)
+	log.Info("NTLM verification")
 	req, _ := http.NewRequest("GET", s.url, nil)
 	req.SetBasicAuth(s.username, s.password)
-	res, err := s.httpClient.Do(req)
+	res, err := s.certsrv.httpClient.Do(req)
 	if err != nil {
-		klog.Errorf("ADCS server error: %s", err.Error())
+		log.Error(err, "ADCS server error")
 		return false, err
 	}
-	klog.Infof("NTLM verification successful (res = %s)", res.Status)
+	defer res.Body.Close()
+	log.Info("NTLM verification successful", "status", res.Status)
 	return true, nil
 }
 
+// Close connections kept alive by the client's transport.
+func (s *NtlmCertsrv) CloseIdleConnections() {
+	s.transport.CloseIdleConnections()
+}
+
+// The page body may hold the requester's data, it's logged only at V(1).
+// With tracing enabled it's logged with the response anyway.
+func logUnparsedPage(log logr.Logger, page string, body []byte) {
+	log.Info("Cannot parse certsrv page", "page", page)
+	log.V(1).Info("Unparsed certsrv page", "page", page, "body", traceBody(body))
+}
+
 /*
  * Returns:
  * - Certificate response status
@@ -94,84 +139,44 @@ func (s *NtlmCertsrv) verifyNtlm() (bool, error) {
  * - ADCS Request ID
  * - Error
  */
-func (s *NtlmCertsrv) GetExistingCertificate(id string) (AdcsResponseStatus, string, string, error) {
-	var certStatus AdcsResponseStatus = Unknown
+func (s *NtlmCertsrv) GetExistingCertificate(ctx context.Context, id string) (AdcsResponseStatus, string, string, error) {
+	ctx, op := startOperation(ctx, "GetExistingCertificate", s.url, "adcsRequestId", id)
+	status, desc, id, err := s.getExistingCertificate(ctx, id)
+	op.done(err, "status", status)
+	return status, desc, id, err
+}
 
-	url := fmt.Sprintf("%s/%s?ReqID=%s&ENC=b64", s.url, certnew_cer, id)
-	req, _ := http.NewRequest("GET", url, nil)
-	req.SetBasicAuth(s.username, s.password)
-	req.Header.Set("User-agent", "Mozilla")
-	res, err := s.httpClient.Do(req)
+func (s *NtlmCertsrv) getExistingCertificate(ctx context.Context, id string) (AdcsResponseStatus, string, string, error) {
+	log := LoggerFrom(ctx)
+	res, err := s.certsrv.get(ctx, certnew_cer, neturl.Values{"ReqID": {id}, "ENC": {"b64"}})
 	if err != nil {
-		klog.Errorf("ADCS Certserv error: %s", err.Error())
-		return certStatus, "", id, err
+		return Unknown, "", id, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return Unknown, "", id, fmt.Errorf("ADCS Certsrv response status %s", res.Status)
 	}
-	defer res.Body.Close()
-
-	if res.StatusCode == http.StatusOK {
-		switch ct := strings.Split(res.Header.Get(http.CanonicalHeaderKey("content-type")), ";"); ct[0] {
-		case ct_html:
-			// Denied or pending
-			body, err := ioutil.ReadAll(res.Body)
-			if err != nil {
-				klog.Errorf("Cannot read ADCS Certserv response: %s", err.Error())
-				return certStatus, "", id, err
-			}
-			bodyString := string(body)
-			dispositionMessage := "unknown"
-			exp := regexp.MustCompile(`Disposition message:[^\t]+\t\t([^\r\n]+)`)
-			found := exp.FindStringSubmatch(bodyString)
-			if len(found) > 1 {
-				dispositionMessage = found[1]
-				expPending := regexp.MustCompile(`.*Taken Under Submission*.`)
-				expRejected := regexp.MustCompile(`.*Denied by*.`)
-				switch true {
-				case expPending.MatchString(bodyString):
-					certStatus = Pending
-				case expRejected.MatchString(bodyString):
-					certStatus = Rejected
-				default:
-					certStatus = Errored
-				}
-
-			} else {
-				// If the response page is not formatted as we expect it
-				// we just log the entire page
-				disp := bodyString
-				if len(found) == 1 {
-					// Or at least the 'Disposition message' section
-					disp = found[0]
-				}
-				err = fmt.Errorf("Disposition message unknown: %s", disp)
-				klog.Errorf(err.Error())
-			}
-
-			lastStatusMessage := ""
-			exp = regexp.MustCompile(`LastStatus:[^\t]+\t\t([^\r\n]+)`)
-			found = exp.FindStringSubmatch(bodyString)
-			if len(found) > 1 {
-				lastStatusMessage = " " + found[1]
-			} else {
-				klog.Warningf("Last status unknown.")
-			}
-			return certStatus, dispositionMessage + lastStatusMessage, id, err
 
-		case ct_pkix:
-			// Certificate
-			cert, err := ioutil.ReadAll(res.Body)
-			if err != nil {
-				klog.Errorf("Cannot read ADCS Certserv response: %s", err.Error())
-				return certStatus, "", id, err
-			}
-			return Ready, string(cert), id, nil
-		default:
-			err = fmt.Errorf("Unexpected content type %s:", ct)
-			klog.Errorf(err.Error())
-			return certStatus, "", id, err
+	switch res.ContentType {
+	case ct_html:
+		// Denied or pending
+		page, err := s.parser.ParseCertnewPage(res.Body)
+		if err != nil {
+			logUnparsedPage(log, certnew_cer, res.Body)
+			return Unknown, "", id, err
+		}
+		desc := page.DispositionMessage
+		if page.LastStatus != "" {
+			desc += " " + page.LastStatus
+		} else {
+			log.Info("Last status unknown")
 		}
+		return page.Status, desc, id, nil
+	case ct_pkix:
+		// Certificate
+		return Ready, string(res.Body), id, nil
+	default:
+		return Unknown, "", id, fmt.Errorf("Unexpected content type %s:", res.ContentType)
 	}
-	return certStatus, "", id, fmt.Errorf("ADCS Certsrv response status %s. Error: %s", res.Status, err.Error())
-
 }
 
 /*
@@ -181,10 +186,14 @@ func (s *NtlmCertsrv) GetExistingCertificate(id string) (AdcsResponseStatus, str
  * - ADCS Request ID (if known)
  * - Error
  */
-func (s *NtlmCertsrv) RequestCertificate(csr string, template string) (AdcsResponseStatus, string, string, error) {
-	var certStatus AdcsResponseStatus = Unknown
+func (s *NtlmCertsrv) RequestCertificate(ctx context.Context, csr string, template string) (AdcsResponseStatus, string, string, error) {
+	ctx, op := startOperation(ctx, "RequestCertificate", s.url, "template", template)
+	status, desc, id, err := s.requestCertificate(ctx, csr, template)
+	op.done(err, "adcsRequestId", id, "status", status)
+	return status, desc, id, err
+}
 
-	url := fmt.Sprintf("%s/%s", s.url, certfnsh)
+func (s *NtlmCertsrv) requestCertificate(ctx context.Context, csr string, template string) (AdcsResponseStatus, string, string, error) {
 	params := neturl.Values{
 		"Mode":                {"newreq"},
 		"CertRequest":         {csr},
@@ -194,125 +203,140 @@ func (s *NtlmCertsrv) RequestCertificate(csr string, template string) (AdcsRespo
 		"SaveCert":            {"yes"},
 		"CertificateTemplate": {template},
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewBufferString(params.Encode()))
-	if err != nil {
-		klog.Errorf("Cannot create request: %s", err.Error())
-		return certStatus, "", "", err
-	}
-	req.SetBasicAuth(s.username, s.password)
-	req.Header.Set("User-agent", "Mozilla")
-	req.Header.Set("Content-type", ct_urlenc)
-
-	klog.V(4).Infof("Sending request:\n %v\n", req)
 
-	res, err := s.httpClient.Do(req)
+	res, err := s.certsrv.post(ctx, certfnsh, params)
 	if err != nil {
-		klog.Errorf("ADCS Certserv error: %s", err.Error())
-		return certStatus, "", "", err
+		return Unknown, "", "", err
 	}
-	body, err := ioutil.ReadAll(res.Body)
-	if res.Header.Get("Content-type") == ct_pkix {
-		return Ready, string(body), "none", nil
+	if res.ContentType == ct_pkix {
+		return Ready, string(res.Body), "none", nil
 	}
 
+	page, err := s.parser.ParseCertfnshPage(res.Body)
 	if err != nil {
-		klog.Errorf("Cannot read ADCS Certserv response: %s", err.Error())
-		return certStatus, "", "", err
+		logUnparsedPage(LoggerFrom(ctx), certfnsh, res.Body)
+		return Unknown, "", "", err
+	}
+	if page.RequestId == "" {
+		return Unknown, "", "", fmt.Errorf("Couldn't obtain new certificate ID: %s", page.DispositionMessage)
 	}
 
-	bodyString := string(body)
-
-	klog.V(4).Infof("Body:\n%s", bodyString)
+	return s.getExistingCertificate(ctx, page.RequestId)
+}
 
-	exp := regexp.MustCompile(`certnew.cer\?ReqID=([0-9]+)&`)
-	found := exp.FindStringSubmatch(bodyString)
-	certId := ""
-	if len(found) > 1 {
-		certId = found[1]
-	} else {
-		exp = regexp.MustCompile(`Your Request Id is ([0-9]+).`)
-		found = exp.FindStringSubmatch(bodyString)
-		if len(found) > 1 {
-			certId = found[1]
-		} else {
-			errorString := ""
-			exp = regexp.MustCompile(`The disposition message is "([^"]+)`)
-			found = exp.FindStringSubmatch(bodyString)
-			if len(found) > 1 {
-				errorString = found[1]
-			} else {
-				errorString = "Unknown error occured"
-				klog.Errorf(bodyString)
-			}
-			klog.Errorf("Couldn't obtain new certificate ID")
-			return certStatus, "", "", fmt.Errorf(errorString)
-		}
+// Get the number of the newest CA renewal.
+func (s *NtlmCertsrv) getRenewals(ctx context.Context) (int, error) {
+	res, err := s.certsrv.get(ctx, certcarc, nil)
+	if err != nil {
+		return 0, err
 	}
 
-	return s.GetExistingCertificate(certId)
+	page, err := s.parser.ParseCertcarcPage(res.Body)
+	if err != nil {
+		LoggerFrom(ctx).Info("Renewal not found. Using '0'.", "error", err.Error())
+		return 0, nil
+	}
+	return page.Renewals, nil
 }
 
-func (s *NtlmCertsrv) obtainCaCertificate(certPage string, expectedContentType string) (string, error) {
-
+func (s *NtlmCertsrv) obtainCaCertificate(ctx context.Context, certPage string, expectedContentType string) (string, error) {
 	// Check for newest renewal number
-	url := fmt.Sprintf("%s/%s", s.url, certcarc)
-	req, _ := http.NewRequest("GET", url, nil)
-	req.SetBasicAuth(s.username, s.password)
-	req.Header.Set("User-agent", "Mozilla")
-	res1, err := s.httpClient.Do(req)
+	renewal, err := s.getRenewals(ctx)
 	if err != nil {
-		klog.Errorf("ADCS Certserv error: %s", err.Error())
 		return "", err
 	}
-	defer res1.Body.Close()
-	body, err := ioutil.ReadAll(res1.Body)
+	return s.obtainCaRenewal(ctx, certPage, expectedContentType, renewal)
+}
+
+func (s *NtlmCertsrv) obtainCaRenewal(ctx context.Context, certPage string, expectedContentType string, renewal int) (string, error) {
+	res, err := s.certsrv.get(ctx, certPage, neturl.Values{"ReqID": {"CACert"}, "ENC": {"b64"}, "Renewal": {strconv.Itoa(renewal)}})
 	if err != nil {
-		klog.Errorf("Cannot read ADCS Certserv response: %s", err.Error())
 		return "", err
 	}
-
-	renewal := "0"
-	exp := regexp.MustCompile(`var nRenewals=([0-9]+);`)
-	found := exp.FindStringSubmatch(string(body))
-	if len(found) > 1 {
-		renewal = found[1]
-	} else {
-		klog.Warningf("Renewal not found. Using '0'.")
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("ADCS Certsrv response status %s", res.Status)
+	}
+	if expectedContentType != res.ContentType {
+		return "", fmt.Errorf("Unexpected content type %s:", res.ContentType)
 	}
+	return string(res.Body), nil
+}
 
-	// Get CA cert (newest renewal number)
-	url = fmt.Sprintf("%s/%s?ReqID=CACert&ENC=b64&Renewal=%s", s.url, certPage, renewal)
-	req, _ = http.NewRequest("GET", url, nil)
-	req.SetBasicAuth(s.username, s.password)
-	req.Header.Set("User-agent", "Mozilla")
-	res2, err := s.httpClient.Do(req)
+func (s *NtlmCertsrv) GetCaCertificate(ctx context.Context) (string, error) {
+	ctx, op := startOperation(ctx, "GetCaCertificate", s.url)
+	cert, err := s.obtainCaCertificate(ctx, certnew_cer, ct_pkix)
+	op.done(err)
+	return cert, err
+}
+
+func (s *NtlmCertsrv) GetCaCertificates(ctx context.Context) ([]string, error) {
+	ctx, op := startOperation(ctx, "GetCaCertificates", s.url)
+	certs, err := s.getCaCertificates(ctx)
+	op.done(err, "renewals", len(certs))
+	return certs, err
+}
+
+func (s *NtlmCertsrv) getCaCertificates(ctx context.Context) ([]string, error) {
+	renewals, err := s.getRenewals(ctx)
 	if err != nil {
-		klog.Errorf("ADCS Certserv error: %s", err.Error())
-		return "", err
+		return nil, err
 	}
-	defer res2.Body.Close()
-
-	if res2.StatusCode == http.StatusOK {
-		ct := res2.Header.Get(http.CanonicalHeaderKey("content-type"))
-		if expectedContentType != ct {
-			err = fmt.Errorf("Unexpected content type %s:", ct)
-			klog.Errorf(err.Error())
-			return "", err
-		}
-		body, err := ioutil.ReadAll(res2.Body)
+	var certs []string
+	for renewal := 0; renewal <= renewals; renewal++ {
+		cert, err := s.obtainCaRenewal(ctx, certnew_cer, ct_pkix, renewal)
 		if err != nil {
-			klog.Errorf("Cannot read ADCS Certserv response: %s", err.Error())
-			return "", err
+			return nil, err
 		}
-		return string(body), nil
+		certs = append(certs, cert)
 	}
-	return "", fmt.Errorf("ADCS Certsrv response status %s. Error: %s", res2.Status, err.Error())
+	return certs, nil
 }
-func (s *NtlmCertsrv) GetCaCertificate() (string, error) {
-	klog.Infof("Getting CA from ADCS Certsrv %s", s.url)
-	return s.obtainCaCertificate(certnew_cer, ct_pkix)
+
+func (s *NtlmCertsrv) GetCaCertificateChain(ctx context.Context) (string, error) {
+	ctx, op := startOperation(ctx, "GetCaCertificateChain", s.url)
+	chain, err := s.getCaCertificateChain(ctx)
+	op.done(err)
+	return chain, err
 }
-func (s *NtlmCertsrv) GetCaCertificateChain() (string, error) {
-	klog.Infof("Getting CA Chain from ADCS Certsrv %s", s.url)
-	return s.obtainCaCertificate(certnew_p7b, ct_pkcs7)
+
+func (s *NtlmCertsrv) getCaCertificateChain(ctx context.Context) (string, error) {
+	p7b, err := s.obtainCaCertificate(ctx, certnew_p7b, ct_pkcs7)
+	if err != nil {
+		return "", err
+	}
+	certs, err := ParsePkcs7Certificates([]byte(p7b))
+	if err != nil {
+		return "", fmt.Errorf("Cannot parse ADCS CA chain: %v", err)
+	}
+	return string(EncodeCertificatesPem(OrderCertificateChain(certs, nil))), nil
+}
+
+func (s *NtlmCertsrv) GetCertificateChain(ctx context.Context, id string) (string, string, error) {
+	ctx, op := startOperation(ctx, "GetCertificateChain", s.url, "adcsRequestId", id)
+	cert, chain, err := s.getCertificateChain(ctx, id)
+	op.done(err)
+	return cert, chain, err
+}
+
+func (s *NtlmCertsrv) getCertificateChain(ctx context.Context, id string) (string, string, error) {
+	res, err := s.certsrv.get(ctx, certnew_p7b, neturl.Values{"ReqID": {id}, "ENC": {"b64"}})
+	if err != nil {
+		return "", "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("ADCS Certsrv response status %s", res.Status)
+	}
+	if res.ContentType != ct_pkcs7 {
+		return "", "", fmt.Errorf("Unexpected content type %s:", res.ContentType)
+	}
+	certs, err := ParsePkcs7Certificates(res.Body)
+	if err != nil {
+		return "", "", fmt.Errorf("Cannot parse ADCS certificate chain: %v", err)
+	}
+	// The issued certificate is the one that didn't issue any other.
+	chain := OrderCertificateChain(certs, nil)
+	if len(chain) < 2 {
+		return "", "", fmt.Errorf("No CA certificates in the chain of request %s", id)
+	}
+	return string(EncodeCertificatesPem(chain[:1])), string(EncodeCertificatesPem(chain[1:])), nil
 }
@@ -0,0 +1,144 @@
+package adcs
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chojnack/adcs-issuer/test/adcs-sim/certserv"
+	"github.com/chojnack/adcs-issuer/tracing"
+)
+
+// Run the ADCS simulator with a copy of its CA in a temporary working directory.
+// Returns the simulator, its working directory and URL and the cleanup function.
+func newSimulator(t *testing.T) (*certserv.Certserv, string, string, func()) {
+	dir, err := ioutil.TempDir("", "adcs-sim")
+	require.NoError(t, err)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "ca"), 0755))
+	for _, name := range []string{"root.pem", "root.key"} {
+		data, err := ioutil.ReadFile(filepath.Join("../test/adcs-sim/ca", name))
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ca", name), data, 0600))
+	}
+	require.NoError(t, os.Symlink(filepath.Join(mustAbs(t, "../test/adcs-sim"), "templates"), filepath.Join(dir, "templates")))
+
+	// The server URL is needed for the AIA URLs in the certificates.
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	certserv.SetWorkDir(dir)
+	certserv.SetAiaBaseURL(server.URL)
+	sim, err := certserv.NewCertserv()
+	if err != nil {
+		server.Close()
+	}
+	require.NoError(t, err)
+
+	mux.HandleFunc("/certnew.cer", sim.HandleCertnewCer)
+	mux.HandleFunc("/certnew.p7b", sim.HandleCertnewP7b)
+	mux.HandleFunc("/certcarc.asp", sim.HandleCertcarcAsp)
+	mux.HandleFunc("/certfnsh.asp", sim.HandleCertfnshAsp)
+	mux.HandleFunc("/aia/", sim.HandleAia)
+	mux.HandleFunc("/revoke", sim.HandleRevoke)
+	mux.HandleFunc("/crl/", sim.HandleCrl)
+	return sim, dir, server.URL, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func mustAbs(t *testing.T, path string) string {
+	abs, err := filepath.Abs(path)
+	require.NoError(t, err)
+	return abs
+}
+
+func TestGetCaCertificateChainFromSimulator(t *testing.T) {
+	_, _, url, cleanup := newSimulator(t)
+	defer cleanup()
+
+	cs, err := NewNtlmCertsrv(url, "", "", nil, false, nil, false)
+	require.NoError(t, err)
+	chain, err := cs.GetCaCertificateChain(context.Background())
+	require.NoError(t, err)
+
+	block, rest := pem.Decode([]byte(chain))
+	require.NotNil(t, block)
+	assert.Equal(t, "CERTIFICATE", block.Type)
+	assert.Empty(t, rest)
+	ca, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	assert.True(t, ca.IsCA)
+}
+
+func TestGetCertificateChainFromSimulator(t *testing.T) {
+	sim, dir, url, cleanup := newSimulator(t)
+	defer cleanup()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	csrDer, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "test.example.com"},
+		DNSNames: []string{"test.example.com"},
+	}, key)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(csrDer)
+	require.NoError(t, err)
+	certPem, err := sim.CreateCertificatePem(csr)
+	require.NoError(t, err)
+	// Issued certificates are kept as <request ID>.pem
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ca", "7.pem"), certPem, 0600))
+
+	cs, err := NewNtlmCertsrv(url, "", "", nil, false, nil, false)
+	require.NoError(t, err)
+	cert, chain, err := cs.GetCertificateChain(context.Background(), "7")
+	require.NoError(t, err)
+	assert.Equal(t, string(certPem), cert)
+
+	certs, err := ParsePkcs7Certificates([]byte(chain))
+	require.NoError(t, err)
+	require.Len(t, certs, 1)
+	leaf, err := x509.ParseCertificate(mustDecodePem(t, certPem))
+	require.NoError(t, err)
+	assert.NoError(t, leaf.CheckSignatureFrom(certs[0]))
+}
+
+func mustDecodePem(t *testing.T, data []byte) []byte {
+	block, _ := pem.Decode(data)
+	require.NotNil(t, block)
+	return block.Bytes
+}
+
+func TestCertsrvSpansFromSimulator(t *testing.T) {
+	_, _, url, cleanup := newSimulator(t)
+	defer cleanup()
+	exporter := tracing.SetupInMemory()
+
+	cs, err := NewNtlmCertsrv(url, "", "", nil, false, nil, false)
+	require.NoError(t, err)
+	ctx, parent := tracing.Tracer().Start(context.Background(), "test")
+	_, err = cs.GetCaCertificateChain(ctx)
+	parent.End()
+	require.NoError(t, err)
+
+	pages := map[string]bool{}
+	for _, span := range exporter.GetSpans() {
+		// All in the caller's trace.
+		assert.Equal(t, parent.SpanContext().TraceID(), span.SpanContext.TraceID())
+		if span.Parent.SpanID() == parent.SpanContext().SpanID() {
+			pages[span.Name] = true
+		}
+	}
+	assert.Equal(t, map[string]bool{"certsrv " + certcarc: true, "certsrv " + certnew_p7b: true}, pages)
+}
@@ -0,0 +1,173 @@
+package adcs
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+var (
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+// PKCS#7 ContentInfo (RFC 2315)
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// PKCS#7 SignedData. ADCS returns the degenerate form: certificates only, no signers.
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     []asn1.RawValue `asn1:"optional,set,tag:0"`
+	CRLs             []asn1.RawValue `asn1:"optional,set,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// Parse the certificates from a PKCS#7 (certnew.p7b) response.
+// The response can be DER, base64 or PEM encoded (ADCS uses the 'CERTIFICATE' PEM type for b64 PKCS#7).
+// PEM bundles of plain certificates are accepted too.
+func ParsePkcs7Certificates(data []byte) ([]*x509.Certificate, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty PKCS#7 data")
+	}
+	if bytes.HasPrefix(data, []byte("-----BEGIN")) {
+		var certs []*x509.Certificate
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			blockCerts, err := parsePkcs7Der(block.Bytes)
+			if err != nil {
+				cert, certErr := x509.ParseCertificate(block.Bytes)
+				if certErr != nil {
+					return nil, err
+				}
+				blockCerts = []*x509.Certificate{cert}
+			}
+			certs = append(certs, blockCerts...)
+		}
+		if len(certs) == 0 {
+			return nil, fmt.Errorf("no certificates found in PEM data")
+		}
+		return certs, nil
+	}
+	if der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(data)), "")); err == nil {
+		return parsePkcs7Der(der)
+	}
+	return parsePkcs7Der(data)
+}
+
+func parsePkcs7Der(der []byte) ([]*x509.Certificate, error) {
+	var contentInfo pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(der, &contentInfo); err != nil {
+		return nil, fmt.Errorf("cannot parse PKCS#7 content info: %v", err)
+	}
+	if !contentInfo.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("unsupported PKCS#7 content type %v", contentInfo.ContentType)
+	}
+	var signedData pkcs7SignedData
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil {
+		return nil, fmt.Errorf("cannot parse PKCS#7 signed data: %v", err)
+	}
+	var certs []*x509.Certificate
+	for _, raw := range signedData.Certificates {
+		cert, err := x509.ParseCertificate(raw.FullBytes)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse PKCS#7 certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in PKCS#7 data")
+	}
+	return certs, nil
+}
+
+// Order the CA certificates starting with the leaf's issuer up to the root.
+// If leaf is nil the chain starts with the certificate that didn't issue any other one.
+// Certificates not in the chain (e.g. cross-signed ones) are appended at the end.
+func OrderCertificateChain(certs []*x509.Certificate, leaf *x509.Certificate) []*x509.Certificate {
+	used := make([]bool, len(certs))
+	var chain []*x509.Certificate
+
+	current := -1
+	if leaf != nil {
+		current = findIssuer(certs, used, leaf)
+	} else {
+		for idx, cert := range certs {
+			issuedOther := false
+			for otherIdx, other := range certs {
+				if otherIdx != idx && !IsSelfSigned(other) && IssuedBy(other, cert) {
+					issuedOther = true
+					break
+				}
+			}
+			if !issuedOther {
+				current = idx
+				break
+			}
+		}
+	}
+	for current >= 0 {
+		used[current] = true
+		chain = append(chain, certs[current])
+		if IsSelfSigned(certs[current]) {
+			break
+		}
+		current = findIssuer(certs, used, certs[current])
+	}
+	for idx, cert := range certs {
+		if !used[idx] {
+			chain = append(chain, cert)
+		}
+	}
+	return chain
+}
+
+func findIssuer(certs []*x509.Certificate, used []bool, cert *x509.Certificate) int {
+	for idx, candidate := range certs {
+		if !used[idx] && IssuedBy(cert, candidate) {
+			return idx
+		}
+	}
+	return -1
+}
+
+// Check if the certificate was issued by the CA certificate.
+// Key IDs are compared when present as the names are the same for all CA renewals.
+func IssuedBy(cert *x509.Certificate, issuer *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, issuer.RawSubject) {
+		return false
+	}
+	if len(cert.AuthorityKeyId) > 0 && len(issuer.SubjectKeyId) > 0 {
+		return bytes.Equal(cert.AuthorityKeyId, issuer.SubjectKeyId)
+	}
+	return true
+}
+
+// Check if the certificate is signed with its own key, e.g. a root CA certificate.
+// The signature is checked as the names alone are the same for a certificate issued
+// by another CA of the same name. Only the signature is checked, not the CA flag or
+// the algorithm, as old roots are often SHA-1 signed.
+func IsSelfSigned(cert *x509.Certificate) bool {
+	return IssuedBy(cert, cert) && cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// Encode the certificates as a PEM bundle.
+func EncodeCertificatesPem(certs []*x509.Certificate) []byte {
+	var buf bytes.Buffer
+	for _, cert := range certs {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,101 @@
+package adcs
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chojnack/adcs-issuer/test/adcs-sim/certserv"
+)
+
+func TestParsePkcs7Certificates(t *testing.T) {
+	root, rootKey := newTestCA(t, "Test Root", nil, nil)
+	intermediate, intermediateKey := newTestCA(t, "Test Intermediate", root, rootKey)
+	issuing, _ := newTestCA(t, "Test Issuing", intermediate, intermediateKey)
+
+	// ADCS doesn't guarantee any order.
+	der, err := certserv.EncodePkcs7([]*x509.Certificate{intermediate, root, issuing})
+	require.NoError(t, err)
+
+	encodings := map[string][]byte{
+		"DER":    der,
+		"base64": []byte(base64.StdEncoding.EncodeToString(der)),
+		"PEM":    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"PKCS7":  pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: der}),
+	}
+	for name, data := range encodings {
+		certs, err := ParsePkcs7Certificates(data)
+		require.NoError(t, err, name)
+		chain := OrderCertificateChain(certs, nil)
+		assert.Equal(t, []*x509.Certificate{issuing, intermediate, root}, chain, name)
+	}
+
+	_, err = ParsePkcs7Certificates([]byte("not a PKCS#7"))
+	assert.Error(t, err)
+}
+
+func TestOrderCertificateChainFromLeaf(t *testing.T) {
+	root, rootKey := newTestCA(t, "Test Root", nil, nil)
+	intermediate, intermediateKey := newTestCA(t, "Test Intermediate", root, rootKey)
+	leaf, _ := newTestCA(t, "Test Leaf", intermediate, intermediateKey)
+	other, _ := newTestCA(t, "Other Root", nil, nil)
+
+	chain := OrderCertificateChain([]*x509.Certificate{other, root, intermediate}, leaf)
+	assert.Equal(t, []*x509.Certificate{intermediate, root, other}, chain)
+}
+
+func TestIsSelfSigned(t *testing.T) {
+	root, rootKey := newTestCA(t, "Test Root", nil, nil)
+	intermediate, _ := newTestCA(t, "Test Intermediate", root, rootKey)
+	assert.True(t, IsSelfSigned(root))
+	assert.False(t, IsSelfSigned(intermediate))
+
+	// The same name without key IDs, signed by another key.
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Root"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, &x509.Certificate{Subject: template.Subject}, &key.PublicKey, rootKey)
+	require.NoError(t, err)
+	forged, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	require.True(t, IssuedBy(forged, forged))
+	assert.False(t, IsSelfSigned(forged))
+}
+
+func newTestCA(t *testing.T, name string, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
@@ -0,0 +1,143 @@
+package adcs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const revocationTimeout = 30 * time.Second
+
+// RevocationReason is the CRL reason code (RFC 5280).
+type RevocationReason int
+
+const (
+	ReasonUnspecified          RevocationReason = 0
+	ReasonKeyCompromise        RevocationReason = 1
+	ReasonCACompromise         RevocationReason = 2
+	ReasonAffiliationChanged   RevocationReason = 3
+	ReasonSuperseded           RevocationReason = 4
+	ReasonCessationOfOperation RevocationReason = 5
+	ReasonCertificateHold      RevocationReason = 6
+	ReasonPrivilegeWithdrawn   RevocationReason = 9
+)
+
+var revocationReasons = map[string]RevocationReason{
+	"Unspecified":          ReasonUnspecified,
+	"KeyCompromise":        ReasonKeyCompromise,
+	"CACompromise":         ReasonCACompromise,
+	"AffiliationChanged":   ReasonAffiliationChanged,
+	"Superseded":           ReasonSuperseded,
+	"CessationOfOperation": ReasonCessationOfOperation,
+	"CertificateHold":      ReasonCertificateHold,
+	"PrivilegeWithdrawn":   ReasonPrivilegeWithdrawn,
+}
+
+// ParseRevocationReason returns the code of the reason name e.g. 'KeyCompromise'.
+// The empty name is CessationOfOperation.
+func ParseRevocationReason(name string) (RevocationReason, error) {
+	if name == "" {
+		return ReasonCessationOfOperation, nil
+	}
+	if reason, ok := revocationReasons[name]; ok {
+		return reason, nil
+	}
+	return 0, fmt.Errorf("unknown revocation reason %q", name)
+}
+
+func (r RevocationReason) String() string {
+	for name, reason := range revocationReasons {
+		if reason == r {
+			return name
+		}
+	}
+	return fmt.Sprintf("RevocationReason(%d)", int(r))
+}
+
+// Revoker revokes certificates issued by ADCS. The web enrollment pages (AdcsCertsrv)
+// can't do it, so it is done by a separate service e.g. a revocation gateway.
+type Revoker interface {
+	// Revoke the certificate with the serial number (hex) issued by the CA with the distinguished name.
+	// Revoking an already revoked certificate is not an error.
+	RevokeCertificate(ctx context.Context, issuer string, serialNumber string, reason RevocationReason) error
+}
+
+// HttpRevoker POSTs the revocations as JSON to a revocation gateway:
+//
+//	{"issuer": "CN=Issuing CA,DC=example,DC=com", "serialNumber": "1a00000042", "reason": 5}
+//
+// Any 2xx response means the certificate is revoked.
+type HttpRevoker struct {
+	url        string
+	username   string
+	password   string
+	token      string
+	httpClient *http.Client
+}
+
+// NewHttpRevoker creates the revoker authenticating with the bearer token or, if not set,
+// the user name and password. Nil caCertPool means the system's CA certificates.
+func NewHttpRevoker(url string, caCertPool *x509.CertPool, username, password, token string) *HttpRevoker {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: caCertPool},
+	}
+	return &HttpRevoker{
+		url:      url,
+		username: username,
+		password: password,
+		token:    token,
+		httpClient: &http.Client{
+			Transport: spanRoundTripper{next: transport},
+			Timeout:   revocationTimeout,
+		},
+	}
+}
+
+// Close connections kept alive by the client's transport.
+func (r *HttpRevoker) CloseIdleConnections() {
+	r.httpClient.CloseIdleConnections()
+}
+
+type revocationRequest struct {
+	Issuer       string           `json:"issuer"`
+	SerialNumber string           `json:"serialNumber"`
+	Reason       RevocationReason `json:"reason"`
+}
+
+func (r *HttpRevoker) RevokeCertificate(ctx context.Context, issuer string, serialNumber string, reason RevocationReason) (err error) {
+	ctx, op := startOperation(ctx, "RevokeCertificate", r.url, "serialNumber", serialNumber, "reason", reason.String())
+	defer func() { op.done(err) }()
+
+	data, err := json.Marshal(&revocationRequest{Issuer: issuer, SerialNumber: serialNumber, Reason: reason})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", r.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	} else if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	res, err := r.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("revocation of %s failed: %s: %s", serialNumber, res.Status, bytes.TrimSpace(body))
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	return nil
+}
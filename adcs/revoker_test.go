@@ -0,0 +1,91 @@
+package adcs
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRevocationReason(t *testing.T) {
+	reason, err := ParseRevocationReason("")
+	require.NoError(t, err)
+	assert.Equal(t, ReasonCessationOfOperation, reason)
+	reason, err = ParseRevocationReason("KeyCompromise")
+	require.NoError(t, err)
+	assert.Equal(t, ReasonKeyCompromise, reason)
+	assert.Equal(t, "KeyCompromise", reason.String())
+	_, err = ParseRevocationReason("Compromised")
+	assert.Error(t, err)
+}
+
+func TestRevokeWithSimulator(t *testing.T) {
+	sim, _, url, cleanup := newSimulator(t)
+	defer cleanup()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	csrDer, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "test.example.com"},
+		DNSNames: []string{"test.example.com"},
+	}, key)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(csrDer)
+	require.NoError(t, err)
+	certPem, err := sim.CreateCertificatePem(csr)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(mustDecodePem(t, certPem))
+	require.NoError(t, err)
+	require.Len(t, cert.CRLDistributionPoints, 1)
+
+	revoker := NewHttpRevoker(url+"/revoke", nil, "", "", "")
+	serial := fmt.Sprintf("%x", cert.SerialNumber)
+	require.NoError(t, revoker.RevokeCertificate(context.Background(), cert.Issuer.String(), serial, ReasonKeyCompromise))
+	// Again
+	require.NoError(t, revoker.RevokeCertificate(context.Background(), cert.Issuer.String(), serial, ReasonKeyCompromise))
+	assert.Error(t, revoker.RevokeCertificate(context.Background(), "CN=Other CA", serial, ReasonKeyCompromise))
+
+	crl, err := x509.ParseRevocationList(fetch(t, cert.CRLDistributionPoints[0]))
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(fetch(t, cert.IssuingCertificateURL[0]))
+	require.NoError(t, err)
+	require.NoError(t, crl.CheckSignatureFrom(ca))
+	require.Len(t, crl.RevokedCertificateEntries, 1)
+	assert.Equal(t, 0, crl.RevokedCertificateEntries[0].SerialNumber.Cmp(cert.SerialNumber))
+	assert.Equal(t, int(ReasonKeyCompromise), crl.RevokedCertificateEntries[0].ReasonCode)
+}
+
+func fetch(t *testing.T, url string) []byte {
+	res, err := http.Get(url)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	return data
+}
+
+func TestRevokerAuthentication(t *testing.T) {
+	var authorization []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") == "" {
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	assert.NoError(t, NewHttpRevoker(server.URL, nil, "", "", "secret-token").RevokeCertificate(context.Background(), "CN=CA", "01", ReasonUnspecified))
+	assert.NoError(t, NewHttpRevoker(server.URL, nil, "user", "pass", "").RevokeCertificate(context.Background(), "CN=CA", "01", ReasonUnspecified))
+	err := NewHttpRevoker(server.URL, nil, "", "", "").RevokeCertificate(context.Background(), "CN=CA", "01", ReasonUnspecified)
+	assert.EqualError(t, err, "revocation of 01 failed: 401 Unauthorized: authentication required")
+	assert.Equal(t, []string{"Bearer secret-token", "Basic dXNlcjpwYXNz", ""}, authorization)
+}
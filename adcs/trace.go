@@ -0,0 +1,154 @@
+package adcs
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Longer bodies are truncated in the trace.
+	maxTraceBodySize = 4096
+	redacted         = "[REDACTED]"
+)
+
+// Headers carrying credentials. For the authorization headers the scheme is kept in the trace.
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Www-Authenticate":    true,
+	"Proxy-Authenticate":  true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// Form fields with a name containing any of these are redacted.
+var secretFormFields = []string{"pass", "pwd", "secret", "token", "credential"}
+
+// tracingRoundTripper logs the HTTP requests and responses exchanged with ADCS with the
+// credentials redacted and the bodies truncated. It's put below the NTLM negotiation
+// so each leg of the handshake is traced.
+type tracingRoundTripper struct {
+	next http.RoundTripper
+	// Sequence number of the traced requests to match the responses.
+	seq uint64
+}
+
+func newTracingRoundTripper(next http.RoundTripper) *tracingRoundTripper {
+	return &tracingRoundTripper{next: next}
+}
+
+func (t *tracingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := atomic.AddUint64(&t.seq, 1)
+	log := LoggerFrom(req.Context()).WithValues("seq", id)
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	log.Info("ADCS HTTP request", "method", req.Method, "url", redactURL(req.URL), "headers", traceHeaders(req.Header),
+		"body", traceBody(redactForm(req.Header.Get("Content-Type"), body)))
+
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		log.Info("ADCS HTTP request failed", "duration", time.Since(start), "error", err.Error())
+		return nil, err
+	}
+	body, err = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	log.Info("ADCS HTTP response", "status", res.Status, "duration", time.Since(start), "headers", traceHeaders(res.Header), "body", traceBody(body))
+	return res, nil
+}
+
+// Format the headers sorted by name with the credentials redacted.
+func traceHeaders(header http.Header) string {
+	var names []string
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		for _, value := range header[name] {
+			if secretHeaders[http.CanonicalHeaderKey(name)] {
+				value = redactCredentials(value)
+			}
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+	return b.String()
+}
+
+// Redact the header value keeping the authentication scheme (e.g. 'NTLM [REDACTED]').
+func redactCredentials(value string) string {
+	fields := strings.Fields(value)
+	if len(fields) > 1 && !strings.Contains(fields[0], "=") {
+		return fields[0] + " " + redacted
+	}
+	if len(fields) == 1 && !strings.ContainsAny(fields[0], "=;") {
+		// Only the scheme e.g. 'WWW-Authenticate: NTLM'
+		return value
+	}
+	return redacted
+}
+
+// Redact the secret fields of URL encoded forms. Other bodies are returned unchanged.
+func redactForm(contentType string, body []byte) []byte {
+	if !strings.HasPrefix(contentType, ct_urlenc) || len(body) == 0 {
+		return body
+	}
+	form, err := neturl.ParseQuery(string(body))
+	if err != nil {
+		return []byte(redacted)
+	}
+	for name := range form {
+		if isSecretField(name) {
+			form[name] = []string{redacted}
+		}
+	}
+	return []byte(form.Encode())
+}
+
+func isSecretField(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range secretFormFields {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact the password of the URL.
+func redactURL(url *neturl.URL) string {
+	if url.User == nil {
+		return url.String()
+	}
+	u := *url
+	u.User = neturl.User(url.User.Username())
+	return u.String()
+}
+
+// Truncate the body for the trace.
+func traceBody(body []byte) string {
+	if len(body) > maxTraceBodySize {
+		return fmt.Sprintf("%s\n... (%d more bytes)", body[:maxTraceBodySize], len(body)-maxTraceBodySize)
+	}
+	return string(body)
+}
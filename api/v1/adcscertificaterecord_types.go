@@ -0,0 +1,116 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+)
+
+// AdcsCertificateRecordSpec describes a certificate issued by ADCS into the cluster.
+// It is written by the controller when the certificate is issued.
+type AdcsCertificateRecordSpec struct {
+	// Serial number of the certificate (hex).
+	SerialNumber string `json:"serialNumber"`
+
+	// Distinguished name of the issuing CA.
+	Issuer string `json:"issuer"`
+
+	// Distinguished name of the subject.
+	Subject string `json:"subject"`
+
+	// Subject alternative names.
+	// +optional
+	DNSNames []string `json:"dnsNames,omitempty"`
+	// +optional
+	IPAddresses []string `json:"ipAddresses,omitempty"`
+	// +optional
+	URIs []string `json:"uris,omitempty"`
+	// +optional
+	EmailAddresses []string `json:"emailAddresses,omitempty"`
+
+	NotBefore metav1.Time `json:"notBefore"`
+	NotAfter  metav1.Time `json:"notAfter"`
+
+	// SHA-256 fingerprint of the DER encoded certificate (hex).
+	SHA256Fingerprint string `json:"sha256Fingerprint"`
+
+	// ADCS template the certificate was requested with.
+	// +optional
+	Template string `json:"template,omitempty"`
+
+	// ID of the ADCS request that issued the certificate.
+	// +optional
+	AdcsRequestId string `json:"adcsRequestId,omitempty"`
+
+	// The AdcsIssuer or ClusterAdcsIssuer the certificate was requested from.
+	IssuerRef cmmeta.ObjectReference `json:"issuerRef"`
+
+	// The AdcsRequest the certificate was issued for.
+	Request RecordObjectReference `json:"request"`
+
+	// The cert-manager Certificate owning the request, if any.
+	// +optional
+	Certificate *RecordObjectReference `json:"certificate,omitempty"`
+
+	// Time the certificate was revoked by the controller.
+	// +optional
+	Revoked *metav1.Time `json:"revoked,omitempty"`
+
+	// CRL reason of the revocation.
+	// +optional
+	RevocationReason RevocationReason `json:"revocationReason,omitempty"`
+}
+
+// RecordObjectReference references a namespaced object from a cluster-scoped record.
+type RecordObjectReference struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=adcscertificaterecords,scope=Cluster,shortName=adcscert
+// +kubebuilder:printcolumn:name="Serial Number",type="string",JSONPath=".spec.serialNumber"
+// +kubebuilder:printcolumn:name="Namespace",type="string",JSONPath=".spec.request.namespace"
+// +kubebuilder:printcolumn:name="Certificate",type="string",JSONPath=".spec.certificate.name"
+// +kubebuilder:printcolumn:name="Subject",type="string",JSONPath=".spec.subject"
+// +kubebuilder:printcolumn:name="Template",type="string",JSONPath=".spec.template",priority=1
+// +kubebuilder:printcolumn:name="Request ID",type="string",JSONPath=".spec.adcsRequestId",priority=1
+// +kubebuilder:printcolumn:name="Not After",type="string",JSONPath=".spec.notAfter"
+// +kubebuilder:printcolumn:name="Revoked",type="string",JSONPath=".spec.revoked",priority=1
+
+// AdcsCertificateRecord is the inventory entry of a certificate issued by ADCS.
+// It is named after the SHA-256 (hex) of the issuing CA's DN and the certificate's serial number.
+type AdcsCertificateRecord struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AdcsCertificateRecordSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// AdcsCertificateRecordList contains a list of AdcsCertificateRecord
+type AdcsCertificateRecordList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AdcsCertificateRecord `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AdcsCertificateRecord{}, &AdcsCertificateRecordList{})
+}
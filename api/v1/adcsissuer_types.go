@@ -40,21 +40,139 @@ type AdcsIssuerSpec struct {
 	// +optional
 	CABundle []byte `json:"caBundle,omitempty"`
 
+	// ADCS certificate template used when the request doesn't select one.
+	// Default 'BasicSSLWebServer'.
+	// +optional
+	Template string `json:"template,omitempty"`
+
 	// How often to check for request status in the server (in time.ParseDuration() format)
 	// Default 6 hours.
 	// +optional
 	StatusCheckInterval string `json:"statusCheckInterval,omitempty"`
 
+	// Policy for checking the status of pending requests.
+	// If not set the status is checked every statusCheckInterval.
+	// +optional
+	PollingPolicy *PollingPolicy `json:"pollingPolicy,omitempty"`
+
+	// How long a request may stay pending in ADCS (in time.ParseDuration() format).
+	// After that the request expires and its CertificateRequest fails.
+	// Default no limit.
+	// +optional
+	MaxPendingDuration string `json:"maxPendingDuration,omitempty"`
+
 	// How often to retry in case of communication errors (in time.ParseDuration() format)
 	// Default 1 hour.
 	// +optional
 	RetryInterval string `json:"retryInterval,omitempty"`
+
+	// Policy for re-submitting requests that errored in ADCS.
+	// If not set errored requests are final.
+	// +optional
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
+
+	// Limits for the requests sent to the ADCS server.
+	// Throttled requests are re-queued in the order they arrived.
+	// +optional
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+
+	// Settings overridden for specific ADCS templates.
+	// +optional
+	Templates []TemplatePolicy `json:"templates,omitempty"`
+
+	// Fail the request if the issued certificate deviates from the CSR
+	// (e.g. missing SANs or usages). By default deviations are only reported
+	// with an 'IssuedWithDeviations' warning.
+	// +optional
+	StrictVerification bool `json:"strictVerification,omitempty"`
+
+	// How the issued certificate and its CA chain are retrieved:
+	// 'certificate' (default) gets the chain of the CA's newest renewal,
+	// 'chain' gets the chain of the CA key that actually issued the certificate
+	// which is needed during CA key rollover.
+	// +optional
+	RetrievalMode RetrievalMode `json:"retrievalMode,omitempty"`
+
+	// How often to check for new CA renewals (in time.ParseDuration() format)
+	// Default 1 hour.
+	// +optional
+	CACheckInterval string `json:"caCheckInterval,omitempty"`
+
+	// Re-issue certificates signed by a CA certificate expiring within this time
+	// (in time.ParseDuration() format) once a newer CA renewal is available.
+	// Default no re-issuance.
+	// +optional
+	ReissueBeforeCAExpiry string `json:"reissueBeforeCAExpiry,omitempty"`
+
+	// Publish the CA bundle of the Ready issuer to ConfigMaps in the selected namespaces.
+	// The ConfigMaps are kept updated on CA renewal.
+	// +optional
+	TrustDistribution *TrustDistribution `json:"trustDistribution,omitempty"`
+
+	// Complete the CA chain returned by ADCS by following the Authority Information Access
+	// caIssuers URLs of the issued certificate up to the root or a trust anchor.
+	// +optional
+	ChainCompletion *ChainCompletion `json:"chainCompletion,omitempty"`
+
+	// Windows Server version of the ADCS web enrollment pages ('2012R2', '2016', '2019' or '2022').
+	// By default the pages are parsed with the first version that matches.
+	// +kubebuilder:validation:Enum="2012R2";"2016";"2019";"2022"
+	// +optional
+	PageProfile string `json:"pageProfile,omitempty"`
+
+	// Phrases of localized ADCS web enrollment pages matched in addition to the built-in ones (en, de, fr).
+	// +optional
+	Phrases *CertsrvPhrases `json:"phrases,omitempty"`
+
+	// Log the HTTP traffic with ADCS for troubleshooting. Credentials are redacted
+	// and long bodies truncated.
+	// +optional
+	TraceHTTP bool `json:"traceHTTP,omitempty"`
+
+	// Send notifications about the issuer's requests and CA to HTTP webhooks.
+	// +optional
+	Notifiers []Notifier `json:"notifiers,omitempty"`
+
+	// Revoke the issued certificates through a revocation gateway when they are no longer used:
+	// their AdcsRequest is deleted (e.g. with the Certificate or namespace) and no Certificate's Secret holds them.
+	// Revocation is disabled if not set.
+	// +optional
+	Revocation *Revocation `json:"revocation,omitempty"`
+
+	// New requests are submitted to ADCS only once approved by a user other than the
+	// requester (see the approval annotation). Can also be required per template.
+	// +optional
+	RequireApproval bool `json:"requireApproval,omitempty"`
+
+	// Issue the requests with isCA using a SubCA template. Their CSR's basic constraints
+	// are checked before the submission, the issued certificate must be a CA certificate
+	// and it's returned with its full chain.
+	// +optional
+	SubCA *SubCA `json:"subCA,omitempty"`
 }
 
 // AdcsIssuerStatus defines the observed state of AdcsIssuer
 type AdcsIssuerStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// +optional
+	Conditions []IssuerCondition `json:"conditions,omitempty"`
+
+	// CA certificates of all the ADCS CA renewals, the newest last.
+	// During a CA key renewal workloads need to trust all of them.
+	// +optional
+	CACertificates []CACertificate `json:"caCertificates,omitempty"`
+
+	// CA chain (PEM) of the CA's newest renewal. It's the CA bundle
+	// published by the trust distribution, with the other renewals.
+	// +optional
+	CAChain []byte `json:"caChain,omitempty"`
+
+	// Last time the CA certificates were checked.
+	// +optional
+	LastCACheck *metav1.Time `json:"lastCACheck,omitempty"`
+
+	// Deliveries of the notifications about the CA certificates.
+	// +optional
+	Notifications []NotificationStatus `json:"notifications,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -1,13 +1,17 @@
 package v1
 
 import (
+	"net"
+	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	//validationutils "k8s.io/apimachinery/pkg/util/validation"
+	validationutils "k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -15,6 +19,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	"github.com/jetstack/cert-manager/pkg/util/pki"
+
+	"github.com/chojnack/adcs-issuer/notify"
 )
 
 var log = logf.Log.WithName("adcsissuer-resource")
@@ -93,6 +99,157 @@ func (r *AdcsIssuer) validateAdcsIssuer() error {
 		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("caBundle"), r.Spec.CABundle, err.Error()))
 	}
 
+	// Validate rate limits
+	if rl := r.Spec.RateLimit; rl != nil {
+		path := field.NewPath("spec").Child("rateLimit")
+		if rl.RequestsPerSecond != "" {
+			rps, err := strconv.ParseFloat(rl.RequestsPerSecond, 64)
+			if err != nil || rps < 0 {
+				allErrs = append(allErrs, field.Invalid(path.Child("requestsPerSecond"), rl.RequestsPerSecond, "Must be a non-negative number."))
+			}
+		}
+		if rl.Burst < 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child("burst"), rl.Burst, "Must not be negative."))
+		}
+		if rl.MaxConcurrent < 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child("maxConcurrent"), rl.MaxConcurrent, "Must not be negative."))
+		}
+	}
+
+	// Validate max pending duration
+	if r.Spec.MaxPendingDuration != "" {
+		if _, err := time.ParseDuration(r.Spec.MaxPendingDuration); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("maxPendingDuration"), r.Spec.MaxPendingDuration, err.Error()))
+		}
+	}
+
+	// Validate retry policy
+	if rp := r.Spec.RetryPolicy; rp != nil {
+		path := field.NewPath("spec").Child("retryPolicy")
+		if rp.MaxAttempts < 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child("maxAttempts"), rp.MaxAttempts, "Must not be negative."))
+		}
+		for name, value := range map[string]string{"backoff": rp.Backoff, "maxBackoff": rp.MaxBackoff} {
+			if value == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(value); err != nil {
+				allErrs = append(allErrs, field.Invalid(path.Child(name), value, err.Error()))
+			}
+		}
+	}
+
+	// Validate polling policies
+	allErrs = append(allErrs, validatePollingPolicy(field.NewPath("spec").Child("pollingPolicy"), r.Spec.PollingPolicy)...)
+	for i, t := range r.Spec.Templates {
+		path := field.NewPath("spec").Child("templates").Index(i)
+		if t.Name == "" {
+			allErrs = append(allErrs, field.Required(path.Child("name"), "Template name must be set."))
+		}
+		allErrs = append(allErrs, validatePollingPolicy(path.Child("pollingPolicy"), t.PollingPolicy)...)
+		if t.MaxPendingDuration != "" {
+			if _, err := time.ParseDuration(t.MaxPendingDuration); err != nil {
+				allErrs = append(allErrs, field.Invalid(path.Child("maxPendingDuration"), t.MaxPendingDuration, err.Error()))
+			}
+		}
+	}
+
+	if r.Spec.CACheckInterval != "" {
+		if _, err := time.ParseDuration(r.Spec.CACheckInterval); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("caCheckInterval"), r.Spec.CACheckInterval, err.Error()))
+		}
+	}
+	if r.Spec.ReissueBeforeCAExpiry != "" {
+		if _, err := time.ParseDuration(r.Spec.ReissueBeforeCAExpiry); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("reissueBeforeCAExpiry"), r.Spec.ReissueBeforeCAExpiry, err.Error()))
+		}
+	}
+
+	if td := r.Spec.TrustDistribution; td != nil {
+		path := field.NewPath("spec").Child("trustDistribution")
+		for _, msg := range validationutils.IsDNS1123Subdomain(td.ConfigMapName) {
+			allErrs = append(allErrs, field.Invalid(path.Child("configMapName"), td.ConfigMapName, msg))
+		}
+		if td.Key != "" {
+			for _, msg := range validationutils.IsConfigMapKey(td.Key) {
+				allErrs = append(allErrs, field.Invalid(path.Child("key"), td.Key, msg))
+			}
+		}
+		if len(td.NamespaceSelector.MatchLabels) > 0 || len(td.NamespaceSelector.MatchExpressions) > 0 {
+			// The bundle is only written to the issuer's namespace.
+			allErrs = append(allErrs, field.Forbidden(path.Child("namespaceSelector"), "Only a ClusterAdcsIssuer's CA bundle can be written to other namespaces."))
+		}
+	}
+
+	if cc := r.Spec.ChainCompletion; cc != nil {
+		path := field.NewPath("spec").Child("chainCompletion")
+		for idx, host := range cc.AllowedHosts {
+			// Only a host, without scheme and port.
+			if host == "" || strings.Contains(host, "/") || (strings.Contains(host, ":") && net.ParseIP(host) == nil) {
+				allErrs = append(allErrs, field.Invalid(path.Child("allowedHosts").Index(idx), host, "Must be a host name or IP address."))
+			}
+		}
+		if len(cc.TrustAnchors) > 0 {
+			if _, err := pki.DecodeX509CertificateChainBytes(cc.TrustAnchors); err != nil {
+				allErrs = append(allErrs, field.Invalid(path.Child("trustAnchors"), cc.TrustAnchors, err.Error()))
+			}
+		}
+	}
+
+	names := map[string]bool{}
+	for i, n := range r.Spec.Notifiers {
+		path := field.NewPath("spec").Child("notifiers").Index(i)
+		if n.Name == "" {
+			allErrs = append(allErrs, field.Required(path.Child("name"), "Notifier name must be set."))
+		} else if names[n.Name] {
+			allErrs = append(allErrs, field.Duplicate(path.Child("name"), n.Name))
+		}
+		names[n.Name] = true
+		if u, err := url.Parse(n.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			allErrs = append(allErrs, field.Invalid(path.Child("url"), n.URL, "Must be valid 'http://' or 'https://' URL."))
+		}
+		if n.Template != "" {
+			if _, err := notify.ParseTemplate(n.Template); err != nil {
+				allErrs = append(allErrs, field.Invalid(path.Child("template"), n.Template, err.Error()))
+			}
+		}
+		for name, value := range map[string]string{"pendingThreshold": n.PendingThreshold, "caExpiryThreshold": n.CAExpiryThreshold} {
+			if value == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(value); err != nil {
+				allErrs = append(allErrs, field.Invalid(path.Child(name), value, err.Error()))
+			}
+		}
+		if n.MaxAttempts < 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child("maxAttempts"), n.MaxAttempts, "Must not be negative."))
+		}
+	}
+
+	if sub := r.Spec.SubCA; sub != nil {
+		path := field.NewPath("spec").Child("subCA")
+		if sub.Template == "" {
+			allErrs = append(allErrs, field.Required(path.Child("template"), "SubCA template must be set."))
+		}
+		if sub.MaxPathLen != nil && *sub.MaxPathLen < 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child("maxPathLen"), *sub.MaxPathLen, "Must not be negative."))
+		}
+	}
+	if rv := r.Spec.Revocation; rv != nil {
+		path := field.NewPath("spec").Child("revocation")
+		if u, err := url.Parse(rv.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			allErrs = append(allErrs, field.Invalid(path.Child("url"), rv.URL, "Must be valid 'http://' or 'https://' URL."))
+		}
+		if rv.CredentialsRef != nil && rv.CredentialsRef.Name == "" {
+			allErrs = append(allErrs, field.Required(path.Child("credentialsRef", "name"), "Secret name must be set."))
+		}
+		if len(rv.CABundle) > 0 {
+			if _, err := pki.DecodeX509CertificateChainBytes(rv.CABundle); err != nil {
+				allErrs = append(allErrs, field.Invalid(path.Child("caBundle"), rv.CABundle, err.Error()))
+			}
+		}
+	}
+
 	// TODO: Validate credentials secret name?
 
 	if len(allErrs) == 0 {
@@ -103,3 +260,29 @@ func (r *AdcsIssuer) validateAdcsIssuer() error {
 		r.Name, allErrs)
 
 }
+
+func validatePollingPolicy(path *field.Path, p *PollingPolicy) field.ErrorList {
+	var allErrs field.ErrorList
+	if p == nil {
+		return allErrs
+	}
+	for name, value := range map[string]string{"initialInterval": p.InitialInterval, "maxInterval": p.MaxInterval} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(value); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child(name), value, err.Error()))
+		}
+	}
+	for name, value := range map[string]string{"multiplier": p.Multiplier, "jitter": p.Jitter} {
+		if value == "" {
+			continue
+		}
+		if f, err := strconv.ParseFloat(value, 64); err != nil || f < 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child(name), value, "Must be a non-negative number."))
+		} else if name == "jitter" && f > 1 {
+			allErrs = append(allErrs, field.Invalid(path.Child(name), value, "Must not be greater than 1."))
+		}
+	}
+	return allErrs
+}
@@ -40,6 +40,24 @@ type AdcsRequestSpec struct {
 	// If the Issuer is not an 'ADCS' Issuer, an error will be returned and the
 	// ADCSRequest will be marked as failed.
 	IssuerRef cmmeta.ObjectReference `json:"issuerRef"`
+
+	// ADCS certificate template to request.
+	// If empty the issuer's template is used.
+	// +optional
+	Template string `json:"template,omitempty"`
+
+	// IsCA requests a CA certificate. It selects the issuer's SubCA template
+	// unless the template is set.
+	// +optional
+	IsCA bool `json:"isCA,omitempty"`
+
+	// Secret in the request's namespace to store the issued certificate ('tls.crt') and its
+	// CA chain ('ca.crt') in, for a request created without a CertificateRequest.
+	// The Secret is created, owned by the request, unless it exists with the
+	// output-secret-for annotation set to the request's name.
+	// If not set the certificate is only stored in the status.
+	// +optional
+	OutputSecretRef *LocalObjectReference `json:"outputSecretRef,omitempty"`
 }
 
 // AdcsRequestStatus defines the observed state of AdcsRequest
@@ -54,6 +72,12 @@ type AdcsRequestStatus struct {
 	// +optional
 	Id string `json:"id,omitempty"`
 
+	// Adopted is true if Id was not assigned for this request's CSR but taken from
+	// the adopt-request-id annotation. The certificate is accepted only if its
+	// public key matches the CSR.
+	// +optional
+	Adopted bool `json:"adopted,omitempty"`
+
 	// State contains the current state of this ADCSRequest resource.
 	// States 'ready' and 'rejected' are 'final'
 	// +optional
@@ -63,18 +87,165 @@ type AdcsRequestStatus struct {
 	// the current state.
 	// +optional
 	Reason string `json:"reason,omitempty"`
+
+	// Number of times the request has been submitted to ADCS.
+	// +optional
+	Attempts int `json:"attempts,omitempty"`
+
+	// Previous ADCS requests made for this AdcsRequest, oldest first.
+	// +optional
+	History []AdcsRequestAttempt `json:"history,omitempty"`
+
+	// Time the request became pending in ADCS.
+	// +optional
+	PendingSince *metav1.Time `json:"pendingSince,omitempty"`
+
+	// Number of times the status of the pending request has been checked in ADCS.
+	// +optional
+	Polls int `json:"polls,omitempty"`
+
+	// Time of the next status check of the pending request.
+	// +optional
+	NextPollAt *metav1.Time `json:"nextPollAt,omitempty"`
+
+	// The last action requested with the action annotation.
+	// +optional
+	LastAction *AdcsRequestAction `json:"lastAction,omitempty"`
+
+	// List of status conditions to indicate the status of the AdcsRequest.
+	// +optional
+	Conditions []AdcsRequestCondition `json:"conditions,omitempty"`
+
+	// Deliveries of the issuer's notifications about this request.
+	// +optional
+	Notifications []NotificationStatus `json:"notifications,omitempty"`
+	// Serial number (hex) of the issued certificate.
+	// +optional
+	SerialNumber string `json:"serialNumber,omitempty"`
+
+	// Distinguished name of the CA that issued the certificate.
+	// +optional
+	CertificateIssuer string `json:"certificateIssuer,omitempty"`
+
+	// Time the certificate was revoked.
+	// +optional
+	Revoked *metav1.Time `json:"revoked,omitempty"`
+
+	// The issued certificate (PEM), for a request created without a CertificateRequest.
+	// +optional
+	Certificate []byte `json:"certificate,omitempty"`
+
+	// The CA chain of the issued certificate (PEM), for a request created without a CertificateRequest.
+	// +optional
+	CA []byte `json:"ca,omitempty"`
+
+	// The approval decision, for requests of issuers or templates requiring approval.
+	// +optional
+	Approval *AdcsRequestApproval `json:"approval,omitempty"`
+}
+
+// AdcsRequestApproval records the decision on a request requiring approval.
+type AdcsRequestApproval struct {
+	// The decision, 'approve' or 'deny'.
+	Decision string `json:"decision"`
+
+	// User who made the decision.
+	By string `json:"by"`
+
+	// Time the decision was processed.
+	// +optional
+	Time *metav1.Time `json:"time,omitempty"`
 }
 
+// AdcsRequestAttempt records an ADCS request that has been replaced by a new one.
+type AdcsRequestAttempt struct {
+	// ID of the request assigned by the ADCS.
+	// +optional
+	Id string `json:"id,omitempty"`
+
+	// Final state of the request.
+	// +optional
+	State State `json:"state,omitempty"`
+
+	// Reason of the state.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Time the request was replaced.
+	// +optional
+	Time *metav1.Time `json:"time,omitempty"`
+}
+
+// AdcsRequestAction records an action requested by an operator.
+type AdcsRequestAction struct {
+	// The action e.g. 'poll', 'resubmit' or 'abandon'.
+	Action string `json:"action"`
+
+	// User who requested the action.
+	// +optional
+	TriggeredBy string `json:"triggeredBy,omitempty"`
+
+	// Time the action was performed.
+	// +optional
+	Time *metav1.Time `json:"time,omitempty"`
+
+	// Result of the action.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// AdcsRequestCondition contains condition information for an AdcsRequest.
+type AdcsRequestCondition struct {
+	// Type of the condition.
+	Type AdcsRequestConditionType `json:"type"`
+
+	// Status of the condition, one of ('True', 'False', 'Unknown').
+	Status cmmeta.ConditionStatus `json:"status"`
+
+	// LastTransitionTime is the timestamp corresponding to the last status
+	// change of this condition.
+	// +optional
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is a brief machine readable explanation for the condition's last
+	// transition.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable description of the details of the last
+	// transition, complementing reason.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// AdcsRequestConditionType represents an AdcsRequest condition value.
+type AdcsRequestConditionType string
+
+const (
+	// AdcsRequestConditionThrottled indicates that the request is waiting because
+	// the issuer's rate limit or concurrency cap was reached.
+	AdcsRequestConditionThrottled AdcsRequestConditionType = "Throttled"
+
+	// AdcsRequestConditionIssuedWithDeviations indicates that the issued certificate
+	// doesn't fully match the CSR, e.g. the ADCS template dropped some SANs.
+	AdcsRequestConditionIssuedWithDeviations AdcsRequestConditionType = "IssuedWithDeviations"
+)
+
 // State represents the state of an ADCSRequest.
 // Clients utilising this type must also gracefully handle unknown
 // values, as the contents of this enumeration may be added to over time.
-// +kubebuilder:validation:Enum=pending;ready;errored;rejected
+// +kubebuilder:validation:Enum=awaitingApproval;pending;ready;errored;rejected;expired;abandoned;denied
 type State string
 
 const (
 	// It is used to represent an unrecognised value.
 	Unknown State = ""
 
+	// The 'awaitingApproval' state is used when the request's issuer or template requires
+	// approval and the request hasn't been approved yet. Nothing has been sent to ADCS.
+	// This is a transient state.
+	AwaitingApproval State = "awaitingApproval"
+
 	// If a request is marked 'Pending', is's waiting for acceptance on the ADCS.
 	// This is a transient state.
 	Pending State = "pending"
@@ -91,6 +262,19 @@ const (
 
 	// The 'rejected' state is used when ADCS denied signing the request.
 	Rejected State = "rejected"
+
+	// The 'expired' state is used when the request stayed pending longer than
+	// the issuer's maxPendingDuration.
+	// This is a final state.
+	Expired State = "expired"
+
+	// The 'abandoned' state is used when an operator abandoned the request.
+	// This is a final state.
+	Abandoned State = "abandoned"
+
+	// The 'denied' state is used when the approval of the request was denied.
+	// This is a final state.
+	Denied State = "denied"
 )
 
 // +kubebuilder:object:root=true
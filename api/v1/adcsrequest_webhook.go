@@ -0,0 +1,243 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	cmapi "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:path=/mutate-adcs-certmanager-csf-nokia-com-v1-adcsrequest,mutating=true,failurePolicy=fail,groups=adcs.certmanager.csf.nokia.com,resources=adcsrequests,verbs=create;update,versions=v1,name=adcsrequest-mutation.adcs.certmanager.csf.nokia.com
+
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// ApproveVerb is the verb on adcsrequests a user must be allowed to approve or deny them.
+const ApproveVerb = "approve"
+
+// AdcsRequestAnnotator records the user who requested an action on an AdcsRequest,
+// who requested the certificate and who approved or denied it.
+// The identity is only known to the API server so it can't be done by the controller.
+// +kubebuilder:object:generate=false
+type AdcsRequestAnnotator struct {
+	// Client creates the SubjectAccessReviews of the approvals.
+	Client client.Client
+	// Reader gets the CertificateRequests and Certificates the requester is taken from.
+	// It should not be cached so a just changed requester isn't missed.
+	Reader  client.Reader
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &AdcsRequestAnnotator{}
+
+func (a *AdcsRequestAnnotator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	ar := &AdcsRequest{}
+	if err := a.decoder.Decode(req, ar); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	old := &AdcsRequest{}
+	if req.Operation == admissionv1beta1.Update {
+		if err := a.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+	if ar.Annotations == nil {
+		ar.Annotations = map[string]string{}
+	}
+
+	action, ok := ar.Annotations[ActionAnnotation]
+	if !ok {
+		delete(ar.Annotations, ActionByAnnotation)
+	} else if oldAction, ok := old.Annotations[ActionAnnotation]; ok && oldAction == action {
+		// Same action, keep who requested it.
+		ar.Annotations[ActionByAnnotation] = old.Annotations[ActionByAnnotation]
+	} else {
+		log.Info("action requested", "name", ar.Name, "namespace", ar.Namespace, "action", action, "user", req.UserInfo.Username)
+		ar.Annotations[ActionByAnnotation] = req.UserInfo.Username
+	}
+
+	requester := old.Annotations[RequestedByAnnotation]
+	if req.Operation == admissionv1beta1.Create {
+		var err error
+		if requester, err = a.requester(ctx, req, ar); err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+	}
+	if requester != "" {
+		ar.Annotations[RequestedByAnnotation] = requester
+	} else {
+		delete(ar.Annotations, RequestedByAnnotation)
+	}
+
+	denied, err := a.annotateApproval(ctx, req, ar, old)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if denied != "" {
+		return admission.Denied(denied)
+	}
+
+	marshaled, err := json.Marshal(ar)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// Get the requester of a new AdcsRequest. The requests created by the controller take it from
+// their CertificateRequest's Certificate, or the CertificateRequest if it has no Certificate.
+// Otherwise it's the user creating the AdcsRequest.
+func (a *AdcsRequestAnnotator) requester(ctx context.Context, req admission.Request, ar *AdcsRequest) (string, error) {
+	owner := metav1.GetControllerOf(ar)
+	if owner == nil || owner.Kind != cmapi.CertificateRequestKind {
+		return req.UserInfo.Username, nil
+	}
+	cr := &cmapi.CertificateRequest{}
+	if err := a.Reader.Get(ctx, client.ObjectKey{Namespace: ar.Namespace, Name: owner.Name}, cr); err != nil {
+		if apierrors.IsNotFound(err) {
+			return req.UserInfo.Username, nil
+		}
+		return "", err
+	}
+	if cr.UID != owner.UID || !bytes.Equal(cr.Spec.CSRPEM, ar.Spec.CSRPEM) {
+		// Not the request of this CertificateRequest, don't take its requester.
+		return req.UserInfo.Username, nil
+	}
+	if crtOwner := metav1.GetControllerOf(cr); crtOwner != nil && crtOwner.Kind == cmapi.CertificateKind {
+		crt := &cmapi.Certificate{}
+		err := a.Reader.Get(ctx, client.ObjectKey{Namespace: cr.Namespace, Name: crtOwner.Name}, crt)
+		if err == nil && crt.UID == crtOwner.UID {
+			return crt.Annotations[RequestedByAnnotation], nil
+		}
+		if client.IgnoreNotFound(err) != nil {
+			return "", err
+		}
+	}
+	return cr.Annotations[RequestedByAnnotation], nil
+}
+
+// Record who approved or denied the request. Returns why the approval is denied, if it is.
+// The decision can't be changed and is admitted only from a user other than the requester
+// allowed to approve the request.
+func (a *AdcsRequestAnnotator) annotateApproval(ctx context.Context, req admission.Request, ar, old *AdcsRequest) (string, error) {
+	decision, ok := ar.Annotations[ApprovalAnnotation]
+	if oldDecision, oldOk := old.Annotations[ApprovalAnnotation]; oldOk {
+		if !ok || decision != oldDecision {
+			return "the approval decision can't be changed", nil
+		}
+		ar.Annotations[ApprovalByAnnotation] = old.Annotations[ApprovalByAnnotation]
+		return "", nil
+	}
+	if !ok {
+		delete(ar.Annotations, ApprovalByAnnotation)
+		return "", nil
+	}
+
+	user := req.UserInfo.Username
+	switch decision {
+	case ApprovalApprove:
+		requester := ar.Annotations[RequestedByAnnotation]
+		if requester == "" {
+			return "the requester of the request is unknown, it can't be approved", nil
+		}
+		if requester == user {
+			return fmt.Sprintf("the request was requested by %s, it must be approved by another user", user), nil
+		}
+	case ApprovalDeny:
+	default:
+		return fmt.Sprintf("approval must be %q or %q", ApprovalApprove, ApprovalDeny), nil
+	}
+
+	extra := make(map[string]authorizationv1.ExtraValue, len(req.UserInfo.Extra))
+	for k, v := range req.UserInfo.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: ar.Namespace,
+				Verb:      ApproveVerb,
+				Group:     GroupVersion.Group,
+				Version:   GroupVersion.Version,
+				Resource:  "adcsrequests",
+				Name:      ar.Name,
+			},
+			User:   user,
+			Groups: req.UserInfo.Groups,
+			UID:    req.UserInfo.UID,
+			Extra:  extra,
+		},
+	}
+	if err := a.Client.Create(ctx, review); err != nil {
+		return "", err
+	}
+	if !review.Status.Allowed {
+		return fmt.Sprintf("user %s is not allowed to %s adcsrequests in namespace %s", user, ApproveVerb, ar.Namespace), nil
+	}
+
+	log.Info("approval decision", "name", ar.Name, "namespace", ar.Namespace, "decision", decision, "user", user)
+	ar.Annotations[ApprovalByAnnotation] = user
+	return "", nil
+}
+
+func (r *AdcsRequest) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=update,path=/validate-adcs-certmanager-csf-nokia-com-v1-adcsrequest,mutating=false,failurePolicy=fail,groups=adcs.certmanager.csf.nokia.com,resources=adcsrequests,versions=v1,name=adcsrequest-validation.adcs.certmanager.csf.nokia.com
+
+var _ webhook.Validator = &AdcsRequest{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *AdcsRequest) ValidateCreate() error {
+	return nil
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
+// What is requested from ADCS can't be changed, the approval and re-submissions of
+// the request are for the spec it was created with.
+func (r *AdcsRequest) ValidateUpdate(old runtime.Object) error {
+	oldAr := old.(*AdcsRequest)
+	path := field.NewPath("spec")
+	var allErrs field.ErrorList
+	if !bytes.Equal(r.Spec.CSRPEM, oldAr.Spec.CSRPEM) {
+		allErrs = append(allErrs, field.Forbidden(path.Child("csr"), apivalidation.FieldImmutableErrorMsg))
+	}
+	allErrs = append(allErrs, apivalidation.ValidateImmutableField(r.Spec.IssuerRef, oldAr.Spec.IssuerRef, path.Child("issuerRef"))...)
+	allErrs = append(allErrs, apivalidation.ValidateImmutableField(r.Spec.Template, oldAr.Spec.Template, path.Child("template"))...)
+	allErrs = append(allErrs, apivalidation.ValidateImmutableField(r.Spec.IsCA, oldAr.Spec.IsCA, path.Child("isCA"))...)
+	if len(allErrs) == 0 {
+		return nil
+	}
+	log.Info("rejected spec change", "name", r.Name, "namespace", r.Namespace)
+	return apierrors.NewInvalid(
+		schema.GroupKind{Group: "adcs.certmanager.csf.nokia.com", Kind: "AdcsRequest"},
+		r.Name, allErrs)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *AdcsRequest) ValidateDelete() error {
+	return nil
+}
+
+// InjectDecoder implements admission.DecoderInjector.
+func (a *AdcsRequestAnnotator) InjectDecoder(d *admission.Decoder) error {
+	a.decoder = d
+	return nil
+}
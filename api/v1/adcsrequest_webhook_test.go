@@ -0,0 +1,45 @@
+package v1
+
+import (
+	"testing"
+
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testAdcsRequest() *AdcsRequest {
+	return &AdcsRequest{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "request"},
+		Spec: AdcsRequestSpec{
+			CSRPEM:    []byte("approved CSR"),
+			IssuerRef: cmmeta.ObjectReference{Kind: "AdcsIssuer", Name: "adcs"},
+			Template:  "WebServer",
+		},
+	}
+}
+
+func TestAdcsRequestValidateUpdate(t *testing.T) {
+	old := testAdcsRequest()
+
+	// Metadata and the output Secret can change.
+	ar := testAdcsRequest()
+	ar.Annotations = map[string]string{ActionAnnotation: ActionResubmit}
+	ar.Spec.OutputSecretRef = &LocalObjectReference{Name: "output"}
+	assert.NoError(t, ar.ValidateUpdate(old))
+
+	// What is requested from ADCS can't, it would be submitted under the approval of the old spec.
+	for name, change := range map[string]func(*AdcsRequest){
+		"csr":       func(ar *AdcsRequest) { ar.Spec.CSRPEM = []byte("another CSR") },
+		"template":  func(ar *AdcsRequest) { ar.Spec.Template = "SubCA" },
+		"isCA":      func(ar *AdcsRequest) { ar.Spec.IsCA = true },
+		"issuerRef": func(ar *AdcsRequest) { ar.Spec.IssuerRef.Name = "other" },
+	} {
+		ar := testAdcsRequest()
+		change(ar)
+		err := ar.ValidateUpdate(old)
+		if assert.Error(t, err, name) {
+			assert.Contains(t, err.Error(), "spec."+name, name)
+		}
+	}
+}
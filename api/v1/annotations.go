@@ -0,0 +1,95 @@
+package v1
+
+const (
+	// TemplateAnnotation set on a CertificateRequest or its Certificate selects
+	// the ADCS template used for the request.
+	TemplateAnnotation = "adcs.certmanager.csf.nokia.com/template"
+
+	// AdoptRequestIdAnnotation set on a CertificateRequest or its Certificate makes the
+	// controller use an existing ADCS request with this ID instead of submitting the CSR.
+	// On a Certificate it applies only until its first certificate is issued.
+	AdoptRequestIdAnnotation = "adcs.certmanager.csf.nokia.com/adopt-request-id"
+
+	// TraceContextAnnotation is set by the controller on an AdcsRequest to the W3C traceparent
+	// of the span that created it. The spans of the request's later reconciles link to it.
+	TraceContextAnnotation = "adcs.certmanager.csf.nokia.com/trace-context"
+)
+
+const (
+	// ActionAnnotation set on an AdcsRequest asks the controller to perform
+	// one of the actions below. The annotation is removed once the action is done.
+	ActionAnnotation = "adcs.certmanager.csf.nokia.com/action"
+
+	// ActionByAnnotation is set by the webhook to the user who set ActionAnnotation.
+	ActionByAnnotation = "adcs.certmanager.csf.nokia.com/action-by"
+
+	// Check the request status in ADCS now instead of waiting for the next scheduled check.
+	// Also re-checks final requests e.g. errored ones fixed by the CA admin.
+	ActionPoll = "poll"
+
+	// Submit the CSR to ADCS again as a new request.
+	// The previous request is kept in the status history.
+	ActionResubmit = "resubmit"
+
+	// Stop processing the request and fail its CertificateRequest.
+	ActionAbandon = "abandon"
+)
+
+const (
+	// RequestedByAnnotation is set by the webhooks to the user who requested the certificate:
+	// the user who created or last changed the spec of a Certificate or CertificateRequest,
+	// or who created the AdcsRequest. It can't be set by users.
+	RequestedByAnnotation = "adcs.certmanager.csf.nokia.com/requested-by"
+
+	// ApprovalAnnotation set on an AdcsRequest awaiting approval approves or denies it.
+	// The webhook admits it only from a user other than the requester who is allowed
+	// to 'approve' the adcsrequests. The decision can't be changed.
+	ApprovalAnnotation = "adcs.certmanager.csf.nokia.com/approval"
+
+	// ApprovalByAnnotation is set by the webhook to the user who set ApprovalAnnotation.
+	ApprovalByAnnotation = "adcs.certmanager.csf.nokia.com/approval-by"
+
+	// Submit the request to ADCS.
+	ApprovalApprove = "approve"
+
+	// Don't submit the request. This is final.
+	ApprovalDeny = "deny"
+)
+
+const (
+	// OutputSecretForAnnotation set on an existing Secret to the name of an AdcsRequest in the
+	// same namespace lets the request store its certificate in the Secret (see outputSecretRef).
+	// Other keys of the Secret, e.g. the private key, are kept.
+	OutputSecretForAnnotation = "adcs.certmanager.csf.nokia.com/output-secret-for"
+)
+
+const (
+	// Labels of the ConfigMaps written by the trust distribution. They identify the issuer
+	// whose CA bundle the ConfigMap holds. The namespace is empty for a ClusterAdcsIssuer.
+	TrustIssuerKindLabel      = "adcs.certmanager.csf.nokia.com/issuer-kind"
+	TrustIssuerNameLabel      = "adcs.certmanager.csf.nokia.com/issuer-name"
+	TrustIssuerNamespaceLabel = "adcs.certmanager.csf.nokia.com/issuer-namespace"
+
+	// TrustIssuerNameAnnotation holds the full name of the issuer. The name label is
+	// shortened for names longer than a label value allows.
+	TrustIssuerNameAnnotation = "adcs.certmanager.csf.nokia.com/issuer-name"
+)
+
+const (
+	// Labels of the AdcsCertificateRecords. They identify the namespace and the cert-manager
+	// Certificate the certificate was issued for, e.g. to list the records of a namespace.
+	// Certificate names longer than a label value allows are shortened.
+	RecordNamespaceLabel   = "adcs.certmanager.csf.nokia.com/namespace"
+	RecordCertificateLabel = "adcs.certmanager.csf.nokia.com/certificate"
+)
+
+const (
+	// RevokeFinalizer is set on the AdcsRequests of issuers with revocation enabled once
+	// the certificate is issued. It is removed when the certificate is revoked or still used.
+	RevokeFinalizer = "adcs.certmanager.csf.nokia.com/revoke-certificate"
+
+	// IssuerRevocationFinalizer is set on the issuers with revocation enabled and their
+	// credential Secrets. It keeps them until the certificates of the issuer's deleted
+	// AdcsRequests are revoked.
+	IssuerRevocationFinalizer = "adcs.certmanager.csf.nokia.com/pending-revocations"
+)
@@ -0,0 +1,74 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:path=/mutate-cert-manager-io-v1alpha2-requester,mutating=true,failurePolicy=fail,groups=cert-manager.io,resources=certificates;certificaterequests,verbs=create;update,versions=v1alpha2,name=requester-mutation.adcs.certmanager.csf.nokia.com
+
+// RequesterAnnotator records on cert-manager Certificates and CertificateRequests the user
+// who created them or last changed their spec. It's the requester of their AdcsRequests,
+// who can't approve them. Only the objects of the ADCS issuers are annotated. The webhook
+// fails closed: admitted without it a requested-by annotation set by the user would be
+// taken as the requester, who could then approve their own request.
+// +kubebuilder:object:generate=false
+type RequesterAnnotator struct {
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &RequesterAnnotator{}
+
+func (a *RequesterAnnotator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	obj := &unstructured.Unstructured{}
+	if err := a.decoder.Decode(req, obj); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if group, _, _ := unstructured.NestedString(obj.Object, "spec", "issuerRef", "group"); group != GroupVersion.Group {
+		// Not requested from an ADCS issuer.
+		return admission.Allowed("")
+	}
+	requester := req.UserInfo.Username
+	if req.Operation == admissionv1beta1.Update {
+		old := &unstructured.Unstructured{}
+		if err := a.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if reflect.DeepEqual(obj.Object["spec"], old.Object["spec"]) {
+			// Nothing new requested.
+			requester = old.GetAnnotations()[RequestedByAnnotation]
+		}
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations[RequestedByAnnotation] == requester {
+		return admission.Allowed("")
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if requester != "" {
+		annotations[RequestedByAnnotation] = requester
+	} else {
+		delete(annotations, RequestedByAnnotation)
+	}
+	obj.SetAnnotations(annotations)
+
+	marshaled, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// InjectDecoder implements admission.DecoderInjector.
+func (a *RequesterAnnotator) InjectDecoder(d *admission.Decoder) error {
+	a.decoder = d
+	return nil
+}
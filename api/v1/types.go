@@ -1,6 +1,345 @@
 package v1
 
+import (
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
 type LocalObjectReference struct {
 	// Name of the referent.
 	Name string `json:"name"`
 }
+
+// RateLimit restricts the traffic sent to the ADCS server.
+// Issuers using the same ADCS URL share the limits.
+type RateLimit struct {
+	// Maximum number of requests per second sent to the ADCS server e.g. "0.5" or "10".
+	// Empty or "0" means no limit.
+	// +optional
+	RequestsPerSecond string `json:"requestsPerSecond,omitempty"`
+
+	// Number of requests that may be sent at once before RequestsPerSecond applies.
+	// Default 1.
+	// +optional
+	Burst int `json:"burst,omitempty"`
+
+	// Maximum number of requests in flight to the ADCS server at the same time.
+	// Zero means no limit.
+	// +optional
+	MaxConcurrent int `json:"maxConcurrent,omitempty"`
+}
+
+// PollingPolicy controls how often the status of pending requests is checked in ADCS.
+// The interval starts at InitialInterval and is multiplied by Multiplier after every
+// check until it reaches MaxInterval.
+type PollingPolicy struct {
+	// Interval before the first status check (in time.ParseDuration() format).
+	// Default is the issuer's statusCheckInterval.
+	// +optional
+	InitialInterval string `json:"initialInterval,omitempty"`
+
+	// Factor the interval is multiplied by after each check e.g. "1.5".
+	// Default "1" (fixed interval).
+	// +optional
+	Multiplier string `json:"multiplier,omitempty"`
+
+	// Upper limit of the interval (in time.ParseDuration() format).
+	// Default and at most 168h (7 days).
+	// +optional
+	MaxInterval string `json:"maxInterval,omitempty"`
+
+	// Fraction of the interval randomly added or subtracted to spread the checks
+	// e.g. "0.1" for +/-10%. At most "1".
+	// Default "0".
+	// +optional
+	Jitter string `json:"jitter,omitempty"`
+}
+
+// RetryPolicy controls re-submitting requests that ADCS marked as errored
+// because of transient problems (e.g. the CA database or policy module unavailable).
+type RetryPolicy struct {
+	// Maximum number of times the request is submitted to ADCS, including the first one.
+	// Default 3.
+	// +optional
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+
+	// Time to wait before the first re-submission (in time.ParseDuration() format).
+	// The time is doubled for each following attempt.
+	// Default 5 minutes.
+	// +optional
+	Backoff string `json:"backoff,omitempty"`
+
+	// Upper limit of the time between re-submissions (in time.ParseDuration() format).
+	// Default 1 hour.
+	// +optional
+	MaxBackoff string `json:"maxBackoff,omitempty"`
+
+	// Disposition codes considered transient, as HRESULT e.g. "0x800706ba" or
+	// symbolic name e.g. "RPC_S_SERVER_UNAVAILABLE". Errors with other codes are final.
+	// Default is a list of RPC and timeout errors.
+	// +optional
+	DispositionCodes []string `json:"dispositionCodes,omitempty"`
+}
+
+// TemplatePolicy overrides the issuer's settings for requests using a given ADCS template.
+type TemplatePolicy struct {
+	// Name of the ADCS certificate template.
+	Name string `json:"name"`
+
+	// Polling policy for pending requests using this template.
+	// +optional
+	PollingPolicy *PollingPolicy `json:"pollingPolicy,omitempty"`
+
+	// How long a request using this template may stay pending (in time.ParseDuration() format).
+	// +optional
+	MaxPendingDuration string `json:"maxPendingDuration,omitempty"`
+
+	// Requests using this template are submitted to ADCS only once approved,
+	// even if the issuer doesn't require approval.
+	// +optional
+	RequireApproval bool `json:"requireApproval,omitempty"`
+}
+
+// How issued certificates are retrieved from ADCS.
+// +kubebuilder:validation:Enum=certificate;chain
+type RetrievalMode string
+
+const (
+	// The certificate from certnew.cer and the chain of the CA's newest renewal.
+	RetrievalModeCertificate RetrievalMode = "certificate"
+	// The certificate with the chain of the CA key that issued it from certnew.p7b.
+	RetrievalModeChain RetrievalMode = "chain"
+)
+
+// CA certificate of one of the ADCS CA renewals.
+type CACertificate struct {
+	// Renewal number in ADCS, 0 for the original CA certificate.
+	Renewal int `json:"renewal"`
+
+	// Subject of the CA certificate.
+	Subject string `json:"subject"`
+
+	// Serial number of the CA certificate (hex).
+	SerialNumber string `json:"serialNumber"`
+
+	// Expiration time of the CA certificate.
+	NotAfter metav1.Time `json:"notAfter"`
+
+	// PEM encoded CA certificate.
+	Certificate []byte `json:"certificate"`
+}
+
+// IssuerCondition contains condition information for an AdcsIssuer or ClusterAdcsIssuer.
+type IssuerCondition struct {
+	// Type of the condition, currently ('Ready').
+	Type IssuerConditionType `json:"type"`
+
+	// Status of the condition, one of ('True', 'False', 'Unknown').
+	Status cmmeta.ConditionStatus `json:"status"`
+
+	// LastTransitionTime is the timestamp corresponding to the last status
+	// change of this condition.
+	// +optional
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is a brief machine readable explanation for the condition's last
+	// transition.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable description of the details of the last
+	// transition, complementing reason.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// IssuerConditionType represents an issuer condition value.
+type IssuerConditionType string
+
+const (
+	// IssuerConditionReady indicates that the ADCS server is reachable
+	// with the issuer's settings and its CA certificates are known.
+	IssuerConditionReady IssuerConditionType = "Ready"
+)
+
+// TrustDistribution publishes the issuer's CA bundle to ConfigMaps
+// so applications can trust the certificates it issues.
+// An AdcsIssuer's ConfigMap is written to its own namespace only.
+type TrustDistribution struct {
+	// Name of the ConfigMap written to each selected namespace.
+	ConfigMapName string `json:"configMapName"`
+
+	// Key of the CA bundle in the ConfigMap.
+	// Default 'ca.crt'.
+	// +optional
+	Key string `json:"key,omitempty"`
+
+	// Namespaces a ClusterAdcsIssuer's ConfigMap is written to. An empty selector
+	// selects all namespaces. Not allowed for an AdcsIssuer.
+	// +optional
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// ChainCompletion completes the CA chain of issued certificates from the
+// Authority Information Access caIssuers URLs (HTTP only).
+type ChainCompletion struct {
+	// Hosts the CA certificates may be fetched from.
+	// Default any host.
+	// +optional
+	AllowedHosts []string `json:"allowedHosts,omitempty"`
+
+	// PEM encoded CA certificates the chain ends at, e.g. an offline root
+	// not published by AIA. Without them the chain ends at a self-signed root.
+	// +optional
+	TrustAnchors []byte `json:"trustAnchors,omitempty"`
+}
+
+// CertsrvPhrases are the texts of localized ADCS web enrollment pages.
+type CertsrvPhrases struct {
+	// Disposition messages of pending requests e.g. 'Taken Under Submission'.
+	// +optional
+	Pending []string `json:"pending,omitempty"`
+
+	// Disposition messages of denied requests e.g. 'Denied by'.
+	// +optional
+	Denied []string `json:"denied,omitempty"`
+
+	// Labels of the disposition message field e.g. 'Disposition message:'.
+	// +optional
+	DispositionMessageLabels []string `json:"dispositionMessageLabels,omitempty"`
+
+	// Labels of the last status field e.g. 'LastStatus:'.
+	// +optional
+	LastStatusLabels []string `json:"lastStatusLabels,omitempty"`
+
+	// Texts before the ID of a pending request e.g. 'Your Request Id is'.
+	// +optional
+	RequestId []string `json:"requestId,omitempty"`
+
+	// Texts before the quoted disposition message of a failed request e.g. 'The disposition message is'.
+	// +optional
+	DispositionMessage []string `json:"dispositionMessage,omitempty"`
+}
+
+// Notifier POSTs notifications about the issuer's requests and CA certificates to an HTTP webhook.
+type Notifier struct {
+	// Name of the notifier, used in the delivery status.
+	Name string `json:"name"`
+
+	// URL the notifications are POSTed to.
+	URL string `json:"url"`
+
+	// Events notified. Default all.
+	// +optional
+	Events []NotificationEvent `json:"events,omitempty"`
+
+	// Go template (text/template) of the JSON payload. The notification's fields
+	// (.Event, .Key, .Time, .Issuer, .Request and .CA, see README) are available
+	// and the 'json' function quotes a value for JSON e.g. {"text": {{ json .Request.Reason }}}.
+	// Default is the notification as JSON.
+	// +optional
+	Template string `json:"template,omitempty"`
+
+	// Notify requests pending longer than this (in time.ParseDuration() format).
+	// The request is checked when its status in ADCS is.
+	// Default 24 hours.
+	// +optional
+	PendingThreshold string `json:"pendingThreshold,omitempty"`
+
+	// Notify CA certificates expiring within this time (in time.ParseDuration() format).
+	// Default 720 hours (30 days).
+	// +optional
+	CAExpiryThreshold string `json:"caExpiryThreshold,omitempty"`
+
+	// Maximum number of delivery attempts of a notification. Default 5.
+	// +optional
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Rejected;Errored;Pending;Issued;CAExpiring
+type NotificationEvent string
+
+const (
+	// The request was rejected by ADCS.
+	NotificationRejected NotificationEvent = "Rejected"
+	// The request errored in ADCS or its certificate failed the verification.
+	NotificationErrored NotificationEvent = "Errored"
+	// The request is pending longer than the notifier's pendingThreshold.
+	NotificationPending NotificationEvent = "Pending"
+	// The certificate was issued.
+	NotificationIssued NotificationEvent = "Issued"
+	// A CA certificate expires within the notifier's caExpiryThreshold.
+	NotificationCAExpiring NotificationEvent = "CAExpiring"
+)
+
+// NotificationStatus is the delivery of a notification by a notifier.
+// A notification is delivered once per notifier, event and key.
+type NotificationStatus struct {
+	// Name of the notifier.
+	Notifier string `json:"notifier"`
+
+	Event NotificationEvent `json:"event"`
+
+	// What the notification is about e.g. the ADCS request ID or the serial number of the CA certificate.
+	// +optional
+	Key string `json:"key,omitempty"`
+
+	// Delivered, Retrying or Failed (no attempts left).
+	State NotificationState `json:"state"`
+
+	// Number of delivery attempts.
+	Attempts int `json:"attempts"`
+
+	// Time of the last delivery attempt.
+	// +optional
+	LastAttempt *metav1.Time `json:"lastAttempt,omitempty"`
+
+	// Error of the last failed attempt.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+type NotificationState string
+
+const (
+	NotificationDelivered NotificationState = "Delivered"
+	NotificationRetrying  NotificationState = "Retrying"
+	NotificationFailed    NotificationState = "Failed"
+)
+
+// Revocation configures the revocation of the issued certificates. The ADCS web enrollment
+// pages can't revoke, so revocations are POSTed to a gateway (e.g. an HTTP bridge to MS-CSRA).
+type Revocation struct {
+	// URL of the revocation gateway.
+	URL string `json:"url"`
+
+	// CRL reason code of the revocations. Default 'CessationOfOperation'.
+	// +optional
+	Reason RevocationReason `json:"reason,omitempty"`
+
+	// Secret with the gateway credentials: 'token' for a bearer token or 'username' and 'password'
+	// for basic authentication. No authentication if not set.
+	// +optional
+	CredentialsRef *LocalObjectReference `json:"credentialsRef,omitempty"`
+
+	// PEM encoded CA certificates to verify connections to the gateway. Default the system's.
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+}
+
+// SubCA configures the issuance of subordinate CA certificates, e.g. for cert-manager CA issuers.
+// It applies to the requests with isCA.
+type SubCA struct {
+	// ADCS template of the CA requests, unless they select another one with the template annotation.
+	Template string `json:"template"`
+
+	// Maximum path length of the CA certificates. A CSR asking for a longer (or unlimited) path
+	// is not submitted and an issued certificate allowing one is rejected. Not limited if not set.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxPathLen *int `json:"maxPathLen,omitempty"`
+}
+
+// RevocationReason is a CRL reason (RFC 5280).
+// +kubebuilder:validation:Enum=Unspecified;KeyCompromise;CACompromise;AffiliationChanged;Superseded;CessationOfOperation;CertificateHold;PrivilegeWithdrawn
+type RevocationReason string
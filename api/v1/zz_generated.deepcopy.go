@@ -23,13 +23,119 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdcsCertificateRecord) DeepCopyInto(out *AdcsCertificateRecord) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdcsCertificateRecord.
+func (in *AdcsCertificateRecord) DeepCopy() *AdcsCertificateRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(AdcsCertificateRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AdcsCertificateRecord) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdcsCertificateRecordList) DeepCopyInto(out *AdcsCertificateRecordList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]AdcsCertificateRecord, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdcsCertificateRecordList.
+func (in *AdcsCertificateRecordList) DeepCopy() *AdcsCertificateRecordList {
+	if in == nil {
+		return nil
+	}
+	out := new(AdcsCertificateRecordList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AdcsCertificateRecordList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdcsCertificateRecordSpec) DeepCopyInto(out *AdcsCertificateRecordSpec) {
+	*out = *in
+	if in.DNSNames != nil {
+		in, out := &in.DNSNames, &out.DNSNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.IPAddresses != nil {
+		in, out := &in.IPAddresses, &out.IPAddresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.URIs != nil {
+		in, out := &in.URIs, &out.URIs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.EmailAddresses != nil {
+		in, out := &in.EmailAddresses, &out.EmailAddresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.NotBefore.DeepCopyInto(&out.NotBefore)
+	in.NotAfter.DeepCopyInto(&out.NotAfter)
+	out.IssuerRef = in.IssuerRef
+	out.Request = in.Request
+	if in.Certificate != nil {
+		in, out := &in.Certificate, &out.Certificate
+		*out = new(RecordObjectReference)
+		**out = **in
+	}
+	if in.Revoked != nil {
+		in, out := &in.Revoked, &out.Revoked
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdcsCertificateRecordSpec.
+func (in *AdcsCertificateRecordSpec) DeepCopy() *AdcsCertificateRecordSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AdcsCertificateRecordSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AdcsIssuer) DeepCopyInto(out *AdcsIssuer) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdcsIssuer.
@@ -91,6 +197,60 @@ func (in *AdcsIssuerSpec) DeepCopyInto(out *AdcsIssuerSpec) {
 		*out = make([]byte, len(*in))
 		copy(*out, *in)
 	}
+	if in.PollingPolicy != nil {
+		in, out := &in.PollingPolicy, &out.PollingPolicy
+		*out = new(PollingPolicy)
+		**out = **in
+	}
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(RetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RateLimit != nil {
+		in, out := &in.RateLimit, &out.RateLimit
+		*out = new(RateLimit)
+		**out = **in
+	}
+	if in.Templates != nil {
+		in, out := &in.Templates, &out.Templates
+		*out = make([]TemplatePolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TrustDistribution != nil {
+		in, out := &in.TrustDistribution, &out.TrustDistribution
+		*out = new(TrustDistribution)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ChainCompletion != nil {
+		in, out := &in.ChainCompletion, &out.ChainCompletion
+		*out = new(ChainCompletion)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Phrases != nil {
+		in, out := &in.Phrases, &out.Phrases
+		*out = new(CertsrvPhrases)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Notifiers != nil {
+		in, out := &in.Notifiers, &out.Notifiers
+		*out = make([]Notifier, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Revocation != nil {
+		in, out := &in.Revocation, &out.Revocation
+		*out = new(Revocation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SubCA != nil {
+		in, out := &in.SubCA, &out.SubCA
+		*out = new(SubCA)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdcsIssuerSpec.
@@ -106,6 +266,36 @@ func (in *AdcsIssuerSpec) DeepCopy() *AdcsIssuerSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AdcsIssuerStatus) DeepCopyInto(out *AdcsIssuerStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]IssuerCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CACertificates != nil {
+		in, out := &in.CACertificates, &out.CACertificates
+		*out = make([]CACertificate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CAChain != nil {
+		in, out := &in.CAChain, &out.CAChain
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastCACheck != nil {
+		in, out := &in.LastCACheck, &out.LastCACheck
+		*out = (*in).DeepCopy()
+	}
+	if in.Notifications != nil {
+		in, out := &in.Notifications, &out.Notifications
+		*out = make([]NotificationStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdcsIssuerStatus.
@@ -124,7 +314,7 @@ func (in *AdcsRequest) DeepCopyInto(out *AdcsRequest) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdcsRequest.
@@ -145,6 +335,82 @@ func (in *AdcsRequest) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdcsRequestAction) DeepCopyInto(out *AdcsRequestAction) {
+	*out = *in
+	if in.Time != nil {
+		in, out := &in.Time, &out.Time
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdcsRequestAction.
+func (in *AdcsRequestAction) DeepCopy() *AdcsRequestAction {
+	if in == nil {
+		return nil
+	}
+	out := new(AdcsRequestAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdcsRequestApproval) DeepCopyInto(out *AdcsRequestApproval) {
+	*out = *in
+	if in.Time != nil {
+		in, out := &in.Time, &out.Time
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdcsRequestApproval.
+func (in *AdcsRequestApproval) DeepCopy() *AdcsRequestApproval {
+	if in == nil {
+		return nil
+	}
+	out := new(AdcsRequestApproval)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdcsRequestAttempt) DeepCopyInto(out *AdcsRequestAttempt) {
+	*out = *in
+	if in.Time != nil {
+		in, out := &in.Time, &out.Time
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdcsRequestAttempt.
+func (in *AdcsRequestAttempt) DeepCopy() *AdcsRequestAttempt {
+	if in == nil {
+		return nil
+	}
+	out := new(AdcsRequestAttempt)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdcsRequestCondition) DeepCopyInto(out *AdcsRequestCondition) {
+	*out = *in
+	if in.LastTransitionTime != nil {
+		in, out := &in.LastTransitionTime, &out.LastTransitionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdcsRequestCondition.
+func (in *AdcsRequestCondition) DeepCopy() *AdcsRequestCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(AdcsRequestCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AdcsRequestList) DeepCopyInto(out *AdcsRequestList) {
 	*out = *in
@@ -186,6 +452,11 @@ func (in *AdcsRequestSpec) DeepCopyInto(out *AdcsRequestSpec) {
 		copy(*out, *in)
 	}
 	out.IssuerRef = in.IssuerRef
+	if in.OutputSecretRef != nil {
+		in, out := &in.OutputSecretRef, &out.OutputSecretRef
+		*out = new(LocalObjectReference)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdcsRequestSpec.
@@ -201,6 +472,59 @@ func (in *AdcsRequestSpec) DeepCopy() *AdcsRequestSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AdcsRequestStatus) DeepCopyInto(out *AdcsRequestStatus) {
 	*out = *in
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]AdcsRequestAttempt, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PendingSince != nil {
+		in, out := &in.PendingSince, &out.PendingSince
+		*out = (*in).DeepCopy()
+	}
+	if in.NextPollAt != nil {
+		in, out := &in.NextPollAt, &out.NextPollAt
+		*out = (*in).DeepCopy()
+	}
+	if in.LastAction != nil {
+		in, out := &in.LastAction, &out.LastAction
+		*out = new(AdcsRequestAction)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]AdcsRequestCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Notifications != nil {
+		in, out := &in.Notifications, &out.Notifications
+		*out = make([]NotificationStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Revoked != nil {
+		in, out := &in.Revoked, &out.Revoked
+		*out = (*in).DeepCopy()
+	}
+	if in.Certificate != nil {
+		in, out := &in.Certificate, &out.Certificate
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.CA != nil {
+		in, out := &in.CA, &out.CA
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.Approval != nil {
+		in, out := &in.Approval, &out.Approval
+		*out = new(AdcsRequestApproval)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdcsRequestStatus.
@@ -213,13 +537,104 @@ func (in *AdcsRequestStatus) DeepCopy() *AdcsRequestStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CACertificate) DeepCopyInto(out *CACertificate) {
+	*out = *in
+	in.NotAfter.DeepCopyInto(&out.NotAfter)
+	if in.Certificate != nil {
+		in, out := &in.Certificate, &out.Certificate
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CACertificate.
+func (in *CACertificate) DeepCopy() *CACertificate {
+	if in == nil {
+		return nil
+	}
+	out := new(CACertificate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertsrvPhrases) DeepCopyInto(out *CertsrvPhrases) {
+	*out = *in
+	if in.Pending != nil {
+		in, out := &in.Pending, &out.Pending
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Denied != nil {
+		in, out := &in.Denied, &out.Denied
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DispositionMessageLabels != nil {
+		in, out := &in.DispositionMessageLabels, &out.DispositionMessageLabels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastStatusLabels != nil {
+		in, out := &in.LastStatusLabels, &out.LastStatusLabels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RequestId != nil {
+		in, out := &in.RequestId, &out.RequestId
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DispositionMessage != nil {
+		in, out := &in.DispositionMessage, &out.DispositionMessage
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertsrvPhrases.
+func (in *CertsrvPhrases) DeepCopy() *CertsrvPhrases {
+	if in == nil {
+		return nil
+	}
+	out := new(CertsrvPhrases)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChainCompletion) DeepCopyInto(out *ChainCompletion) {
+	*out = *in
+	if in.AllowedHosts != nil {
+		in, out := &in.AllowedHosts, &out.AllowedHosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TrustAnchors != nil {
+		in, out := &in.TrustAnchors, &out.TrustAnchors
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChainCompletion.
+func (in *ChainCompletion) DeepCopy() *ChainCompletion {
+	if in == nil {
+		return nil
+	}
+	out := new(ChainCompletion)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterAdcsIssuer) DeepCopyInto(out *ClusterAdcsIssuer) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAdcsIssuer.
@@ -281,6 +696,60 @@ func (in *ClusterAdcsIssuerSpec) DeepCopyInto(out *ClusterAdcsIssuerSpec) {
 		*out = make([]byte, len(*in))
 		copy(*out, *in)
 	}
+	if in.PollingPolicy != nil {
+		in, out := &in.PollingPolicy, &out.PollingPolicy
+		*out = new(PollingPolicy)
+		**out = **in
+	}
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(RetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RateLimit != nil {
+		in, out := &in.RateLimit, &out.RateLimit
+		*out = new(RateLimit)
+		**out = **in
+	}
+	if in.Templates != nil {
+		in, out := &in.Templates, &out.Templates
+		*out = make([]TemplatePolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TrustDistribution != nil {
+		in, out := &in.TrustDistribution, &out.TrustDistribution
+		*out = new(TrustDistribution)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ChainCompletion != nil {
+		in, out := &in.ChainCompletion, &out.ChainCompletion
+		*out = new(ChainCompletion)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Phrases != nil {
+		in, out := &in.Phrases, &out.Phrases
+		*out = new(CertsrvPhrases)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Notifiers != nil {
+		in, out := &in.Notifiers, &out.Notifiers
+		*out = make([]Notifier, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Revocation != nil {
+		in, out := &in.Revocation, &out.Revocation
+		*out = new(Revocation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SubCA != nil {
+		in, out := &in.SubCA, &out.SubCA
+		*out = new(SubCA)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAdcsIssuerSpec.
@@ -296,6 +765,36 @@ func (in *ClusterAdcsIssuerSpec) DeepCopy() *ClusterAdcsIssuerSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterAdcsIssuerStatus) DeepCopyInto(out *ClusterAdcsIssuerStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]IssuerCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CACertificates != nil {
+		in, out := &in.CACertificates, &out.CACertificates
+		*out = make([]CACertificate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CAChain != nil {
+		in, out := &in.CAChain, &out.CAChain
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastCACheck != nil {
+		in, out := &in.LastCACheck, &out.LastCACheck
+		*out = (*in).DeepCopy()
+	}
+	if in.Notifications != nil {
+		in, out := &in.Notifications, &out.Notifications
+		*out = make([]NotificationStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAdcsIssuerStatus.
@@ -308,6 +807,25 @@ func (in *ClusterAdcsIssuerStatus) DeepCopy() *ClusterAdcsIssuerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IssuerCondition) DeepCopyInto(out *IssuerCondition) {
+	*out = *in
+	if in.LastTransitionTime != nil {
+		in, out := &in.LastTransitionTime, &out.LastTransitionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IssuerCondition.
+func (in *IssuerCondition) DeepCopy() *IssuerCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(IssuerCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LocalObjectReference) DeepCopyInto(out *LocalObjectReference) {
 	*out = *in
@@ -322,3 +840,188 @@ func (in *LocalObjectReference) DeepCopy() *LocalObjectReference {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotificationStatus) DeepCopyInto(out *NotificationStatus) {
+	*out = *in
+	if in.LastAttempt != nil {
+		in, out := &in.LastAttempt, &out.LastAttempt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotificationStatus.
+func (in *NotificationStatus) DeepCopy() *NotificationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NotificationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Notifier) DeepCopyInto(out *Notifier) {
+	*out = *in
+	if in.Events != nil {
+		in, out := &in.Events, &out.Events
+		*out = make([]NotificationEvent, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Notifier.
+func (in *Notifier) DeepCopy() *Notifier {
+	if in == nil {
+		return nil
+	}
+	out := new(Notifier)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PollingPolicy) DeepCopyInto(out *PollingPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PollingPolicy.
+func (in *PollingPolicy) DeepCopy() *PollingPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(PollingPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RateLimit) DeepCopyInto(out *RateLimit) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RateLimit.
+func (in *RateLimit) DeepCopy() *RateLimit {
+	if in == nil {
+		return nil
+	}
+	out := new(RateLimit)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RecordObjectReference) DeepCopyInto(out *RecordObjectReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RecordObjectReference.
+func (in *RecordObjectReference) DeepCopy() *RecordObjectReference {
+	if in == nil {
+		return nil
+	}
+	out := new(RecordObjectReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetryPolicy) DeepCopyInto(out *RetryPolicy) {
+	*out = *in
+	if in.DispositionCodes != nil {
+		in, out := &in.DispositionCodes, &out.DispositionCodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetryPolicy.
+func (in *RetryPolicy) DeepCopy() *RetryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RetryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Revocation) DeepCopyInto(out *Revocation) {
+	*out = *in
+	if in.CredentialsRef != nil {
+		in, out := &in.CredentialsRef, &out.CredentialsRef
+		*out = new(LocalObjectReference)
+		**out = **in
+	}
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Revocation.
+func (in *Revocation) DeepCopy() *Revocation {
+	if in == nil {
+		return nil
+	}
+	out := new(Revocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SubCA) DeepCopyInto(out *SubCA) {
+	*out = *in
+	if in.MaxPathLen != nil {
+		in, out := &in.MaxPathLen, &out.MaxPathLen
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubCA.
+func (in *SubCA) DeepCopy() *SubCA {
+	if in == nil {
+		return nil
+	}
+	out := new(SubCA)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplatePolicy) DeepCopyInto(out *TemplatePolicy) {
+	*out = *in
+	if in.PollingPolicy != nil {
+		in, out := &in.PollingPolicy, &out.PollingPolicy
+		*out = new(PollingPolicy)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplatePolicy.
+func (in *TemplatePolicy) DeepCopy() *TemplatePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplatePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrustDistribution) DeepCopyInto(out *TrustDistribution) {
+	*out = *in
+	in.NamespaceSelector.DeepCopyInto(&out.NamespaceSelector)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrustDistribution.
+func (in *TrustDistribution) DeepCopy() *TrustDistribution {
+	if in == nil {
+		return nil
+	}
+	out := new(TrustDistribution)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,196 @@
+// Package audit keeps a tamper-evident record of the certificate issuance decisions.
+// Every record carries the hash of the previous one, so a changed, removed or
+// re-ordered record breaks the chain (see Verify).
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Event is the kind of the audited step.
+type Event string
+
+const (
+	// The CSR was submitted to ADCS.
+	EventSubmitted Event = "Submitted"
+	// The status of a pending request was checked in ADCS.
+	EventPolled Event = "Polled"
+	// The state of the AdcsRequest changed.
+	EventStateChanged Event = "StateChanged"
+	// A certificate was issued.
+	EventIssued Event = "Issued"
+	// The certificate of a deleted AdcsRequest was revoked. Reason is the CRL reason.
+	EventRevoked Event = "Revoked"
+)
+
+// Record is an audited step of an AdcsRequest.
+type Record struct {
+	// Number of the record in the chain, starting from 1.
+	Seq   uint64    `json:"seq"`
+	Time  time.Time `json:"time"`
+	Event Event     `json:"event"`
+
+	// The AdcsRequest.
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	UID       string `json:"uid,omitempty"`
+
+	// Where the CSR was sent and under which credentials.
+	IssuerKind string `json:"issuerKind,omitempty"`
+	IssuerName string `json:"issuerName,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Username   string `json:"username,omitempty"`
+	Template   string `json:"template,omitempty"`
+	// SHA-256 of the DER CSR.
+	CSRSHA256 string `json:"csrSha256,omitempty"`
+
+	// What came back.
+	AdcsRequestId string       `json:"adcsRequestId,omitempty"`
+	PreviousState string       `json:"previousState,omitempty"`
+	State         string       `json:"state,omitempty"`
+	Reason        string       `json:"reason,omitempty"`
+	Certificate   *Certificate `json:"certificate,omitempty"`
+
+	// Hash of the previous record, empty for the first one.
+	PrevHash string `json:"prevHash"`
+	// SHA-256 of the record with an empty hash.
+	Hash string `json:"hash"`
+}
+
+// Certificate describes an issued certificate.
+type Certificate struct {
+	SerialNumber      string    `json:"serialNumber"`
+	Subject           string    `json:"subject"`
+	DNSNames          []string  `json:"dnsNames,omitempty"`
+	IPAddresses       []string  `json:"ipAddresses,omitempty"`
+	URIs              []string  `json:"uris,omitempty"`
+	EmailAddresses    []string  `json:"emailAddresses,omitempty"`
+	NotAfter          time.Time `json:"notAfter"`
+	SHA256Fingerprint string    `json:"sha256Fingerprint"`
+}
+
+// Sink stores the records. The records are written one at a time in the chain order.
+type Sink interface {
+	Write(ctx context.Context, record *Record) error
+}
+
+// Resumer is a Sink that keeps the records, so the chain can continue from its last record after a restart.
+type Resumer interface {
+	Sink
+	// Returns nil if there are no records.
+	Last() (*Record, error)
+}
+
+// Auditor chains the records and writes them to the sinks.
+type Auditor struct {
+	mu       sync.Mutex
+	sinks    []Sink
+	seq      uint64
+	lastHash string
+}
+
+// NewAuditor writes the records to all the sinks. The chain continues from the
+// last record of the first sink that keeps them (see Resumer).
+func NewAuditor(sinks ...Sink) (*Auditor, error) {
+	a := &Auditor{sinks: sinks}
+	for _, sink := range sinks {
+		if resumer, ok := sink.(Resumer); ok {
+			last, err := resumer.Last()
+			if err != nil {
+				return nil, err
+			}
+			if last != nil {
+				a.seq = last.Seq
+				a.lastHash = last.Hash
+			}
+			break
+		}
+	}
+	return a, nil
+}
+
+// Record chains the record and writes it to all the sinks. The record's sequence number,
+// time and hashes are set. The record is chained even if a sink fails so the sinks
+// that missed it show a gap in the sequence numbers.
+func (a *Auditor) Record(ctx context.Context, record *Record) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.seq++
+	record.Seq = a.seq
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	record.PrevHash = a.lastHash
+	hash, err := Hash(record)
+	if err != nil {
+		return err
+	}
+	record.Hash = hash
+	a.lastHash = hash
+
+	var errs []error
+	for _, sink := range a.sinks {
+		if err := sink.Write(ctx, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("audit record %d not written: %v", record.Seq, errs)
+	}
+	return nil
+}
+
+// Hash returns the SHA-256 (hex) of the JSON record with an empty hash.
+func Hash(record *Record) (string, error) {
+	r := *record
+	r.Hash = ""
+	data, err := json.Marshal(&r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// NewCertificate describes the certificate for the audit.
+func NewCertificate(cert *x509.Certificate) *Certificate {
+	c := &Certificate{
+		SerialNumber:      fmt.Sprintf("%x", cert.SerialNumber),
+		Subject:           cert.Subject.String(),
+		DNSNames:          cert.DNSNames,
+		EmailAddresses:    cert.EmailAddresses,
+		NotAfter:          cert.NotAfter.UTC(),
+		SHA256Fingerprint: Fingerprint(cert.Raw),
+	}
+	for _, ip := range cert.IPAddresses {
+		c.IPAddresses = append(c.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		c.URIs = append(c.URIs, uri.String())
+	}
+	return c
+}
+
+// Fingerprint returns the SHA-256 (hex) of the DER data.
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// CSRFingerprint returns the SHA-256 (hex) of the DER CSR in the PEM data.
+// Data that isn't PEM is hashed as is.
+func CSRFingerprint(csrPem []byte) string {
+	if block, _ := pem.Decode(csrPem); block != nil {
+		return Fingerprint(block.Bytes)
+	}
+	return Fingerprint(csrPem)
+}
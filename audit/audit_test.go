@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFileAuditor(t *testing.T, path string) (*Auditor, *FileSink) {
+	sink, err := NewFileSink(path)
+	require.NoError(t, err)
+	auditor, err := NewAuditor(sink)
+	require.NoError(t, err)
+	return auditor, sink
+}
+
+func TestFileSinkChainsRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	auditor, sink := newFileAuditor(t, path)
+	require.NoError(t, auditor.Record(context.Background(), &Record{Event: EventSubmitted, Namespace: "default", Name: "test", State: "pending"}))
+	require.NoError(t, auditor.Record(context.Background(), &Record{Event: EventStateChanged, Namespace: "default", Name: "test", PreviousState: "unknown", State: "pending"}))
+	require.NoError(t, sink.Close())
+
+	// The chain continues after a restart.
+	auditor, sink = newFileAuditor(t, path)
+	record := &Record{Event: EventPolled, Namespace: "default", Name: "test", State: "ready"}
+	require.NoError(t, auditor.Record(context.Background(), record))
+	require.NoError(t, sink.Close())
+	assert.Equal(t, uint64(3), record.Seq)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.NoError(t, Verify(bytes.NewReader(data)))
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+
+	// Changed record
+	tampered := strings.Replace(string(data), `"state":"ready"`, `"state":"rejected"`, 1)
+	assert.EqualError(t, Verify(strings.NewReader(tampered)), "audit log line 3: record 3: hash mismatch")
+
+	// Removed record
+	removed := lines[0] + "\n" + lines[2] + "\n"
+	assert.EqualError(t, Verify(strings.NewReader(removed)), "audit log line 2: record 3: not chained to record 1")
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received []*Record
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		record := new(Record)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(record))
+		received = append(received, record)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	auditor, err := NewAuditor(NewWebhookSink(server.URL))
+	require.NoError(t, err)
+	require.NoError(t, auditor.Record(context.Background(), &Record{Event: EventSubmitted, Name: "test"}))
+	status = http.StatusInternalServerError
+	assert.Error(t, auditor.Record(context.Background(), &Record{Event: EventPolled, Name: "test"}))
+
+	require.Len(t, received, 2)
+	assert.Equal(t, "", received[0].PrevHash)
+	assert.Equal(t, received[0].Hash, received[1].PrevHash)
+}
+
+func TestNewCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	notAfter := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(0x1234),
+		Subject:      pkix.Name{CommonName: "test.example.com"},
+		DNSNames:     []string{"test.example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.1")},
+		NotBefore:    notAfter.Add(-time.Hour),
+		NotAfter:     notAfter,
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: "CA"}}, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	c := NewCertificate(cert)
+	assert.Equal(t, "1234", c.SerialNumber)
+	assert.Equal(t, "CN=test.example.com", c.Subject)
+	assert.Equal(t, []string{"test.example.com"}, c.DNSNames)
+	assert.Equal(t, []string{"10.0.0.1"}, c.IPAddresses)
+	assert.Equal(t, notAfter, c.NotAfter)
+	assert.Equal(t, Fingerprint(der), c.SHA256Fingerprint)
+	assert.Len(t, c.SHA256Fingerprint, 64)
+}
@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileSink appends the records as JSON lines to a file.
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// NewFileSink opens the file for appending, creating it if needed.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open audit log: %v", err)
+	}
+	return &FileSink{path: path, file: file}, nil
+}
+
+// Write appends the record and syncs the file.
+func (s *FileSink) Write(ctx context.Context, record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("cannot write audit log: %v", err)
+	}
+	return s.file.Sync()
+}
+
+// Last reads the last record of the file.
+func (s *FileSink) Last() (*Record, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read audit log: %v", err)
+	}
+	defer file.Close()
+	var last *Record
+	err = readRecords(file, func(record *Record) error {
+		last = record
+		return nil
+	})
+	return last, err
+}
+
+// Close the file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// Call fn for each JSON record line.
+func readRecords(r io.Reader, fn func(*Record) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		record := new(Record)
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return fmt.Errorf("audit log line %d: %v", line, err)
+		}
+		if err := fn(record); err != nil {
+			return fmt.Errorf("audit log line %d: %v", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Verify checks the hash chain of the JSON lines records. It fails on the first
+// record that was changed or doesn't follow the previous one.
+func Verify(r io.Reader) error {
+	var prev *Record
+	return readRecords(r, func(record *Record) error {
+		hash, err := Hash(record)
+		if err != nil {
+			return err
+		}
+		if hash != record.Hash {
+			return fmt.Errorf("record %d: hash mismatch", record.Seq)
+		}
+		if prev != nil {
+			if record.PrevHash != prev.Hash {
+				return fmt.Errorf("record %d: not chained to record %d", record.Seq, prev.Seq)
+			}
+			if record.Seq != prev.Seq+1 {
+				return fmt.Errorf("record %d: expected sequence number %d", record.Seq, prev.Seq+1)
+			}
+		}
+		prev = record
+		return nil
+	})
+}
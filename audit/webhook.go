@@ -0,0 +1,51 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// WebhookSink POSTs each record as JSON to a URL.
+// The receiver keeps the chain; the records of a restarted controller start a new chain.
+type WebhookSink struct {
+	url        string
+	httpClient *http.Client
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{
+		url:        url,
+		httpClient: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// Write POSTs the record. Any response status other than 2xx is an error.
+func (s *WebhookSink) Write(ctx context.Context, record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("audit webhook: %v", err)
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook response status %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	cmapi "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+	"github.com/chojnack/adcs-issuer/audit"
+)
+
+// +kubebuilder:rbac:groups=adcs.certmanager.csf.nokia.com,resources=adcscertificaterecords,verbs=get;list;watch;create;update;patch;delete
+
+// AdcsCertificateRecordReconciler exports the expiry of the recorded certificates as metrics
+// and removes the records of certificates expired longer than the retention.
+type AdcsCertificateRecordReconciler struct {
+	client.Client
+	Log logr.Logger
+	// Time after the certificate's expiry its record is removed. Zero keeps the records.
+	Retention time.Duration
+
+	mu sync.Mutex
+	// Metric labels of the records, to remove their series when they are deleted.
+	labels map[string]prometheus.Labels
+}
+
+func (r *AdcsCertificateRecordReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("adcscertificaterecord", req.Name)
+
+	record := new(api.AdcsCertificateRecord)
+	if err := r.Client.Get(ctx, req.NamespacedName, record); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.forget(req.Name)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if r.Retention > 0 {
+		removeAt := record.Spec.NotAfter.Add(r.Retention)
+		if wait := time.Until(removeAt); wait > 0 {
+			r.export(record)
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+		log.Info("Removing record of expired certificate", "notAfter", record.Spec.NotAfter.UTC().Format(time.RFC3339))
+		r.forget(req.Name)
+		return ctrl.Result{}, client.IgnoreNotFound(r.Client.Delete(ctx, record))
+	}
+	r.export(record)
+	return ctrl.Result{}, nil
+}
+
+func (r *AdcsCertificateRecordReconciler) export(record *api.AdcsCertificateRecord) {
+	labels := prometheus.Labels{
+		"record":      record.Name,
+		"namespace":   record.Spec.Request.Namespace,
+		"certificate": "",
+		"issuer_kind": record.Spec.IssuerRef.Kind,
+		"issuer_name": record.Spec.IssuerRef.Name,
+	}
+	if c := record.Spec.Certificate; c != nil {
+		labels["certificate"] = c.Name
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.labels == nil {
+		r.labels = map[string]prometheus.Labels{}
+	}
+	if old, ok := r.labels[record.Name]; ok && !reflect.DeepEqual(old, labels) {
+		certificateNotAfter.Delete(old)
+	}
+	r.labels[record.Name] = labels
+	certificateNotAfter.With(labels).Set(float64(record.Spec.NotAfter.Unix()))
+}
+
+func (r *AdcsCertificateRecordReconciler) forget(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if labels, ok := r.labels[name]; ok {
+		certificateNotAfter.Delete(labels)
+		delete(r.labels, name)
+	}
+}
+
+func (r *AdcsCertificateRecordReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&api.AdcsCertificateRecord{}).
+		Complete(r)
+}
+
+// Record the issued certificate in the inventory. The record is created, or updated
+// if the request was re-checked, and a failure doesn't fail the issuance.
+func (r *AdcsRequestReconciler) recordCertificate(ctx context.Context, log logr.Logger, ar *api.AdcsRequest, cr *cmapi.CertificateRequest, template string, cert *x509.Certificate) {
+	record := newCertificateRecord(ar, cr, template, cert)
+	log = log.WithValues("adcscertificaterecord", record.Name)
+
+	existing := new(api.AdcsCertificateRecord)
+	err := r.Client.Get(ctx, client.ObjectKey{Name: record.Name}, existing)
+	switch {
+	case apierrors.IsNotFound(err):
+		err = r.Client.Create(ctx, record)
+	case err == nil:
+		if existing.Spec.Issuer != record.Spec.Issuer || existing.Spec.SerialNumber != record.Spec.SerialNumber || existing.Spec.Request != record.Spec.Request {
+			// Not a re-check of the same request, don't let it take the record over.
+			err = fmt.Errorf("record exists for request %s/%s", existing.Spec.Request.Namespace, existing.Spec.Request.Name)
+			break
+		}
+		record.Spec.Revoked = existing.Spec.Revoked
+		record.Spec.RevocationReason = existing.Spec.RevocationReason
+		if reflect.DeepEqual(existing.Spec, record.Spec) && reflect.DeepEqual(existing.Labels, record.Labels) {
+			return
+		}
+		existing.Labels = record.Labels
+		existing.Spec = record.Spec
+		err = r.Client.Update(ctx, existing)
+	}
+	if err != nil {
+		log.Error(err, "Cannot record issued certificate")
+		return
+	}
+	log.V(1).Info("Issued certificate recorded")
+}
+
+func newCertificateRecord(ar *api.AdcsRequest, cr *cmapi.CertificateRequest, template string, cert *x509.Certificate) *api.AdcsCertificateRecord {
+	c := audit.NewCertificate(cert)
+	record := &api.AdcsCertificateRecord{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   certificateRecordName(cert.Issuer.String(), c.SerialNumber),
+			Labels: map[string]string{api.RecordNamespaceLabel: ar.Namespace},
+		},
+		Spec: api.AdcsCertificateRecordSpec{
+			SerialNumber:      c.SerialNumber,
+			Issuer:            cert.Issuer.String(),
+			Subject:           c.Subject,
+			DNSNames:          c.DNSNames,
+			IPAddresses:       c.IPAddresses,
+			URIs:              c.URIs,
+			EmailAddresses:    c.EmailAddresses,
+			NotBefore:         metav1.NewTime(cert.NotBefore.UTC()),
+			NotAfter:          metav1.NewTime(c.NotAfter),
+			SHA256Fingerprint: c.SHA256Fingerprint,
+			Template:          template,
+			AdcsRequestId:     ar.Status.Id,
+			IssuerRef:         ar.Spec.IssuerRef,
+			Request:           api.RecordObjectReference{Namespace: ar.Namespace, Name: ar.Name},
+		},
+	}
+	if cr == nil {
+		// Standalone request.
+		return record
+	}
+	if owner := metav1.GetControllerOf(cr); owner != nil && owner.Kind == cmapi.CertificateKind {
+		record.Spec.Certificate = &api.RecordObjectReference{Namespace: cr.Namespace, Name: owner.Name}
+		record.Labels[api.RecordCertificateLabel] = labelValue(owner.Name)
+	}
+	return record
+}
+
+// Records are named after the hash of the issuing CA's DN and the serial number (hex).
+// The serial numbers are only unique per CA.
+func certificateRecordName(issuer, serialNumber string) string {
+	sum := sha256.Sum256([]byte(issuer + "\n" + serialNumber))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	cmapi "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+func testRecordedRequest(name string) *api.AdcsRequest {
+	return &api.AdcsRequest{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: name},
+		Spec:       api.AdcsRequestSpec{IssuerRef: cmmeta.ObjectReference{Kind: "AdcsIssuer", Name: "adcs"}},
+		Status:     api.AdcsRequestStatus{Id: "42"},
+	}
+}
+
+// A CertificateRequest of the named cert-manager Certificate.
+func testCertificateRequestOf(certificate string) *cmapi.CertificateRequest {
+	crt := &cmapi.Certificate{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: certificate, UID: "crt-uid"}}
+	return &cmapi.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "team",
+			Name:            "request",
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(crt, cmapi.SchemeGroupVersion.WithKind(cmapi.CertificateKind))},
+		},
+	}
+}
+
+func TestNewCertificateRecord(t *testing.T) {
+	ca := newTestCertificate(t, "Test CA", time.Now().Add(24*time.Hour), nil)
+	cert := newTestCertificate(t, "app.example.com", time.Now().Add(time.Hour), ca).cert
+
+	// Standalone request.
+	record := newCertificateRecord(testRecordedRequest("request"), nil, "WebServer", cert)
+	assert.Equal(t, certificateRecordName(cert.Issuer.String(), record.Spec.SerialNumber), record.Name)
+	assert.Equal(t, map[string]string{api.RecordNamespaceLabel: "team"}, record.Labels)
+	assert.Equal(t, "CN=Test CA", record.Spec.Issuer)
+	assert.Equal(t, "WebServer", record.Spec.Template)
+	assert.Equal(t, "42", record.Spec.AdcsRequestId)
+	assert.Equal(t, api.RecordObjectReference{Namespace: "team", Name: "request"}, record.Spec.Request)
+	assert.Nil(t, record.Spec.Certificate)
+
+	// Request of a cert-manager Certificate.
+	record = newCertificateRecord(testRecordedRequest("request"), testCertificateRequestOf("app"), "WebServer", cert)
+	assert.Equal(t, &api.RecordObjectReference{Namespace: "team", Name: "app"}, record.Spec.Certificate)
+	assert.Equal(t, "app", record.Labels[api.RecordCertificateLabel])
+
+	// The label is shortened for long Certificate names, the reference keeps the name.
+	long := strings.Repeat("app.example.com-", 8) + "tls"
+	record = newCertificateRecord(testRecordedRequest("request"), testCertificateRequestOf(long), "WebServer", cert)
+	assert.Equal(t, long, record.Spec.Certificate.Name)
+	assert.Empty(t, validation.IsValidLabelValue(record.Labels[api.RecordCertificateLabel]))
+}
+
+func TestRecordCertificate(t *testing.T) {
+	ctx := context.Background()
+	ca := newTestCertificate(t, "Test CA", time.Now().Add(24*time.Hour), nil)
+	cert := newTestCertificate(t, "app.example.com", time.Now().Add(time.Hour), ca).cert
+	c := newFakeClient(t)
+	r := &AdcsRequestReconciler{Client: c, Log: logf.NullLogger{}, Recorder: record.NewFakeRecorder(10)}
+	name := newCertificateRecord(testRecordedRequest("request"), nil, "", cert).Name
+	stored := func() *api.AdcsCertificateRecord {
+		record := new(api.AdcsCertificateRecord)
+		require.NoError(t, c.Get(ctx, client.ObjectKey{Name: name}, record))
+		return record
+	}
+
+	// Created on issuance.
+	r.recordCertificate(ctx, logf.NullLogger{}, testRecordedRequest("request"), nil, "WebServer", cert)
+	assert.Equal(t, "WebServer", stored().Spec.Template)
+
+	// Updated by a re-check of the request, keeping the revocation.
+	record := stored()
+	revoked := metav1.NewTime(time.Now().Truncate(time.Second))
+	record.Spec.Revoked = &revoked
+	record.Spec.RevocationReason = "keyCompromise"
+	require.NoError(t, c.Update(ctx, record))
+	r.recordCertificate(ctx, logf.NullLogger{}, testRecordedRequest("request"), testCertificateRequestOf("app"), "WebServer", cert)
+	record = stored()
+	assert.Equal(t, "app", record.Labels[api.RecordCertificateLabel])
+	assert.NotNil(t, record.Spec.Revoked)
+	assert.Equal(t, api.RevocationReason("keyCompromise"), record.Spec.RevocationReason)
+
+	// Not taken over by another request.
+	r.recordCertificate(ctx, logf.NullLogger{}, testRecordedRequest("other"), nil, "Other", cert)
+	record = stored()
+	assert.Equal(t, "request", record.Spec.Request.Name)
+	assert.Equal(t, "WebServer", record.Spec.Template)
+}
+
+func TestCertificateRecordReconcile(t *testing.T) {
+	ctx := context.Background()
+	newRecord := func(name string, notAfter time.Time) *api.AdcsCertificateRecord {
+		return &api.AdcsCertificateRecord{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: api.AdcsCertificateRecordSpec{
+				NotAfter:    metav1.NewTime(notAfter.Truncate(time.Second)),
+				IssuerRef:   cmmeta.ObjectReference{Kind: "AdcsIssuer", Name: "adcs"},
+				Request:     api.RecordObjectReference{Namespace: "team", Name: name},
+				Certificate: &api.RecordObjectReference{Namespace: "team", Name: "app"},
+			},
+		}
+	}
+	valid := newRecord("valid", time.Now().Add(time.Hour))
+	expired := newRecord("expired", time.Now().Add(-48*time.Hour))
+	r := &AdcsCertificateRecordReconciler{Client: newFakeClient(t, valid, expired), Log: logf.NullLogger{}, Retention: 24 * time.Hour}
+	series := func(name string) prometheus.Labels {
+		return prometheus.Labels{"record": name, "namespace": "team", "certificate": "app", "issuer_kind": "AdcsIssuer", "issuer_name": "adcs"}
+	}
+	reconcile := func(name string) ctrl.Result {
+		result, err := r.Reconcile(ctrl.Request{NamespacedName: client.ObjectKey{Name: name}})
+		require.NoError(t, err)
+		return result
+	}
+
+	// The expiry is exported until the record is removed after the retention.
+	result := reconcile("valid")
+	assert.True(t, result.RequeueAfter > 24*time.Hour)
+	assert.Equal(t, float64(valid.Spec.NotAfter.Unix()), testutil.ToFloat64(certificateNotAfter.With(series("valid"))))
+
+	// Exported once, the record of a certificate expired longer than the retention is removed.
+	r.export(expired)
+	reconcile("expired")
+	err := r.Client.Get(ctx, client.ObjectKey{Name: "expired"}, new(api.AdcsCertificateRecord))
+	assert.True(t, apierrors.IsNotFound(err))
+	assert.NotContains(t, r.labels, "expired")
+	assert.False(t, certificateNotAfter.Delete(series("expired")))
+
+	// The series is removed with the record.
+	require.NoError(t, r.Client.Delete(ctx, valid))
+	reconcile("valid")
+	assert.NotContains(t, r.labels, "valid")
+	assert.False(t, certificateNotAfter.Delete(series("valid")))
+
+	// Records are kept without a retention.
+	r = &AdcsCertificateRecordReconciler{Client: newFakeClient(t, expired), Log: logf.NullLogger{}}
+	reconcile("expired")
+	assert.NoError(t, r.Client.Get(ctx, client.ObjectKey{Name: "expired"}, new(api.AdcsCertificateRecord)))
+	assert.True(t, certificateNotAfter.Delete(series("expired")))
+}
+
+func TestCertificateRecordExportRelabels(t *testing.T) {
+	r := &AdcsCertificateRecordReconciler{}
+	record := &api.AdcsCertificateRecord{
+		ObjectMeta: metav1.ObjectMeta{Name: "relabeled"},
+		Spec: api.AdcsCertificateRecordSpec{
+			NotAfter:  metav1.NewTime(time.Now()),
+			IssuerRef: cmmeta.ObjectReference{Kind: "AdcsIssuer", Name: "adcs"},
+			Request:   api.RecordObjectReference{Namespace: "team", Name: "request"},
+		},
+	}
+	r.export(record)
+	old := r.labels["relabeled"]
+
+	// The series of the old labels is replaced.
+	record.Spec.Certificate = &api.RecordObjectReference{Namespace: "team", Name: "app"}
+	r.export(record)
+	assert.Equal(t, "app", r.labels["relabeled"]["certificate"])
+	assert.False(t, certificateNotAfter.Delete(old))
+
+	r.forget("relabeled")
+	assert.Empty(t, r.labels)
+	r.forget("unknown")
+}
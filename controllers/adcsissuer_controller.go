@@ -19,16 +19,22 @@ import (
 	"context"
 
 	"github.com/go-logr/logr"
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	adcsv1 "github.com/chojnack/adcs-issuer/api/v1"
+	"github.com/chojnack/adcs-issuer/issuers"
 )
 
 // AdcsIssuerReconciler reconciles a AdcsIssuer object
 type AdcsIssuerReconciler struct {
 	client.Client
-	Log logr.Logger
+	Log           logr.Logger
+	Recorder      record.EventRecorder
+	IssuerFactory issuers.IssuerFactory
 }
 
 // +kubebuilder:rbac:groups=adcs.certmanager.csf.nokia.com,resources=adcsissuers,verbs=get;list;watch;create;update;patch;delete
@@ -51,11 +57,20 @@ func (r *AdcsIssuerReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 	}
 	log.Info("Registered issuer")
 
-	return ctrl.Result{}, nil
+	ref := cmmeta.ObjectReference{Kind: "AdcsIssuer", Name: issuer.Name}
+	finalizer := issuerFinalizer{Client: r.Client, ClusterResourceNamespace: r.IssuerFactory.ClusterResourceNamespace}
+	if deleted, result, err := finalizer.sync(ctx, log, issuer, ref, issuer.Namespace, &issuer.Spec); deleted || err != nil {
+		return result, err
+	}
+	sync := caRenewalSync{Client: r.Client, Recorder: r.Recorder, IssuerFactory: r.IssuerFactory}
+	result := sync.sync(ctx, log, issuer, ref, issuer.Namespace, &issuer.Status)
+	return result, r.Client.Status().Update(ctx, issuer)
 }
 
 func (r *AdcsIssuerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&adcsv1.AdcsIssuer{}).
+		// Status updates don't need a reconcile, the CA is checked periodically.
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
 		Complete(r)
 }
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+// An approved request with an ADCS ID in the state, with the re-submit requested.
+func testApprovedRequest(state api.State) *api.AdcsRequest {
+	now := metav1.Now()
+	return &api.AdcsRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "team",
+			Name:      "request",
+			Annotations: map[string]string{
+				api.ApprovalAnnotation:   api.ApprovalApprove,
+				api.ApprovalByAnnotation: "approver",
+				api.ActionAnnotation:     api.ActionResubmit,
+				api.ActionByAnnotation:   "operator",
+			},
+		},
+		Status: api.AdcsRequestStatus{
+			State:    state,
+			Id:       "42",
+			Reason:   "Denied by Policy Module 0x800706ba",
+			Approval: &api.AdcsRequestApproval{Decision: api.ApprovalApprove, By: "approver", Time: &now},
+		},
+	}
+}
+
+func performResubmit(t *testing.T, ar *api.AdcsRequest) *api.AdcsRequest {
+	key := client.ObjectKey{Namespace: "team", Name: "request"}
+	r := &AdcsRequestReconciler{Client: newFakeClient(t, ar), Log: logf.NullLogger{}, Recorder: record.NewFakeRecorder(10)}
+	require.NoError(t, r.performAction(context.Background(), ar, key, api.ActionResubmit))
+	result := new(api.AdcsRequest)
+	require.NoError(t, r.Client.Get(context.Background(), key, result))
+	assert.NotContains(t, result.Annotations, api.ActionAnnotation)
+	assert.NotContains(t, result.Annotations, api.ActionByAnnotation)
+	return result
+}
+
+func TestResubmitKeepsApproval(t *testing.T) {
+	ar := performResubmit(t, testApprovedRequest(api.Errored))
+
+	assert.Equal(t, api.Unknown, ar.Status.State)
+	assert.Empty(t, ar.Status.Id)
+	assert.Equal(t, "Re-submitted by operator", ar.Status.Reason)
+	assert.NotNil(t, ar.Status.NextPollAt)
+	if assert.Len(t, ar.Status.History, 1) {
+		assert.Equal(t, "42", ar.Status.History[0].Id)
+		assert.Equal(t, api.Errored, ar.Status.History[0].State)
+	}
+	// Not asked for approval again.
+	if assert.NotNil(t, ar.Status.Approval) {
+		assert.Equal(t, api.ApprovalApprove, ar.Status.Approval.Decision)
+		assert.Equal(t, "approver", ar.Status.Approval.By)
+	}
+	assert.Equal(t, api.ApprovalApprove, ar.Annotations[api.ApprovalAnnotation])
+	assert.Equal(t, "approver", ar.Annotations[api.ApprovalByAnnotation])
+}
+
+func TestResubmitRefused(t *testing.T) {
+	for state, message := range map[api.State]string{
+		api.Ready:  "Certificate already issued, not re-submitted",
+		api.Denied: "Approval denied, not re-submitted",
+	} {
+		ar := performResubmit(t, testApprovedRequest(state))
+		assert.Equal(t, state, ar.Status.State)
+		assert.Equal(t, "42", ar.Status.Id)
+		assert.Empty(t, ar.Status.History)
+		if assert.NotNil(t, ar.Status.LastAction) {
+			assert.Equal(t, message, ar.Status.LastAction.Message)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+
+	cmapi "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/chojnack/adcs-issuer/adcs"
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+// fakeAdcsRequests keeps every request pending and records what was sent to ADCS.
+type fakeAdcsRequests struct {
+	fakeCertsrv
+	submitted int
+	polled    []string
+}
+
+func (f *fakeAdcsRequests) RequestCertificate(ctx context.Context, csr string, template string) (adcs.AdcsResponseStatus, string, string, error) {
+	f.submitted++
+	return adcs.Pending, "Taken Under Submission", "100", nil
+}
+
+func (f *fakeAdcsRequests) GetExistingCertificate(ctx context.Context, id string) (adcs.AdcsResponseStatus, string, string, error) {
+	f.polled = append(f.polled, id)
+	return adcs.Pending, "Taken Under Submission", id, nil
+}
+
+func testAdoptingRequest(t *testing.T, id string) *api.AdcsRequest {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "test"}}, key)
+	require.NoError(t, err)
+	return &api.AdcsRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "team",
+			Name:        "request",
+			Annotations: map[string]string{api.AdoptRequestIdAnnotation: id},
+		},
+		Spec: api.AdcsRequestSpec{
+			CSRPEM:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}),
+			IssuerRef: cmmeta.ObjectReference{Kind: "AdcsIssuer", Name: "adcs"},
+		},
+	}
+}
+
+// Reconcile the request once and return its stored state.
+func reconcileAdoption(t *testing.T, ar *api.AdcsRequest, certServ *fakeAdcsRequests) (*api.AdcsRequest, *record.FakeRecorder) {
+	c, factory := newTestIssuerFactory(t, testRenewalIssuer(""), certServ, ar)
+	recorder := record.NewFakeRecorder(10)
+	r := &AdcsRequestReconciler{
+		Client:                       c,
+		Log:                          logf.NullLogger{},
+		Recorder:                     recorder,
+		IssuerFactory:                factory,
+		CertificateRequestController: &CertificateRequestReconciler{Client: c, Log: logf.NullLogger{}, Recorder: recorder},
+	}
+	key := client.ObjectKey{Namespace: "team", Name: "request"}
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	stored := new(api.AdcsRequest)
+	require.NoError(t, c.Get(context.Background(), key, stored))
+	return stored, recorder
+}
+
+func TestReconcileAdoptsRequest(t *testing.T) {
+	certServ := &fakeAdcsRequests{}
+	ar, _ := reconcileAdoption(t, testAdoptingRequest(t, "42"), certServ)
+
+	// The existing request is polled, the CSR isn't submitted.
+	assert.Equal(t, 0, certServ.submitted)
+	assert.Equal(t, []string{"42"}, certServ.polled)
+	assert.Equal(t, api.Pending, ar.Status.State)
+	assert.Equal(t, "42", ar.Status.Id)
+	assert.True(t, ar.Status.Adopted)
+	assert.NotNil(t, ar.Status.PendingSince)
+	assert.NotNil(t, ar.Status.NextPollAt)
+}
+
+func TestReconcileDoesNotAdoptAgain(t *testing.T) {
+	for name, status := range map[string]api.AdcsRequestStatus{
+		"adopted":      {State: api.Unknown, Adopted: true},
+		"re-submitted": {State: api.Unknown, History: []api.AdcsRequestAttempt{{Id: "42", State: api.Errored}}},
+	} {
+		certServ := &fakeAdcsRequests{}
+		ar := testAdoptingRequest(t, "42")
+		ar.Status = status
+		ar, _ = reconcileAdoption(t, ar, certServ)
+
+		// A new ADCS request is submitted instead.
+		assert.Equal(t, 1, certServ.submitted, name)
+		assert.Empty(t, certServ.polled, name)
+		assert.Equal(t, api.Pending, ar.Status.State, name)
+		assert.Equal(t, "100", ar.Status.Id, name)
+	}
+}
+
+func TestReconcileRejectsInvalidAdoptId(t *testing.T) {
+	for _, id := range []string{"abc", "0", "-1", "42; DROP"} {
+		certServ := &fakeAdcsRequests{}
+		ar, recorder := reconcileAdoption(t, testAdoptingRequest(t, id), certServ)
+
+		// Nothing is sent to ADCS.
+		assert.Equal(t, 0, certServ.submitted, id)
+		assert.Empty(t, certServ.polled, id)
+		assert.Equal(t, api.Errored, ar.Status.State, id)
+		assert.False(t, ar.Status.Adopted, id)
+		assert.Contains(t, ar.Status.Reason, "Invalid ADCS request ID", id)
+		if assert.Len(t, recorder.Events, 1, id) {
+			assert.Contains(t, <-recorder.Events, "Warning errored", id)
+		}
+	}
+}
+
+func TestCreateAdcsRequestAdoptId(t *testing.T) {
+	ctx := context.Background()
+	crt := &cmapi.Certificate{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "team",
+			Name:        "cert",
+			UID:         "crt-uid",
+			Annotations: map[string]string{api.AdoptRequestIdAnnotation: "7"},
+		},
+	}
+	newCertificateRequest := func(annotations map[string]string) *cmapi.CertificateRequest {
+		return &cmapi.CertificateRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       "team",
+				Name:            "cert-1",
+				UID:             "cr-uid",
+				Annotations:     annotations,
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(crt, cmapi.SchemeGroupVersion.WithKind(cmapi.CertificateKind))},
+			},
+			Spec: cmapi.CertificateRequestSpec{CSRPEM: []byte("CSR")},
+		}
+	}
+	adoptId := func(crt *cmapi.Certificate, cr *cmapi.CertificateRequest) string {
+		c := newFakeClient(t, []runtime.Object{crt}...)
+		r := &CertificateRequestReconciler{Client: c, Log: logf.NullLogger{}, Recorder: record.NewFakeRecorder(10)}
+		require.NoError(t, r.createAdcsRequest(ctx, cr))
+		ar := new(api.AdcsRequest)
+		require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "team", Name: "cert-1"}, ar))
+		return ar.Annotations[api.AdoptRequestIdAnnotation]
+	}
+
+	// Taken from the Certificate for its first issuance.
+	assert.Equal(t, "7", adoptId(crt, newCertificateRequest(nil)))
+	// The CertificateRequest's annotation comes first.
+	assert.Equal(t, "8", adoptId(crt, newCertificateRequest(map[string]string{api.AdoptRequestIdAnnotation: "8"})))
+
+	// Renewals submit new ADCS requests.
+	issued := crt.DeepCopy()
+	notAfter := metav1.Now()
+	issued.Status.NotAfter = &notAfter
+	assert.Equal(t, "", adoptId(issued, newCertificateRequest(nil)))
+	assert.Equal(t, "8", adoptId(issued, newCertificateRequest(map[string]string{api.AdoptRequestIdAnnotation: "8"})))
+}
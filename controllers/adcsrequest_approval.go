@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	cmapi "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+// Process the approval of a request requiring it. Returns true if the request is approved
+// and may be submitted. Otherwise it waits for the approval or has been denied.
+// The approval annotations are set by the webhook, which checks the approver.
+func (r *AdcsRequestReconciler) checkApproval(ctx context.Context, log logr.Logger, ar *api.AdcsRequest, cr *cmapi.CertificateRequest) (bool, error) {
+	previousState := ar.Status.State
+	decision := ar.Annotations[api.ApprovalAnnotation]
+	by := ar.Annotations[api.ApprovalByAnnotation]
+	requester := ar.Annotations[api.RequestedByAnnotation]
+	log = log.WithValues("requestedBy", requester)
+
+	if by == "" || (decision == api.ApprovalApprove && by == requester) {
+		if decision != "" {
+			log.Info("Ignoring approval not recorded by the webhook", "decision", decision, "approvalBy", by)
+		}
+		if ar.Status.State == api.AwaitingApproval {
+			return false, nil
+		}
+		ar.Status.State = api.AwaitingApproval
+		ar.Status.Reason = "Waiting for approval"
+		log.Info(ar.Status.Reason)
+		if err := r.setCertificateRequestStatus(ctx, cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, "ADCS request waiting for approval"); err != nil {
+			return false, err
+		}
+		r.auditTransition(ctx, log, ar, previousState)
+		return false, r.setStatus(ctx, ar)
+	}
+	if decision != api.ApprovalApprove && decision != api.ApprovalDeny {
+		// Not admitted by the webhook.
+		log.Info("Ignoring unknown approval decision", "decision", decision)
+		return false, nil
+	}
+
+	now := metav1.Now()
+	ar.Status.Approval = &api.AdcsRequestApproval{
+		Decision: decision,
+		By:       by,
+		Time:     &now,
+	}
+	switch decision {
+	case api.ApprovalApprove:
+		ar.Status.State = api.Unknown
+		ar.Status.Reason = fmt.Sprintf("Approved by %s", by)
+		log.Info(ar.Status.Reason)
+		r.Recorder.Event(ar, core.EventTypeNormal, "Approved", ar.Status.Reason)
+		r.auditTransition(ctx, log, ar, previousState)
+		// Kept before the submission, so a re-tried submission doesn't need another approval.
+		return true, r.Client.Status().Update(ctx, ar)
+	default:
+		ar.Status.State = api.Denied
+		ar.Status.Reason = fmt.Sprintf("Denied by %s", by)
+		log.Info(ar.Status.Reason)
+		// Like a rejection the denial is final so the CertificateRequest keeps the Reason 'Pending',
+		// which doesn't make cert-manager re-try it.
+		if err := r.setCertificateRequestStatus(ctx, cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, "ADCS request denied by %s", by); err != nil {
+			return false, err
+		}
+		r.auditTransition(ctx, log, ar, previousState)
+		return false, r.setStatus(ctx, ar)
+	}
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/go-logr/logr"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+	"github.com/chojnack/adcs-issuer/audit"
+	"github.com/chojnack/adcs-issuer/issuers"
+)
+
+// Record the exchange with ADCS: the submission or status check, the state transition
+// and the issued certificate. Nothing is recorded if ADCS wasn't contacted.
+func (r *AdcsRequestReconciler) auditIssue(ctx context.Context, log logr.Logger, issuer *issuers.Issuer, ar *api.AdcsRequest, previous api.State, cert []byte) {
+	if r.Auditor == nil || (previous != api.Unknown && previous != api.Pending) {
+		return
+	}
+	event := audit.EventSubmitted
+	if previous == api.Pending {
+		event = audit.EventPolled
+	}
+	records := []*audit.Record{r.newAuditRecord(event, ar, issuer)}
+	if ar.Status.State != previous {
+		records = append(records, r.newAuditTransition(ar, previous))
+	}
+	if ar.Status.State == api.Ready && cert != nil {
+		record := r.newAuditRecord(audit.EventIssued, ar, issuer)
+		if block, _ := pem.Decode(cert); block != nil {
+			if c, err := x509.ParseCertificate(block.Bytes); err == nil {
+				record.Certificate = audit.NewCertificate(c)
+			}
+		}
+		records = append(records, record)
+	}
+	for _, record := range records {
+		r.writeAudit(ctx, log, record)
+	}
+}
+
+// Record the state transition done without ADCS e.g. by an operator action.
+func (r *AdcsRequestReconciler) auditTransition(ctx context.Context, log logr.Logger, ar *api.AdcsRequest, previous api.State) {
+	if r.Auditor == nil || ar.Status.State == previous {
+		return
+	}
+	r.writeAudit(ctx, log, r.newAuditTransition(ar, previous))
+}
+
+func (r *AdcsRequestReconciler) newAuditTransition(ar *api.AdcsRequest, previous api.State) *audit.Record {
+	record := r.newAuditRecord(audit.EventStateChanged, ar, nil)
+	record.PreviousState = auditState(previous)
+	return record
+}
+
+func (r *AdcsRequestReconciler) newAuditRecord(event audit.Event, ar *api.AdcsRequest, issuer *issuers.Issuer) *audit.Record {
+	record := &audit.Record{
+		Event:         event,
+		Namespace:     ar.Namespace,
+		Name:          ar.Name,
+		UID:           string(ar.UID),
+		IssuerKind:    ar.Spec.IssuerRef.Kind,
+		IssuerName:    ar.Spec.IssuerRef.Name,
+		AdcsRequestId: ar.Status.Id,
+		State:         auditState(ar.Status.State),
+		Reason:        ar.Status.Reason,
+	}
+	if issuer != nil {
+		record.URL = issuer.URL
+		record.Username = issuer.Username
+		record.Template = issuer.TemplateFor(ar)
+		record.CSRSHA256 = audit.CSRFingerprint(ar.Spec.CSRPEM)
+	}
+	return record
+}
+
+// The audit doesn't block the issuance. A record that can't be written leaves
+// a gap in the sequence numbers of the sink.
+func (r *AdcsRequestReconciler) writeAudit(ctx context.Context, log logr.Logger, record *audit.Record) {
+	if err := r.Auditor.Record(ctx, record); err != nil {
+		log.Error(err, "Cannot write audit record", "event", record.Event)
+	}
+}
+
+func auditState(state api.State) string {
+	if state == api.Unknown {
+		return "unknown"
+	}
+	return string(state)
+}
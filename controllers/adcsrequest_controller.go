@@ -18,19 +18,28 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 
 	cmapi "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
 	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	"github.com/jetstack/cert-manager/pkg/util/pki"
 
+	"github.com/chojnack/adcs-issuer/adcs"
 	api "github.com/chojnack/adcs-issuer/api/v1"
+	"github.com/chojnack/adcs-issuer/audit"
 	"github.com/chojnack/adcs-issuer/issuers"
+	"github.com/chojnack/adcs-issuer/tracing"
 )
 
 // AdcsRequestReconciler reconciles a AdcsRequest object
@@ -40,12 +49,16 @@ type AdcsRequestReconciler struct {
 	IssuerFactory                issuers.IssuerFactory
 	Recorder                     record.EventRecorder
 	CertificateRequestController *CertificateRequestReconciler
+	// Number of AdcsRequests processed in parallel. Default 1.
+	MaxConcurrentReconciles int
+	// Auditor is optional. Without it the issuance isn't audited.
+	Auditor *audit.Auditor
 }
 
 // +kubebuilder:rbac:groups=adcs.certmanager.csf.nokia.com,resources=adcsrequests,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=adcs.certmanager.csf.nokia.com,resources=adcsrequests/status,verbs=get;update;patch
 
-func (r *AdcsRequestReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+func (r *AdcsRequestReconciler) Reconcile(req ctrl.Request) (result ctrl.Result, err error) {
 	ctx := context.Background()
 	log := r.Log.WithValues("adcsrequest", req.NamespacedName)
 
@@ -61,6 +74,20 @@ func (r *AdcsRequestReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 		// The Manager will log other errors.
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	// Reconciles may come long after the submission so they start their own traces
+	// linked to the one that created the request.
+	ctx, span := tracing.StartReconcile(ctx, "AdcsRequestReconciler", req.NamespacedName, tracing.LinkTo(ar.Annotations[api.TraceContextAnnotation]))
+	defer func() { tracing.End(span, err) }()
+
+	if ar.DeletionTimestamp != nil {
+		return ctrl.Result{}, r.finalize(ctx, log, ar)
+	}
+
+	if action, ok := ar.Annotations[api.ActionAnnotation]; ok {
+		// Process the request again once the action is recorded.
+		return ctrl.Result{Requeue: true}, r.performAction(ctx, ar, req.NamespacedName, action)
+	}
+
 	// Find the issuer
 	issuer, err := r.IssuerFactory.GetIssuer(ctx, ar.Spec.IssuerRef, ar.Namespace)
 	if err != nil {
@@ -68,7 +95,83 @@ func (r *AdcsRequestReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 		return ctrl.Result{}, err
 	}
 
-	cert, caCert, err := issuer.Issue(ctx, ar)
+	if ar.Status.State != api.Unknown && ar.Status.State != api.Pending && ar.Status.State != api.AwaitingApproval {
+		if ar.Status.State == api.Ready {
+			// Re-tried until the Secret is written.
+			if err := r.writeOutputSecret(ctx, log, ar); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		// The request is done, only failed notification deliveries may be left to re-try.
+		if !hasNotificationRetries(ar.Status.Notifications) {
+			return ctrl.Result{}, nil
+		}
+		retry := r.notify(ctx, log, issuer, ar)
+		return ctrl.Result{RequeueAfter: retry}, r.Client.Status().Update(ctx, ar)
+	}
+
+	// Get the original CertificateRequest to set result in, before anything is sent to ADCS.
+	// There is none for a standalone request.
+	cr, err := r.certificateRequest(ctx, ar)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if (ar.Status.State == api.Unknown || ar.Status.State == api.AwaitingApproval) && ar.Status.Approval == nil && issuer.RequiresApproval(ar) {
+		// Nothing is sent to ADCS before the approval.
+		if approved, err := r.checkApproval(ctx, log, ar, cr); !approved || err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Adopted requests need the approval too as they bring an existing certificate in.
+	if id := ar.Annotations[api.AdoptRequestIdAnnotation]; id != "" {
+		adopted, err := adoptRequest(ar, id)
+		if err != nil {
+			// Nothing is sent to ADCS, the annotation has to be fixed.
+			ar.Status.State = api.Errored
+			ar.Status.Reason = err.Error()
+			if err := r.setCertificateRequestStatus(ctx, cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed, "ADCS request errored: %v", err); err != nil {
+				return ctrl.Result{}, err
+			}
+			r.auditTransition(ctx, log, ar, api.Unknown)
+			return ctrl.Result{}, r.setStatus(ctx, ar)
+		}
+		if adopted {
+			log.Info("Adopting existing ADCS request", "id", id)
+		}
+	}
+
+	if ar.Status.State == api.Unknown && ar.Status.NextPollAt != nil {
+		// Re-submission scheduled
+		if wait := time.Until(ar.Status.NextPollAt.Time); wait > 0 {
+			return ctrl.Result{Requeue: true, RequeueAfter: wait}, nil
+		}
+	}
+	if ar.Status.State == api.Pending {
+		expired, wait := issuer.PendingWait(ar, time.Now())
+		if expired {
+			return ctrl.Result{}, r.expire(ctx, ar, req.NamespacedName, issuer.ExpiresAt(ar).Sub(ar.Status.PendingSince.Time))
+		}
+		// Don't bother ADCS before the scheduled status check of a pending request.
+		if wait > 0 {
+			return ctrl.Result{Requeue: true, RequeueAfter: wait}, nil
+		}
+	}
+
+	previousState := ar.Status.State
+	cert, caCert, err := issuer.Issue(adcs.NewContext(ctx, log), ar)
+	if throttled, ok := err.(*issuers.ThrottledError); ok {
+		// Nothing was sent to ADCS. Keep the place in the queue and come back
+		// when the issuer's limits allow it.
+		log.V(1).Info(fmt.Sprintf("Throttled request will be re-tried in %v", throttled.RetryAfter), "reason", throttled.Reason)
+		if setAdcsRequestCondition(ar, api.AdcsRequestConditionThrottled, cmmeta.ConditionTrue, throttled.Reason, "Waiting for the issuer's rate limits") {
+			if err := r.Client.Status().Update(ctx, ar); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{Requeue: true, RequeueAfter: throttled.RetryAfter}, nil
+	}
 	if err != nil {
 		// This is a local error.
 		// We don't change the request status and just put it back on the queue
@@ -77,37 +180,255 @@ func (r *AdcsRequestReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 		return ctrl.Result{Requeue: true, RequeueAfter: issuer.RetryInterval}, nil
 	}
 
-	// Get the original CertificateRequest to set result in
-	cr, err := r.CertificateRequestController.GetCertificateRequest(ctx, req.NamespacedName)
+	if cond := getAdcsRequestCondition(ar, api.AdcsRequestConditionThrottled); cond != nil && cond.Status == cmmeta.ConditionTrue {
+		setAdcsRequestCondition(ar, api.AdcsRequestConditionThrottled, cmmeta.ConditionFalse, "Sent", "Request sent to ADCS")
+	}
+
+	var deviations []string
+	if ar.Status.State == api.Ready {
+		var usages []cmapi.KeyUsage
+		isCA := ar.Spec.IsCA
+		if cr != nil {
+			usages = cr.Spec.Usages
+			isCA = isCA || cr.Spec.IsCA
+		}
+		deviations, err = issuer.VerifyCertificate(ar, cert, caCert, usages, isCA)
+		if err == nil && isCA {
+			// A CA issuer needs the intermediates with its certificate and the root.
+			cert, caCert, err = issuer.SubCAChain(cert, caCert)
+		}
+		if err != nil {
+			ar.Status.State = api.Errored
+			ar.Status.Reason = fmt.Sprintf("Certificate verification failed: %v", err)
+		} else if len(deviations) > 0 {
+			message := strings.Join(deviations, "; ")
+			log.Info("Certificate issued with deviations", "deviations", message)
+			setAdcsRequestCondition(ar, api.AdcsRequestConditionIssuedWithDeviations, cmmeta.ConditionTrue, "Deviations", message)
+			r.Recorder.Event(ar, core.EventTypeWarning, string(api.AdcsRequestConditionIssuedWithDeviations), message)
+		}
+	}
+	r.auditIssue(ctx, log, issuer, ar, previousState, cert)
 	switch ar.Status.State {
 	case api.Pending:
-		// Check again later
-		log.Info(fmt.Sprintf("Pending request will be re-tried in %v", issuer.StatusCheckInterval))
+		// Check again later. The schedule is kept in status so it survives restarts.
+		interval := issuer.NextPollInterval(ar)
+		nextPollAt := metav1.NewTime(time.Now().Add(interval))
+		ar.Status.NextPollAt = &nextPollAt
+		ar.Status.Polls++
+		if expiresAt := issuer.ExpiresAt(ar); expiresAt != nil && expiresAt.Before(nextPollAt.Time) {
+			interval = time.Until(*expiresAt)
+		}
+		log.Info(fmt.Sprintf("Pending request will be re-tried in %v", interval))
+		interval = minRequeue(interval, r.notify(ctx, log, issuer, ar))
 		r.setStatus(ctx, ar)
-		return ctrl.Result{Requeue: true, RequeueAfter: issuer.StatusCheckInterval}, nil
+		return ctrl.Result{Requeue: true, RequeueAfter: interval}, nil
 	case api.Ready:
-		cr.Status.Certificate = cert
-		cr.Status.CA = caCert
-		r.CertificateRequestController.SetStatus(ctx, &cr, cmmeta.ConditionTrue, cmapi.CertificateRequestReasonIssued, "ADCS request successfull")
+		if cr != nil {
+			cr.Status.Certificate = cert
+			cr.Status.CA = caCert
+		} else {
+			// Standalone request, the certificate is kept in its status.
+			ar.Status.Certificate = cert
+			ar.Status.CA = caCert
+		}
+		if c, err := pki.DecodeX509CertificateBytes(cert); err == nil {
+			ar.Status.SerialNumber = fmt.Sprintf("%x", c.SerialNumber)
+			ar.Status.CertificateIssuer = c.Issuer.String()
+			r.recordCertificate(ctx, log, ar, cr, issuer.TemplateFor(ar), c)
+		}
+		if len(deviations) > 0 {
+			r.setCertificateRequestStatus(ctx, cr, cmmeta.ConditionTrue, cmapi.CertificateRequestReasonIssued, "ADCS request successfull, issued with deviations: %s", strings.Join(deviations, "; "))
+		} else {
+			r.setCertificateRequestStatus(ctx, cr, cmmeta.ConditionTrue, cmapi.CertificateRequestReasonIssued, "ADCS request successfull")
+		}
 	case api.Rejected:
 		// This is a little hack for strange cert-manager behavior in case of failed request. Cert-manager automatically
 		// re-tries such requests (re-created CertificateRequest object) what doesn't make sense in case of rejection.
 		// We keep the Reason 'Pending' to prevent from re-trying while the actual status is in the Status Condition's Message field.
 		// TODO: change it when cert-manager handles this better.
-		r.CertificateRequestController.SetStatus(ctx, &cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, "ADCS request rejected")
+		r.setCertificateRequestStatus(ctx, cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, "ADCS request rejected")
 	case api.Errored:
-		r.CertificateRequestController.SetStatus(ctx, &cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed, "ADCS request errored")
+		if backoff, ok := issuer.RetryErrored(ar); ok {
+			log.Info(fmt.Sprintf("Errored request will be re-submitted in %v", backoff), "attempts", ar.Status.Attempts)
+			r.setCertificateRequestStatus(ctx, cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, "ADCS request errored, re-submitting in %v", backoff)
+			resetForResubmit(ar, backoff, fmt.Sprintf("Re-submitting after transient error: %s", ar.Status.Reason))
+			r.auditTransition(ctx, log, ar, api.Errored)
+			r.Recorder.Event(ar, core.EventTypeNormal, "Resubmitting", ar.Status.Reason)
+			return ctrl.Result{Requeue: true, RequeueAfter: backoff}, r.Client.Status().Update(ctx, ar)
+		}
+		r.setCertificateRequestStatus(ctx, cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed, "ADCS request errored")
+	}
+	ar.Status.NextPollAt = nil
+	retry := r.notify(ctx, log, issuer, ar)
+	if err := r.setStatus(ctx, ar); err != nil {
+		return ctrl.Result{}, err
+	}
+	if ar.Status.State == api.Ready && issuer.Revoker != nil && !hasFinalizer(ar, api.RevokeFinalizer) {
+		// Revoke the certificate when the request is deleted.
+		ar.Finalizers = append(ar.Finalizers, api.RevokeFinalizer)
+		if err := r.Client.Update(ctx, ar); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
-	r.setStatus(ctx, ar)
+	if ar.Status.State == api.Ready {
+		if err := r.writeOutputSecret(ctx, log, ar); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{RequeueAfter: retry}, nil
+}
+
+// Notify the issuer's notifiers of the request's state. The deliveries are kept in the
+// request's status, which the caller stores. Returns the time until the next delivery retry, zero if none.
+func (r *AdcsRequestReconciler) notify(ctx context.Context, log logr.Logger, issuer *issuers.Issuer, ar *api.AdcsRequest) time.Duration {
+	notification := requestNotification(ar, issuer.TemplateFor(ar))
+	if notification == nil || len(issuer.Notifiers) == 0 {
+		return 0
+	}
+	return dispatchNotifications(ctx, log, issuer.Notifiers, &ar.Status.Notifications, notification)
+}
+
+// Make a new request poll the existing ADCS request with the given ID instead of submitting the CSR.
+// Requests already sent to ADCS, or re-submitted, aren't adopted again.
+// An error is returned if the ID isn't an ADCS request ID.
+func adoptRequest(ar *api.AdcsRequest, id string) (bool, error) {
+	if ar.Status.State != api.Unknown || ar.Status.Adopted || len(ar.Status.History) > 0 {
+		return false, nil
+	}
+	if n, err := strconv.ParseUint(id, 10, 32); err != nil || n == 0 {
+		return false, fmt.Errorf("Invalid ADCS request ID %q in the %s annotation", id, api.AdoptRequestIdAnnotation)
+	}
+	now := metav1.Now()
+	ar.Status.Id = id
+	ar.Status.Adopted = true
+	ar.Status.State = api.Pending
+	ar.Status.PendingSince = &now
+	ar.Status.Reason = "Adopted existing ADCS request"
+	return true, nil
+}
+
+// Move the current ADCS request to the history and reset the status so that
+// a new ADCS request is submitted after the given time.
+func resetForResubmit(ar *api.AdcsRequest, after time.Duration, reason string) {
+	now := metav1.Now()
+	ar.Status.History = append(ar.Status.History, api.AdcsRequestAttempt{
+		Id:     ar.Status.Id,
+		State:  ar.Status.State,
+		Reason: ar.Status.Reason,
+		Time:   &now,
+	})
+	nextPollAt := metav1.NewTime(now.Add(after))
+	ar.Status.State = api.Unknown
+	ar.Status.Id = ""
+	ar.Status.Reason = reason
+	ar.Status.PendingSince = nil
+	ar.Status.Polls = 0
+	ar.Status.NextPollAt = &nextPollAt
+}
 
-	return ctrl.Result{}, nil
+// Perform the action requested with the action annotation, record it in the status
+// and remove the annotation so it's done only once.
+func (r *AdcsRequestReconciler) performAction(ctx context.Context, ar *api.AdcsRequest, key client.ObjectKey, action string) error {
+	triggeredBy := ar.Annotations[api.ActionByAnnotation]
+	log := r.Log.WithValues("adcsrequest", key, "action", action, "triggeredBy", triggeredBy)
+	previousState := ar.Status.State
+
+	var message string
+	switch action {
+	case api.ActionPoll:
+		switch {
+		case ar.Status.State == api.Unknown:
+			ar.Status.NextPollAt = nil
+			message = "Submission to ADCS scheduled now"
+		case ar.Status.State == api.Ready || ar.Status.State == api.Abandoned:
+			message = fmt.Sprintf("Request is %s, nothing to check", ar.Status.State)
+		case ar.Status.Id == "":
+			message = "Request has no ADCS ID to check"
+		default:
+			if ar.Status.State != api.Pending {
+				// Re-check a final request e.g. one fixed by the CA admin.
+				now := metav1.Now()
+				ar.Status.PendingSince = &now
+				ar.Status.State = api.Pending
+			}
+			ar.Status.NextPollAt = nil
+			message = "Status check scheduled now"
+		}
+	case api.ActionResubmit:
+		if ar.Status.State == api.Ready {
+			message = "Certificate already issued, not re-submitted"
+			break
+		}
+		if ar.Status.State == api.Denied {
+			message = "Approval denied, not re-submitted"
+			break
+		}
+		resetForResubmit(ar, 0, fmt.Sprintf("Re-submitted by %s", triggeredBy))
+		message = "New ADCS request scheduled now"
+	case api.ActionAbandon:
+		if ar.Status.State == api.Ready || ar.Status.State == api.Abandoned {
+			message = fmt.Sprintf("Request is %s, not abandoned", ar.Status.State)
+			break
+		}
+		ar.Status.State = api.Abandoned
+		ar.Status.Reason = fmt.Sprintf("Abandoned by %s", triggeredBy)
+		ar.Status.NextPollAt = nil
+		message = "Request abandoned"
+		cr, err := r.certificateRequest(ctx, ar)
+		if err == nil {
+			err = r.setCertificateRequestStatus(ctx, cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed, "ADCS request abandoned by %s", triggeredBy)
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		message = fmt.Sprintf("Unknown action %q", action)
+	}
+	log.Info(message)
+	r.auditTransition(ctx, log, ar, previousState)
+
+	now := metav1.Now()
+	ar.Status.LastAction = &api.AdcsRequestAction{
+		Action:      action,
+		TriggeredBy: triggeredBy,
+		Time:        &now,
+		Message:     message,
+	}
+	r.Recorder.Event(ar, core.EventTypeNormal, "Action", fmt.Sprintf("%s requested by %s: %s", action, triggeredBy, message))
+	if err := r.Client.Status().Update(ctx, ar); err != nil {
+		return err
+	}
+
+	delete(ar.Annotations, api.ActionAnnotation)
+	delete(ar.Annotations, api.ActionByAnnotation)
+	return r.Client.Update(ctx, ar)
+}
+
+// Give up on a request that has been pending too long.
+// Failing the CertificateRequest lets cert-manager retry with a new one.
+func (r *AdcsRequestReconciler) expire(ctx context.Context, ar *api.AdcsRequest, key client.ObjectKey, maxPendingDuration time.Duration) error {
+	previousState := ar.Status.State
+	ar.Status.State = api.Expired
+	ar.Status.Reason = fmt.Sprintf("Request %s not issued within %v", ar.Status.Id, maxPendingDuration)
+	ar.Status.NextPollAt = nil
+
+	cr, err := r.certificateRequest(ctx, ar)
+	if err != nil {
+		return err
+	}
+	if err := r.setCertificateRequestStatus(ctx, cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed, "ADCS request expired: %s", ar.Status.Reason); err != nil {
+		return err
+	}
+	r.auditTransition(ctx, r.Log.WithValues("adcsrequest", key), ar, previousState)
+	return r.setStatus(ctx, ar)
 }
 
 func (r *AdcsRequestReconciler) setStatus(ctx context.Context, ar *api.AdcsRequest) error {
 
 	// Fire an Event to additionally inform users of the change
 	eventType := core.EventTypeNormal
-	if ar.Status.State == api.Errored || ar.Status.State == api.Rejected {
+	if ar.Status.State == api.Errored || ar.Status.State == api.Rejected || ar.Status.State == api.Expired || ar.Status.State == api.Denied {
 		eventType = core.EventTypeWarning
 	}
 	r.Recorder.Event(ar, eventType, string(ar.Status.State), ar.Status.Reason)
@@ -118,5 +439,6 @@ func (r *AdcsRequestReconciler) setStatus(ctx context.Context, ar *api.AdcsReque
 func (r *AdcsRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&api.AdcsRequest{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cmapi "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+func TestExpirePendingRequest(t *testing.T) {
+	ctx := context.Background()
+	cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "request", UID: "cr-uid"}}
+	pendingSince := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+	nextPollAt := metav1.NewTime(time.Now().Add(time.Hour))
+	ar := &api.AdcsRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "team",
+			Name:            "request",
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(cr, cmapi.SchemeGroupVersion.WithKind(cmapi.CertificateRequestKind))},
+		},
+		Status: api.AdcsRequestStatus{State: api.Pending, Id: "42", PendingSince: &pendingSince, NextPollAt: &nextPollAt},
+	}
+	c := newFakeClient(t, cr, ar)
+	recorder := record.NewFakeRecorder(10)
+	r := &AdcsRequestReconciler{
+		Client:                       c,
+		Log:                          logf.NullLogger{},
+		Recorder:                     recorder,
+		CertificateRequestController: &CertificateRequestReconciler{Client: c, Log: logf.NullLogger{}, Recorder: recorder},
+	}
+	key := client.ObjectKey{Namespace: "team", Name: "request"}
+
+	require.NoError(t, r.expire(ctx, ar, key, time.Hour))
+	require.NoError(t, c.Get(ctx, key, ar))
+	assert.Equal(t, api.Expired, ar.Status.State)
+	assert.Equal(t, "Request 42 not issued within 1h0m0s", ar.Status.Reason)
+	assert.Nil(t, ar.Status.NextPollAt)
+
+	// The CertificateRequest fails so cert-manager re-tries with a new one.
+	require.NoError(t, c.Get(ctx, key, cr))
+	if assert.Len(t, cr.Status.Conditions, 1) {
+		assert.Equal(t, cmmeta.ConditionFalse, cr.Status.Conditions[0].Status)
+		assert.Equal(t, cmapi.CertificateRequestReasonFailed, cr.Status.Conditions[0].Reason)
+	}
+	assert.Len(t, recorder.Events, 2)
+}
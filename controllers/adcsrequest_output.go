@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	cmapi "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=create
+
+// Get the CertificateRequest the request was created for. Nil for a standalone request,
+// created without one, or if the CertificateRequest is gone.
+func (r *AdcsRequestReconciler) certificateRequest(ctx context.Context, ar *api.AdcsRequest) (*cmapi.CertificateRequest, error) {
+	owner := metav1.GetControllerOf(ar)
+	if owner == nil || owner.Kind != cmapi.CertificateRequestKind {
+		return nil, nil
+	}
+	cr, err := r.CertificateRequestController.GetCertificateRequest(ctx, client.ObjectKey{Namespace: ar.Namespace, Name: owner.Name})
+	if err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	if cr.UID != owner.UID {
+		// A new CertificateRequest with the same name.
+		return nil, nil
+	}
+	return &cr, nil
+}
+
+// Set the Ready condition of the request's CertificateRequest, if there is one.
+func (r *AdcsRequestReconciler) setCertificateRequestStatus(ctx context.Context, cr *cmapi.CertificateRequest, status cmmeta.ConditionStatus, reason, message string, args ...interface{}) error {
+	if cr == nil {
+		return nil
+	}
+	return r.CertificateRequestController.SetStatus(ctx, cr, status, reason, message, args...)
+}
+
+// Store the certificate of a standalone request, kept in its status, in the output Secret if one is set.
+// The Secret is created owned by the request. An existing one is updated only if it's owned
+// by the request or annotated for it, so the request can't overwrite any Secret.
+func (r *AdcsRequestReconciler) writeOutputSecret(ctx context.Context, log logr.Logger, ar *api.AdcsRequest) error {
+	ref := ar.Spec.OutputSecretRef
+	if ref == nil || len(ar.Status.Certificate) == 0 {
+		return nil
+	}
+	log = log.WithValues("secret", ref.Name)
+
+	secret := new(core.Secret)
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: ar.Namespace, Name: ref.Name}, secret)
+	if apierrors.IsNotFound(err) {
+		secret = &core.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            ref.Name,
+				Namespace:       ar.Namespace,
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(ar, api.GroupVersion.WithKind("AdcsRequest"))},
+			},
+			Type: core.SecretTypeOpaque,
+			Data: map[string][]byte{
+				core.TLSCertKey: ar.Status.Certificate,
+				cmmeta.TLSCAKey: ar.Status.CA,
+			},
+		}
+		log.Info("Creating output Secret")
+		return r.Client.Create(ctx, secret)
+	}
+	if err != nil {
+		return err
+	}
+
+	if owner := metav1.GetControllerOf(secret); (owner == nil || owner.UID != ar.UID) && secret.Annotations[api.OutputSecretForAnnotation] != ar.Name {
+		err := fmt.Errorf("Secret %s is not owned by the request nor annotated with %s=%s", ref.Name, api.OutputSecretForAnnotation, ar.Name)
+		r.Recorder.Event(ar, core.EventTypeWarning, "OutputSecretFailed", err.Error())
+		return err
+	}
+	if bytes.Equal(secret.Data[core.TLSCertKey], ar.Status.Certificate) && bytes.Equal(secret.Data[cmmeta.TLSCAKey], ar.Status.CA) {
+		return nil
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[core.TLSCertKey] = ar.Status.Certificate
+	secret.Data[cmmeta.TLSCAKey] = ar.Status.CA
+	log.Info("Updating output Secret")
+	return r.Client.Update(ctx, secret)
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+func testStandaloneRequest() *api.AdcsRequest {
+	return &api.AdcsRequest{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "request", UID: "request-uid"},
+		Spec:       api.AdcsRequestSpec{OutputSecretRef: &api.LocalObjectReference{Name: "output"}},
+		Status: api.AdcsRequestStatus{
+			State:       api.Ready,
+			Certificate: []byte("certificate"),
+			CA:          []byte("ca"),
+		},
+	}
+}
+
+func newOutputReconciler(t *testing.T, objs ...runtime.Object) (*AdcsRequestReconciler, *record.FakeRecorder) {
+	recorder := record.NewFakeRecorder(10)
+	return &AdcsRequestReconciler{Client: newFakeClient(t, objs...), Recorder: recorder}, recorder
+}
+
+func TestWriteOutputSecret(t *testing.T) {
+	ctx := context.Background()
+	ar := testStandaloneRequest()
+	r, _ := newOutputReconciler(t, ar)
+	key := client.ObjectKey{Namespace: "team", Name: "output"}
+
+	require.NoError(t, r.writeOutputSecret(ctx, logf.NullLogger{}, ar))
+	secret := new(core.Secret)
+	require.NoError(t, r.Client.Get(ctx, key, secret))
+	assert.True(t, metav1.IsControlledBy(secret, ar))
+	assert.Equal(t, []byte("certificate"), secret.Data[core.TLSCertKey])
+	assert.Equal(t, []byte("ca"), secret.Data[cmmeta.TLSCAKey])
+
+	// Updated with the next certificate.
+	ar.Status.Certificate = []byte("renewed")
+	require.NoError(t, r.writeOutputSecret(ctx, logf.NullLogger{}, ar))
+	require.NoError(t, r.Client.Get(ctx, key, secret))
+	assert.Equal(t, []byte("renewed"), secret.Data[core.TLSCertKey])
+}
+
+func TestWriteOutputSecretAnnotated(t *testing.T) {
+	ctx := context.Background()
+	ar := testStandaloneRequest()
+	existing := testSecret("team", "output")
+	existing.Annotations = map[string]string{api.OutputSecretForAnnotation: "request"}
+	existing.Data = map[string][]byte{"other": []byte("kept")}
+	r, _ := newOutputReconciler(t, ar, existing)
+
+	require.NoError(t, r.writeOutputSecret(ctx, logf.NullLogger{}, ar))
+	secret := new(core.Secret)
+	require.NoError(t, r.Client.Get(ctx, client.ObjectKey{Namespace: "team", Name: "output"}, secret))
+	assert.Equal(t, []byte("certificate"), secret.Data[core.TLSCertKey])
+	assert.Equal(t, []byte("kept"), secret.Data["other"])
+}
+
+func TestWriteOutputSecretOwnedByOthers(t *testing.T) {
+	ctx := context.Background()
+	ar := testStandaloneRequest()
+	other := testStandaloneRequest()
+	other.Name = "other"
+	other.UID = "other-uid"
+
+	notOwned := testSecret("team", "output")
+	notOwned.Data = map[string][]byte{core.TLSCertKey: []byte("foreign")}
+	ownedByOther := notOwned.DeepCopy()
+	ownedByOther.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(other, api.GroupVersion.WithKind("AdcsRequest"))}
+	annotatedForOther := notOwned.DeepCopy()
+	annotatedForOther.Annotations = map[string]string{api.OutputSecretForAnnotation: "other"}
+
+	for _, existing := range []*core.Secret{notOwned, ownedByOther, annotatedForOther} {
+		r, recorder := newOutputReconciler(t, ar, existing)
+		assert.Error(t, r.writeOutputSecret(ctx, logf.NullLogger{}, ar))
+		secret := new(core.Secret)
+		require.NoError(t, r.Client.Get(ctx, client.ObjectKey{Namespace: "team", Name: "output"}, secret))
+		assert.Equal(t, []byte("foreign"), secret.Data[core.TLSCertKey])
+		if assert.Len(t, recorder.Events, 1) {
+			assert.Contains(t, <-recorder.Events, "OutputSecretFailed")
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	cmapi "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
+	"github.com/jetstack/cert-manager/pkg/util/pki"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/chojnack/adcs-issuer/adcs"
+	api "github.com/chojnack/adcs-issuer/api/v1"
+	"github.com/chojnack/adcs-issuer/audit"
+	"github.com/chojnack/adcs-issuer/issuers"
+)
+
+// Revoke the certificate of the deleted request, unless it's still in use, and remove
+// the finalizer. A failed revocation keeps the request and is re-tried.
+func (r *AdcsRequestReconciler) finalize(ctx context.Context, log logr.Logger, ar *api.AdcsRequest) error {
+	if !hasFinalizer(ar, api.RevokeFinalizer) {
+		return nil
+	}
+	if ar.Status.Revoked == nil && ar.Status.SerialNumber != "" {
+		if err := r.revoke(ctx, log, ar); err != nil {
+			r.Recorder.Event(ar, core.EventTypeWarning, "RevocationFailed", err.Error())
+			return err
+		}
+	}
+	removeFinalizer(ar, api.RevokeFinalizer)
+	return r.Client.Update(ctx, ar)
+}
+
+func (r *AdcsRequestReconciler) revoke(ctx context.Context, log logr.Logger, ar *api.AdcsRequest) error {
+	log = log.WithValues("serialNumber", ar.Status.SerialNumber)
+	issuer, err := r.IssuerFactory.GetIssuer(ctx, ar.Spec.IssuerRef, ar.Namespace)
+	if apierrors.IsNotFound(err) {
+		// E.g. the issuer or its Secrets deleted before it had the finalizer keeping them.
+		log.Error(err, "Cannot revoke certificate, issuer not available")
+		r.Recorder.Event(ar, core.EventTypeWarning, "RevocationSkipped",
+			fmt.Sprintf("Certificate %s not revoked, issuer not available: %v", ar.Status.SerialNumber, err))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if issuer.Revoker == nil {
+		log.Info("Revocation disabled for the issuer, certificate not revoked")
+		return nil
+	}
+	inUse, err := r.certificateInUse(ctx, ar)
+	if err != nil {
+		return err
+	}
+	if inUse != "" {
+		log.Info("Certificate not revoked, still used by Certificate", "certificate", inUse)
+		return nil
+	}
+
+	if err := issuer.Revoker.RevokeCertificate(adcs.NewContext(ctx, log), ar.Status.CertificateIssuer, ar.Status.SerialNumber, issuer.RevocationReason); err != nil {
+		return err
+	}
+	now := metav1.Now()
+	ar.Status.Revoked = &now
+	message := fmt.Sprintf("Certificate %s revoked: %s", ar.Status.SerialNumber, issuer.RevocationReason)
+	log.Info(message)
+	r.Recorder.Event(ar, core.EventTypeNormal, "Revoked", message)
+	r.auditRevocation(ctx, log, issuer, ar)
+	r.markRecordRevoked(ctx, log, ar, issuer.RevocationReason)
+	// Kept in case the finalizer can't be removed, so it isn't revoked again.
+	return r.Client.Status().Update(ctx, ar)
+}
+
+// Returns the name of a Certificate in the request's namespace, not being deleted,
+// whose Secret holds the request's certificate. Empty if there is none.
+func (r *AdcsRequestReconciler) certificateInUse(ctx context.Context, ar *api.AdcsRequest) (string, error) {
+	certificates := new(cmapi.CertificateList)
+	if err := r.Client.List(ctx, certificates, client.InNamespace(ar.Namespace)); err != nil {
+		return "", err
+	}
+	for _, crt := range certificates.Items {
+		if crt.DeletionTimestamp != nil {
+			continue
+		}
+		secret := new(core.Secret)
+		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: crt.Namespace, Name: crt.Spec.SecretName}, secret); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return "", err
+			}
+			continue
+		}
+		cert, err := pki.DecodeX509CertificateBytes(secret.Data[core.TLSCertKey])
+		if err != nil {
+			continue
+		}
+		if fmt.Sprintf("%x", cert.SerialNumber) == ar.Status.SerialNumber && cert.Issuer.String() == ar.Status.CertificateIssuer {
+			return crt.Name, nil
+		}
+	}
+	return "", nil
+}
+
+func (r *AdcsRequestReconciler) auditRevocation(ctx context.Context, log logr.Logger, issuer *issuers.Issuer, ar *api.AdcsRequest) {
+	if r.Auditor == nil {
+		return
+	}
+	record := r.newAuditRecord(audit.EventRevoked, ar, nil)
+	record.URL = issuer.URL
+	record.Reason = issuer.RevocationReason.String()
+	record.Certificate = &audit.Certificate{SerialNumber: ar.Status.SerialNumber}
+	r.writeAudit(ctx, log, record)
+}
+
+// Mark the certificate revoked in the inventory.
+func (r *AdcsRequestReconciler) markRecordRevoked(ctx context.Context, log logr.Logger, ar *api.AdcsRequest, reason adcs.RevocationReason) {
+	record := new(api.AdcsCertificateRecord)
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: certificateRecordName(ar.Status.CertificateIssuer, ar.Status.SerialNumber)}, record); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Cannot mark certificate record revoked")
+		}
+		return
+	}
+	if record.Spec.Issuer != ar.Status.CertificateIssuer || record.Spec.SerialNumber != ar.Status.SerialNumber ||
+		record.Spec.Request != (api.RecordObjectReference{Namespace: ar.Namespace, Name: ar.Name}) {
+		log.Error(fmt.Errorf("record %s is not of the request's certificate", record.Name), "Cannot mark certificate record revoked")
+		return
+	}
+	record.Spec.Revoked = ar.Status.Revoked
+	record.Spec.RevocationReason = api.RevocationReason(reason.String())
+	if err := r.Client.Update(ctx, record); err != nil {
+		log.Error(err, "Cannot mark certificate record revoked")
+	}
+}
+
+func hasFinalizer(obj metav1.Object, finalizer string) bool {
+	for _, f := range obj.GetFinalizers() {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+func removeFinalizer(obj metav1.Object, finalizer string) {
+	var finalizers []string
+	for _, f := range obj.GetFinalizers() {
+		if f != finalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	obj.SetFinalizers(finalizers)
+}
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	cmapi "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/chojnack/adcs-issuer/adcs"
+	api "github.com/chojnack/adcs-issuer/api/v1"
+	"github.com/chojnack/adcs-issuer/issuers"
+	"github.com/jetstack/cert-manager/pkg/util/pki"
+)
+
+const (
+	// How long to wait before re-checking an issuer that couldn't be set up.
+	issuerRetryInterval = time.Minute
+)
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=update;patch
+
+// caRenewalSync keeps the CA renewals in the status of AdcsIssuers and ClusterAdcsIssuers.
+type caRenewalSync struct {
+	client.Client
+	Recorder      record.EventRecorder
+	IssuerFactory issuers.IssuerFactory
+}
+
+// Fetch the CA certificates of all the ADCS CA renewals and the CA chain into the issuer's status.
+// A new renewal is reported with an event and metric and, if the issuer has 'reissueBeforeCAExpiry' set,
+// certificates signed by an expiring CA certificate are re-issued. The issuer's notifiers are told about
+// the CA certificates expiring within their thresholds.
+// The status is updated in the issuer object (obj) but not stored.
+func (s *caRenewalSync) sync(ctx context.Context, log logr.Logger, obj runtime.Object, ref cmmeta.ObjectReference, namespace string, status *api.AdcsIssuerStatus) ctrl.Result {
+	issuer, err := s.IssuerFactory.GetIssuer(ctx, ref, namespace)
+	if err != nil {
+		log.Error(err, "Cannot set up issuer")
+		setIssuerCondition(status, api.IssuerConditionReady, cmmeta.ConditionFalse, "Invalid", err.Error())
+		return ctrl.Result{RequeueAfter: issuerRetryInterval}
+	}
+	cas, err := issuer.GetCaCertificates(adcs.NewContext(ctx, log))
+	if err != nil {
+		log.Error(err, "Cannot get CA certificates")
+		setIssuerCondition(status, api.IssuerConditionReady, cmmeta.ConditionFalse, "CAUnavailable", err.Error())
+		return ctrl.Result{RequeueAfter: issuer.RetryInterval}
+	}
+	chain, err := issuer.GetCaCertificateChain(adcs.NewContext(ctx, log))
+	if err != nil {
+		log.Error(err, "Cannot get CA chain")
+		setIssuerCondition(status, api.IssuerConditionReady, cmmeta.ConditionFalse, "CAUnavailable", err.Error())
+		return ctrl.Result{RequeueAfter: issuer.RetryInterval}
+	}
+	now := metav1.Now()
+	status.LastCACheck = &now
+
+	if len(status.CACertificates) > 0 {
+		// Don't report the renewals found on the first check.
+		for _, ca := range cas {
+			if !hasCACertificate(status.CACertificates, ca) {
+				message := fmt.Sprintf("New CA renewal %d: %s, serial %s, valid until %s", ca.Renewal, ca.Subject, ca.SerialNumber, ca.NotAfter.UTC().Format(time.RFC3339))
+				log.Info(message)
+				s.Recorder.Event(obj, core.EventTypeNormal, "CARenewal", message)
+				caRenewalsTotal.WithLabelValues(ref.Kind, namespace, ref.Name).Inc()
+			}
+		}
+	}
+	status.CACertificates = cas
+	status.CAChain = chain
+	setIssuerCondition(status, api.IssuerConditionReady, cmmeta.ConditionTrue, "Verified", fmt.Sprintf("%d CA certificate(s) fetched from ADCS", len(cas)))
+	requeue := issuer.CACheckInterval
+	if len(issuer.Notifiers) > 0 {
+		retry := dispatchNotifications(ctx, log, issuer.Notifiers, &status.Notifications, caNotifications(ref, namespace, cas)...)
+		requeue = minRequeue(requeue, retry)
+	}
+
+	if issuer.ReissueBeforeCAExpiry > 0 {
+		if err := s.reissue(ctx, log, ref, namespace, cas, issuer.ReissueBeforeCAExpiry); err != nil {
+			log.Error(err, "Cannot re-issue certificates")
+			return ctrl.Result{RequeueAfter: issuer.RetryInterval}
+		}
+	}
+	return ctrl.Result{RequeueAfter: requeue}
+}
+
+func hasCACertificate(cas []api.CACertificate, ca api.CACertificate) bool {
+	for _, known := range cas {
+		if known.SerialNumber == ca.SerialNumber && known.Subject == ca.Subject {
+			return true
+		}
+	}
+	return false
+}
+
+// Re-issue the issuer's certificates signed by a CA certificate that expires within 'before'
+// once a newer renewal that is valid longer exists.
+// The re-issuance is triggered by removing cert-manager's issuer name annotation from the certificate's Secret,
+// which makes cert-manager issue a new certificate for the existing key.
+func (s *caRenewalSync) reissue(ctx context.Context, log logr.Logger, ref cmmeta.ObjectReference, namespace string, cas []api.CACertificate, before time.Duration) error {
+	if len(cas) < 2 {
+		return nil
+	}
+	newest := cas[len(cas)-1]
+	deadline := time.Now().Add(before)
+	var expiring []api.CACertificate
+	for _, ca := range cas[:len(cas)-1] {
+		if ca.NotAfter.Time.Before(deadline) && ca.NotAfter.Time.Before(newest.NotAfter.Time) {
+			expiring = append(expiring, ca)
+		}
+	}
+	if len(expiring) == 0 {
+		return nil
+	}
+
+	certificates := new(cmapi.CertificateList)
+	if err := s.Client.List(ctx, certificates, client.InNamespace(namespace)); err != nil {
+		return err
+	}
+	for idx := range certificates.Items {
+		crt := &certificates.Items[idx]
+		if crt.Spec.IssuerRef.Group != api.GroupVersion.Group || crt.Spec.IssuerRef.Kind != ref.Kind || crt.Spec.IssuerRef.Name != ref.Name {
+			continue
+		}
+		secret := new(core.Secret)
+		if err := s.Client.Get(ctx, client.ObjectKey{Namespace: crt.Namespace, Name: crt.Spec.SecretName}, secret); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			continue
+		}
+		if secret.Annotations[cmapi.IssuerNameAnnotationKey] != crt.Spec.IssuerRef.Name {
+			// Re-issuance already triggered
+			continue
+		}
+		cert, err := pki.DecodeX509CertificateBytes(secret.Data[core.TLSCertKey])
+		if err != nil {
+			continue
+		}
+		for _, ca := range expiring {
+			caCert, err := pki.DecodeX509CertificateBytes(ca.Certificate)
+			if err != nil || !adcs.IssuedBy(cert, caCert) {
+				continue
+			}
+			message := fmt.Sprintf("Re-issuing certificate signed by CA renewal %d expiring at %s", ca.Renewal, ca.NotAfter.UTC().Format(time.RFC3339))
+			log.Info(message, "certificate", client.ObjectKey{Namespace: crt.Namespace, Name: crt.Name})
+			delete(secret.Annotations, cmapi.IssuerNameAnnotationKey)
+			if err := s.Client.Update(ctx, secret); err != nil {
+				return err
+			}
+			s.Recorder.Event(crt, core.EventTypeNormal, "CARenewal", message)
+			reissuedCertificatesTotal.WithLabelValues(ref.Kind, namespace, ref.Name).Inc()
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cmapi "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/chojnack/adcs-issuer/adcs"
+	api "github.com/chojnack/adcs-issuer/api/v1"
+	"github.com/chojnack/adcs-issuer/issuers"
+)
+
+// fakeCertsrv serves the CA renewals.
+type fakeCertsrv struct {
+	adcs.AdcsCertsrv
+	cas []string
+	err error
+}
+
+func (f *fakeCertsrv) GetCaCertificates(ctx context.Context) ([]string, error) {
+	return f.cas, f.err
+}
+
+func (f *fakeCertsrv) GetCaCertificateChain(ctx context.Context) (string, error) {
+	if len(f.cas) == 0 {
+		return "", f.err
+	}
+	return f.cas[len(f.cas)-1], f.err
+}
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// Create a certificate expiring at notAfter signed by the parent, a self-signed CA if the parent is nil.
+func newTestCertificate(t *testing.T, name string, notAfter time.Time, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	signer := &testCertificate{cert: template, key: key}
+	if parent != nil {
+		signer = parent
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer.cert, &key.PublicKey, signer.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCertificate{cert: cert, key: key}
+}
+
+func (c *testCertificate) pem() []byte {
+	return adcs.EncodeCertificatesPem([]*x509.Certificate{c.cert})
+}
+
+func testRenewalIssuer(reissueBefore string, notifiers ...api.Notifier) *api.AdcsIssuer {
+	return &api.AdcsIssuer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "adcs", UID: "uid-adcs"},
+		Spec: api.AdcsIssuerSpec{
+			URL:                   "https://adcs.example.com/certsrv",
+			CredentialsRef:        api.LocalObjectReference{Name: "adcs-credentials"},
+			ReissueBeforeCAExpiry: reissueBefore,
+			Notifiers:             notifiers,
+		},
+	}
+}
+
+// A fake client with the issuer and its credentials, and a factory making the issuer talk to certServ.
+func newTestIssuerFactory(t *testing.T, issuer *api.AdcsIssuer, certServ adcs.AdcsCertsrv, objs ...runtime.Object) (client.Client, issuers.IssuerFactory) {
+	credentials := testSecret("team", "adcs-credentials")
+	credentials.Data = map[string][]byte{"username": []byte("user"), "password": []byte("password")}
+	c := newFakeClient(t, append(objs, issuer, credentials)...)
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Namespace: "team", Name: "adcs-credentials"}, credentials))
+	cache := issuers.NewCertsrvCache(1)
+	cache.Add(issuer.UID, issuer.Generation, credentials.ResourceVersion, certServ)
+	return c, issuers.IssuerFactory{
+		Client:       c,
+		Log:          logf.NullLogger{},
+		CertsrvCache: cache,
+	}
+}
+
+// The renewal sync of the issuer, which gets its CA certificates from certServ.
+func newRenewalSync(t *testing.T, issuer *api.AdcsIssuer, certServ adcs.AdcsCertsrv, objs ...runtime.Object) (*caRenewalSync, *record.FakeRecorder) {
+	c, factory := newTestIssuerFactory(t, issuer, certServ, objs...)
+	recorder := record.NewFakeRecorder(10)
+	return &caRenewalSync{
+		Client:        c,
+		Recorder:      recorder,
+		IssuerFactory: factory,
+	}, recorder
+}
+
+func TestCARenewalSyncDetectsRenewals(t *testing.T) {
+	ctx := context.Background()
+	var delivered int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&delivered, 1)
+	}))
+	defer server.Close()
+
+	issuer := testRenewalIssuer("", api.Notifier{Name: "ops", URL: server.URL, Events: []api.NotificationEvent{api.NotificationEvent("CAExpiring")}})
+	expiring := newTestCertificate(t, "Test CA", time.Now().Add(10*24*time.Hour), nil)
+	renewed := newTestCertificate(t, "Test CA", time.Now().Add(5*365*24*time.Hour), nil)
+	certServ := &fakeCertsrv{cas: []string{string(expiring.pem())}}
+	s, recorder := newRenewalSync(t, issuer, certServ)
+	ref := cmmeta.ObjectReference{Kind: "AdcsIssuer", Name: "adcs"}
+	renewals := caRenewalsTotal.WithLabelValues("AdcsIssuer", "team", "adcs")
+	initial := testutil.ToFloat64(renewals)
+	status := &issuer.Status
+
+	// The renewals found on the first check aren't reported, the expiring CA is notified once.
+	result := s.sync(ctx, logf.NullLogger{}, issuer, ref, "team", status)
+	assert.NotZero(t, result.RequeueAfter)
+	assert.Len(t, status.CACertificates, 1)
+	assert.Equal(t, expiring.pem(), status.CAChain)
+	assert.NotNil(t, status.LastCACheck)
+	assert.Empty(t, recorder.Events)
+	assert.Equal(t, initial, testutil.ToFloat64(renewals))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&delivered))
+	if assert.Len(t, status.Notifications, 1) {
+		assert.Equal(t, api.NotificationDelivered, status.Notifications[0].State)
+	}
+
+	// A new renewal is reported.
+	certServ.cas = append(certServ.cas, string(renewed.pem()))
+	s.sync(ctx, logf.NullLogger{}, issuer, ref, "team", status)
+	assert.Len(t, status.CACertificates, 2)
+	assert.Equal(t, renewed.pem(), status.CAChain)
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Contains(t, <-recorder.Events, "New CA renewal 1")
+	}
+	assert.Equal(t, initial+1, testutil.ToFloat64(renewals))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&delivered))
+
+	// The status is kept when ADCS can't be reached.
+	certServ.err = errors.New("connection refused")
+	s.sync(ctx, logf.NullLogger{}, issuer, ref, "team", status)
+	assert.Len(t, status.CACertificates, 2)
+	if assert.Len(t, status.Conditions, 1) {
+		assert.Equal(t, "CAUnavailable", status.Conditions[0].Reason)
+	}
+}
+
+func TestCARenewalSyncReissue(t *testing.T) {
+	ctx := context.Background()
+	expiring := newTestCertificate(t, "Test CA", time.Now().Add(10*24*time.Hour), nil)
+	renewed := newTestCertificate(t, "Test CA", time.Now().Add(5*365*24*time.Hour), nil)
+
+	var objs []runtime.Object
+	testCertificateSecret := func(name, issuerName string, signer *testCertificate, issued bool) {
+		crt := &cmapi.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: name},
+			Spec: cmapi.CertificateSpec{
+				SecretName: name,
+				IssuerRef:  cmmeta.ObjectReference{Group: api.GroupVersion.Group, Kind: "AdcsIssuer", Name: issuerName},
+			},
+		}
+		secret := testSecret("team", name)
+		secret.Data = map[string][]byte{core.TLSCertKey: newTestCertificate(t, name, time.Now().Add(time.Hour), signer).pem()}
+		if issued {
+			secret.Annotations = map[string]string{cmapi.IssuerNameAnnotationKey: issuerName}
+		}
+		objs = append(objs, crt, secret)
+	}
+	testCertificateSecret("signed-by-expiring", "adcs", expiring, true)
+	testCertificateSecret("signed-by-renewed", "adcs", renewed, true)
+	testCertificateSecret("of-other-issuer", "other", expiring, true)
+	testCertificateSecret("being-reissued", "adcs", expiring, false)
+
+	issuer := testRenewalIssuer("720h")
+	s, recorder := newRenewalSync(t, issuer, &fakeCertsrv{cas: []string{string(expiring.pem()), string(renewed.pem())}}, objs...)
+	ref := cmmeta.ObjectReference{Kind: "AdcsIssuer", Name: "adcs"}
+	reissued := reissuedCertificatesTotal.WithLabelValues("AdcsIssuer", "team", "adcs")
+	initial := testutil.ToFloat64(reissued)
+	issued := func(name string) bool {
+		secret := new(core.Secret)
+		require.NoError(t, s.Client.Get(ctx, client.ObjectKey{Namespace: "team", Name: name}, secret))
+		_, ok := secret.Annotations[cmapi.IssuerNameAnnotationKey]
+		return ok
+	}
+
+	// Nothing to re-issue with a single renewal or no renewal expiring soon.
+	cas := []api.CACertificate{{Renewal: 0, NotAfter: metav1.NewTime(expiring.cert.NotAfter), Certificate: expiring.pem()}}
+	require.NoError(t, s.reissue(ctx, logf.NullLogger{}, ref, "team", cas, 720*time.Hour))
+	cas = append(cas, api.CACertificate{Renewal: 1, NotAfter: metav1.NewTime(renewed.cert.NotAfter), Certificate: renewed.pem()})
+	require.NoError(t, s.reissue(ctx, logf.NullLogger{}, ref, "team", cas, time.Hour))
+	assert.True(t, issued("signed-by-expiring"))
+	assert.Empty(t, recorder.Events)
+
+	// Only the issuer's certificates signed by the expiring CA are re-issued.
+	s.sync(ctx, logf.NullLogger{}, issuer, ref, "team", &issuer.Status)
+	assert.False(t, issued("signed-by-expiring"))
+	assert.True(t, issued("signed-by-renewed"))
+	assert.True(t, issued("of-other-issuer"))
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Contains(t, <-recorder.Events, "Re-issuing certificate signed by CA renewal 0")
+	}
+	assert.Equal(t, initial+1, testutil.ToFloat64(reissued))
+
+	// Not triggered again.
+	s.sync(ctx, logf.NullLogger{}, issuer, ref, "team", &issuer.Status)
+	assert.Empty(t, recorder.Events)
+	assert.Equal(t, initial+1, testutil.ToFloat64(reissued))
+}
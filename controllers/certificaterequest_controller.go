@@ -24,6 +24,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	api "github.com/chojnack/adcs-issuer/api/v1"
+	"github.com/chojnack/adcs-issuer/tracing"
 	cmapiutil "github.com/jetstack/cert-manager/pkg/api/util"
 	cmapi "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
 	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
@@ -46,10 +47,12 @@ var (
 
 // +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=events,verbs=patch
 
-func (r *CertificateRequestReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	ctx := context.Background()
+func (r *CertificateRequestReconciler) Reconcile(req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := tracing.StartReconcile(context.Background(), "CertificateRequestReconciler", req.NamespacedName)
+	defer func() { tracing.End(span, err) }()
 	log := r.Log.WithValues("certificaterequest", req.NamespacedName)
 
 	// your logic here
@@ -90,6 +93,12 @@ func (r *CertificateRequestReconciler) Reconcile(req ctrl.Request) (ctrl.Result,
 
 	if err == nil {
 		log.Info("AdcsRequest already exists")
+		if !metav1.IsControlledBy(adcsReq, &cr) {
+			// A standalone AdcsRequest, not ours to replace.
+			log.Info("AdcsRequest not created for this CertificateRequest")
+			r.SetStatus(ctx, &cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed, "AdcsRequest %s exists and doesn't belong to the CertificateRequest", adcsReq.Name)
+			return ctrl.Result{}, nil
+		}
 		// The ADCS Request already exists. If the CSR is different we delete it and create a new one
 		if !RequestDiffers(adcsReq, &cr) {
 			log.Info("No change in request")
@@ -115,20 +124,61 @@ func (r *CertificateRequestReconciler) Reconcile(req ctrl.Request) (ctrl.Result,
 }
 
 func (r *CertificateRequestReconciler) createAdcsRequest(ctx context.Context, cmRequest *cmapi.CertificateRequest) error {
+	template, err := r.getAnnotation(ctx, cmRequest, api.TemplateAnnotation, false)
+	if err != nil {
+		return err
+	}
+	// Passed on to the AdcsRequest controller which sets the status accordingly.
+	annotations := map[string]string{}
+	// Taken from the Certificate only for its first issuance, so a renewal doesn't adopt the old request.
+	adoptId, err := r.getAnnotation(ctx, cmRequest, api.AdoptRequestIdAnnotation, true)
+	if err != nil {
+		return err
+	}
+	if adoptId != "" {
+		annotations[api.AdoptRequestIdAnnotation] = adoptId
+	}
+	// The later reconciles of the AdcsRequest link their spans to this one.
+	if traceparent := tracing.Traceparent(ctx); traceparent != "" {
+		annotations[api.TraceContextAnnotation] = traceparent
+	}
 	spec := api.AdcsRequestSpec{
 		CSRPEM:    cmRequest.Spec.CSRPEM,
 		IssuerRef: cmRequest.Spec.IssuerRef,
+		Template:  template,
+		IsCA:      cmRequest.Spec.IsCA,
 	}
 	return r.Create(ctx, &api.AdcsRequest{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            cmRequest.Name,
 			Namespace:       cmRequest.Namespace,
+			Annotations:     annotations,
 			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(cmRequest, certificateRequestGvk)},
 		},
 		Spec: spec,
 	})
 }
 
+// Get the annotation from the CertificateRequest or, if not set there, from the Certificate owning it.
+// With firstIssuance set the Certificate's annotation is used only if it has never been issued.
+func (r *CertificateRequestReconciler) getAnnotation(ctx context.Context, cr *cmapi.CertificateRequest, key string, firstIssuance bool) (string, error) {
+	if value, ok := cr.Annotations[key]; ok {
+		return value, nil
+	}
+	owner := metav1.GetControllerOf(cr)
+	if owner == nil || owner.Kind != cmapi.CertificateKind {
+		return "", nil
+	}
+	cert := new(cmapi.Certificate)
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: cr.Namespace, Name: owner.Name}, cert); err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+	if firstIssuance && cert.Status.NotAfter != nil {
+		return "", nil
+	}
+	return cert.Annotations[key], nil
+}
+
 func (r *CertificateRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&cmapi.CertificateRequest{}).
@@ -19,16 +19,22 @@ import (
 	"context"
 
 	"github.com/go-logr/logr"
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	adcsv1 "github.com/chojnack/adcs-issuer/api/v1"
+	"github.com/chojnack/adcs-issuer/issuers"
 )
 
 // ClusterAdcsIssuerReconciler reconciles a ClusterAdcsIssuer object
 type ClusterAdcsIssuerReconciler struct {
 	client.Client
-	Log logr.Logger
+	Log           logr.Logger
+	Recorder      record.EventRecorder
+	IssuerFactory issuers.IssuerFactory
 }
 
 // +kubebuilder:rbac:groups=adcs.certmanager.csf.nokia.com,resources=clusteradcsissuers,verbs=get;list;watch;create;update;patch;delete
@@ -51,11 +57,21 @@ func (r *ClusterAdcsIssuerReconciler) Reconcile(req ctrl.Request) (ctrl.Result,
 	}
 	log.Info("Registered cluster issuer")
 
-	return ctrl.Result{}, nil
+	ref := cmmeta.ObjectReference{Kind: "ClusterAdcsIssuer", Name: issuer.Name}
+	spec := adcsv1.AdcsIssuerSpec(issuer.Spec)
+	finalizer := issuerFinalizer{Client: r.Client, ClusterResourceNamespace: r.IssuerFactory.ClusterResourceNamespace}
+	if deleted, result, err := finalizer.sync(ctx, log, issuer, ref, "", &spec); deleted || err != nil {
+		return result, err
+	}
+	sync := caRenewalSync{Client: r.Client, Recorder: r.Recorder, IssuerFactory: r.IssuerFactory}
+	result := sync.sync(ctx, log, issuer, ref, "", (*adcsv1.AdcsIssuerStatus)(&issuer.Status))
+	return result, r.Client.Status().Update(ctx, issuer)
 }
 
 func (r *ClusterAdcsIssuerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&adcsv1.ClusterAdcsIssuer{}).
+		// Status updates don't need a reconcile, the CA is checked periodically.
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
 		Complete(r)
 }
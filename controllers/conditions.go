@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+// Set the condition on the AdcsRequest.
+// LastTransitionTime is changed only if the status changes.
+// Returns true if anything was changed.
+func setAdcsRequestCondition(ar *api.AdcsRequest, conditionType api.AdcsRequestConditionType, status cmmeta.ConditionStatus, reason, message string) bool {
+	newCondition := api.AdcsRequestCondition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}
+	now := metav1.Now()
+	for idx, cond := range ar.Status.Conditions {
+		if cond.Type != conditionType {
+			continue
+		}
+		if cond.Status == status {
+			if cond.Reason == reason && cond.Message == message {
+				return false
+			}
+			newCondition.LastTransitionTime = cond.LastTransitionTime
+		} else {
+			newCondition.LastTransitionTime = &now
+		}
+		ar.Status.Conditions[idx] = newCondition
+		return true
+	}
+	newCondition.LastTransitionTime = &now
+	ar.Status.Conditions = append(ar.Status.Conditions, newCondition)
+	return true
+}
+
+// Get the condition of the given type or nil if it's not set.
+func getAdcsRequestCondition(ar *api.AdcsRequest, conditionType api.AdcsRequestConditionType) *api.AdcsRequestCondition {
+	for idx := range ar.Status.Conditions {
+		if ar.Status.Conditions[idx].Type == conditionType {
+			return &ar.Status.Conditions[idx]
+		}
+	}
+	return nil
+}
+
+// Set the condition on the issuer's status.
+// LastTransitionTime is changed only if the status changes.
+// Returns true if anything was changed.
+func setIssuerCondition(issuerStatus *api.AdcsIssuerStatus, conditionType api.IssuerConditionType, status cmmeta.ConditionStatus, reason, message string) bool {
+	newCondition := api.IssuerCondition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}
+	now := metav1.Now()
+	for idx, cond := range issuerStatus.Conditions {
+		if cond.Type != conditionType {
+			continue
+		}
+		if cond.Status == status {
+			if cond.Reason == reason && cond.Message == message {
+				return false
+			}
+			newCondition.LastTransitionTime = cond.LastTransitionTime
+		} else {
+			newCondition.LastTransitionTime = &now
+		}
+		issuerStatus.Conditions[idx] = newCondition
+		return true
+	}
+	newCondition.LastTransitionTime = &now
+	issuerStatus.Conditions = append(issuerStatus.Conditions, newCondition)
+	return true
+}
+
+// Check if the issuer's condition of the given type has status 'True'.
+func issuerConditionTrue(issuerStatus *api.AdcsIssuerStatus, conditionType api.IssuerConditionType) bool {
+	for _, cond := range issuerStatus.Conditions {
+		if cond.Type == conditionType {
+			return cond.Status == cmmeta.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-logr/logr"
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+// issuerFinalizer keeps AdcsIssuers and ClusterAdcsIssuers with revocation enabled, and their
+// credential Secrets, until the certificates of their deleted AdcsRequests are revoked.
+// Without them the requests' finalizers couldn't revoke the certificates, e.g. when
+// a namespace is deleted with the issuer and its requests.
+type issuerFinalizer struct {
+	client.Client
+	// Namespace of the ClusterAdcsIssuers' Secrets.
+	ClusterResourceNamespace string
+}
+
+// Set or remove the finalizers of the issuer (obj) and its Secrets. Returns true if the issuer is
+// being deleted; it's released once none of its requests waits for the revocation.
+// An AdcsIssuer's namespace is set, a ClusterAdcsIssuer's is empty.
+func (f *issuerFinalizer) sync(ctx context.Context, log logr.Logger, obj runtime.Object, ref cmmeta.ObjectReference, namespace string, spec *api.AdcsIssuerSpec) (bool, ctrl.Result, error) {
+	issuer := obj.(metav1.Object)
+	secretNamespace := namespace
+	if secretNamespace == "" {
+		secretNamespace = f.ClusterResourceNamespace
+	}
+
+	if issuer.GetDeletionTimestamp() != nil {
+		if !hasFinalizer(issuer, api.IssuerRevocationFinalizer) {
+			return true, ctrl.Result{}, nil
+		}
+		pending, err := f.pendingRevocations(ctx, ref, namespace)
+		if err != nil {
+			return true, ctrl.Result{}, err
+		}
+		if pending > 0 {
+			log.Info("Issuer kept until the certificates of its requests are revoked", "requests", pending)
+			return true, ctrl.Result{RequeueAfter: issuerRetryInterval}, nil
+		}
+		log.Info("Releasing issuer, no certificates left to revoke")
+		removeFinalizer(issuer, api.IssuerRevocationFinalizer)
+		if err := f.syncSecrets(ctx, log, issuer, spec, secretNamespace); err != nil {
+			return true, ctrl.Result{}, err
+		}
+		return true, ctrl.Result{}, f.Client.Update(ctx, obj)
+	}
+
+	switch {
+	case spec.Revocation != nil && !hasFinalizer(issuer, api.IssuerRevocationFinalizer):
+		issuer.SetFinalizers(append(issuer.GetFinalizers(), api.IssuerRevocationFinalizer))
+	case spec.Revocation == nil && hasFinalizer(issuer, api.IssuerRevocationFinalizer):
+		removeFinalizer(issuer, api.IssuerRevocationFinalizer)
+	default:
+		return false, ctrl.Result{}, f.syncSecrets(ctx, log, issuer, spec, secretNamespace)
+	}
+	if err := f.Client.Update(ctx, obj); err != nil {
+		return false, ctrl.Result{}, err
+	}
+	return false, ctrl.Result{}, f.syncSecrets(ctx, log, issuer, spec, secretNamespace)
+}
+
+// Count the issuer's AdcsRequests whose certificate is still to be revoked.
+func (f *issuerFinalizer) pendingRevocations(ctx context.Context, ref cmmeta.ObjectReference, namespace string) (int, error) {
+	requests := new(api.AdcsRequestList)
+	if err := f.Client.List(ctx, requests, client.InNamespace(namespace)); err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, ar := range requests.Items {
+		if strings.EqualFold(ar.Spec.IssuerRef.Kind, ref.Kind) && ar.Spec.IssuerRef.Name == ref.Name && hasFinalizer(&ar, api.RevokeFinalizer) {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// Keep the finalizer on the Secrets in the namespace used by an issuer holding the finalizer
+// and remove it from the others. The issuer being reconciled (self) is taken as it is now,
+// not as listed, so a just released issuer releases its Secrets.
+func (f *issuerFinalizer) syncSecrets(ctx context.Context, log logr.Logger, self metav1.Object, selfSpec *api.AdcsIssuerSpec, secretNamespace string) error {
+	if secretNamespace == "" {
+		// No cluster resource namespace set.
+		return nil
+	}
+	var specs []*api.AdcsIssuerSpec
+	if hasFinalizer(self, api.IssuerRevocationFinalizer) {
+		specs = append(specs, selfSpec)
+	}
+	issuers := new(api.AdcsIssuerList)
+	if err := f.Client.List(ctx, issuers, client.InNamespace(secretNamespace)); err != nil {
+		return err
+	}
+	for idx := range issuers.Items {
+		issuer := &issuers.Items[idx]
+		if issuer.UID != self.GetUID() && hasFinalizer(issuer, api.IssuerRevocationFinalizer) {
+			specs = append(specs, &issuer.Spec)
+		}
+	}
+	if secretNamespace == f.ClusterResourceNamespace {
+		clusterIssuers := new(api.ClusterAdcsIssuerList)
+		if err := f.Client.List(ctx, clusterIssuers); err != nil {
+			return err
+		}
+		for idx := range clusterIssuers.Items {
+			issuer := &clusterIssuers.Items[idx]
+			if issuer.UID != self.GetUID() && hasFinalizer(issuer, api.IssuerRevocationFinalizer) {
+				spec := api.AdcsIssuerSpec(issuer.Spec)
+				specs = append(specs, &spec)
+			}
+		}
+	}
+	needed := sets.NewString()
+	for _, spec := range specs {
+		needed.Insert(spec.CredentialsRef.Name)
+		if spec.Revocation != nil && spec.Revocation.CredentialsRef != nil {
+			needed.Insert(spec.Revocation.CredentialsRef.Name)
+		}
+	}
+
+	secrets := new(core.SecretList)
+	if err := f.Client.List(ctx, secrets, client.InNamespace(secretNamespace)); err != nil {
+		return err
+	}
+	for idx := range secrets.Items {
+		secret := &secrets.Items[idx]
+		has := hasFinalizer(secret, api.IssuerRevocationFinalizer)
+		switch {
+		case needed.Has(secret.Name) && !has && secret.DeletionTimestamp == nil:
+			secret.Finalizers = append(secret.Finalizers, api.IssuerRevocationFinalizer)
+			log.V(1).Info("Keeping Secret for revocations", "secret", secret.Name)
+		case !needed.Has(secret.Name) && has:
+			removeFinalizer(secret, api.IssuerRevocationFinalizer)
+			log.V(1).Info("Releasing Secret", "secret", secret.Name)
+		default:
+			continue
+		}
+		if err := f.Client.Update(ctx, secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
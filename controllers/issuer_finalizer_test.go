@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	certmanager "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+// A fake client with the objects of the controller's scheme.
+func newFakeClient(t *testing.T, objs ...runtime.Object) client.Client {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, certmanager.AddToScheme(scheme))
+	require.NoError(t, api.AddToScheme(scheme))
+	return fake.NewFakeClientWithScheme(scheme, objs...)
+}
+
+func testSecret(namespace, name string) *core.Secret {
+	return &core.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+}
+
+func testRevocationIssuer(name string, deleted bool) *api.AdcsIssuer {
+	issuer := &api.AdcsIssuer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: name, UID: types.UID("uid-" + name)},
+		Spec: api.AdcsIssuerSpec{
+			CredentialsRef: api.LocalObjectReference{Name: "adcs-credentials"},
+			Revocation: &api.Revocation{
+				URL:            "https://revocation-gateway.example.com/revoke",
+				CredentialsRef: &api.LocalObjectReference{Name: "gateway-credentials"},
+			},
+		},
+	}
+	if deleted {
+		now := metav1.Now()
+		issuer.DeletionTimestamp = &now
+		issuer.Finalizers = []string{api.IssuerRevocationFinalizer}
+	}
+	return issuer
+}
+
+func assertFinalizer(t *testing.T, c client.Client, obj runtime.Object, key client.ObjectKey, expected bool) {
+	t.Helper()
+	require.NoError(t, c.Get(context.Background(), key, obj))
+	assert.Equal(t, expected, hasFinalizer(obj.(metav1.Object), api.IssuerRevocationFinalizer), key.String())
+}
+
+func TestIssuerFinalizerHoldsIssuerAndSecrets(t *testing.T) {
+	ctx := context.Background()
+	issuer := testRevocationIssuer("adcs", false)
+	c := newFakeClient(t, issuer, testSecret("team", "adcs-credentials"), testSecret("team", "gateway-credentials"), testSecret("team", "other"))
+	finalizer := issuerFinalizer{Client: c, ClusterResourceNamespace: "cert-manager"}
+	ref := cmmeta.ObjectReference{Kind: "AdcsIssuer", Name: "adcs"}
+
+	deleted, _, err := finalizer.sync(ctx, logf.NullLogger{}, issuer, ref, "team", &issuer.Spec)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+	assertFinalizer(t, c, new(api.AdcsIssuer), client.ObjectKey{Namespace: "team", Name: "adcs"}, true)
+	assertFinalizer(t, c, new(core.Secret), client.ObjectKey{Namespace: "team", Name: "adcs-credentials"}, true)
+	assertFinalizer(t, c, new(core.Secret), client.ObjectKey{Namespace: "team", Name: "gateway-credentials"}, true)
+	assertFinalizer(t, c, new(core.Secret), client.ObjectKey{Namespace: "team", Name: "other"}, false)
+
+	// Revocation disabled.
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "team", Name: "adcs"}, issuer))
+	issuer.Spec.Revocation = nil
+	_, _, err = finalizer.sync(ctx, logf.NullLogger{}, issuer, ref, "team", &issuer.Spec)
+	require.NoError(t, err)
+	assertFinalizer(t, c, new(api.AdcsIssuer), client.ObjectKey{Namespace: "team", Name: "adcs"}, false)
+	assertFinalizer(t, c, new(core.Secret), client.ObjectKey{Namespace: "team", Name: "adcs-credentials"}, false)
+	assertFinalizer(t, c, new(core.Secret), client.ObjectKey{Namespace: "team", Name: "gateway-credentials"}, false)
+}
+
+func TestIssuerFinalizerWaitsForRevocations(t *testing.T) {
+	ctx := context.Background()
+	issuer := testRevocationIssuer("adcs", true)
+	// Another issuer sharing the ADCS credentials.
+	other := testRevocationIssuer("other", false)
+	other.Finalizers = []string{api.IssuerRevocationFinalizer}
+	other.Spec.Revocation.CredentialsRef = nil
+	adcsCredentials := testSecret("team", "adcs-credentials")
+	gatewayCredentials := testSecret("team", "gateway-credentials")
+	adcsCredentials.Finalizers = []string{api.IssuerRevocationFinalizer}
+	gatewayCredentials.Finalizers = []string{api.IssuerRevocationFinalizer}
+	ar := &api.AdcsRequest{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "request", Finalizers: []string{api.RevokeFinalizer}},
+		Spec:       api.AdcsRequestSpec{IssuerRef: cmmeta.ObjectReference{Kind: "AdcsIssuer", Name: "adcs"}},
+	}
+	c := newFakeClient(t, issuer, other, adcsCredentials, gatewayCredentials, ar)
+	finalizer := issuerFinalizer{Client: c, ClusterResourceNamespace: "cert-manager"}
+	ref := cmmeta.ObjectReference{Kind: "AdcsIssuer", Name: "adcs"}
+
+	deleted, result, err := finalizer.sync(ctx, logf.NullLogger{}, issuer, ref, "team", &issuer.Spec)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	assert.NotZero(t, result.RequeueAfter)
+	assertFinalizer(t, c, new(api.AdcsIssuer), client.ObjectKey{Namespace: "team", Name: "adcs"}, true)
+
+	// Released once the request's certificate is revoked, the shared Secret is kept.
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "team", Name: "request"}, ar))
+	ar.Finalizers = nil
+	require.NoError(t, c.Update(ctx, ar))
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "team", Name: "adcs"}, issuer))
+	deleted, result, err = finalizer.sync(ctx, logf.NullLogger{}, issuer, ref, "team", &issuer.Spec)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	assert.Zero(t, result.RequeueAfter)
+	assertFinalizer(t, c, new(api.AdcsIssuer), client.ObjectKey{Namespace: "team", Name: "adcs"}, false)
+	assertFinalizer(t, c, new(core.Secret), client.ObjectKey{Namespace: "team", Name: "adcs-credentials"}, true)
+	assertFinalizer(t, c, new(core.Secret), client.ObjectKey{Namespace: "team", Name: "gateway-credentials"}, false)
+}
@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	caRenewalsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "adcs_issuer_ca_renewals_total",
+			Help: "Number of new ADCS CA renewals detected by the issuers.",
+		},
+		[]string{"kind", "namespace", "name"},
+	)
+	reissuedCertificatesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "adcs_issuer_ca_renewal_reissued_certificates_total",
+			Help: "Number of certificates re-issued because their CA certificate was about to expire.",
+		},
+		[]string{"kind", "namespace", "name"},
+	)
+	certificateNotAfter = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "adcs_issuer_certificate_not_after_timestamp_seconds",
+			Help: "Expiration time of the certificates in the AdcsCertificateRecord inventory.",
+		},
+		[]string{"record", "namespace", "certificate", "issuer_kind", "issuer_name"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(caRenewalsTotal, reissuedCertificatesTotal, certificateNotAfter)
+}
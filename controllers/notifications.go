@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+	"github.com/chojnack/adcs-issuer/notify"
+)
+
+// Deliver the notifications accepted by the notifiers and keep track of the deliveries in statuses.
+// A notification is sent once per notifier, event and key; failed deliveries are retried with a backoff
+// until the notifier's maxAttempts. Returns the time until the next retry is due, zero if there is none.
+func dispatchNotifications(ctx context.Context, log logr.Logger, notifiers []*notify.Notifier, statuses *[]api.NotificationStatus, notifications ...*notify.Notification) time.Duration {
+	var next time.Duration
+	now := time.Now()
+	for _, notifier := range notifiers {
+		for _, notification := range notifications {
+			if !notifier.Accepts(notification, now) {
+				continue
+			}
+			status := findNotificationStatus(*statuses, notifier.Name, api.NotificationEvent(notification.Event), notification.Key)
+			if status == nil {
+				*statuses = append(*statuses, api.NotificationStatus{
+					Notifier: notifier.Name,
+					Event:    api.NotificationEvent(notification.Event),
+					Key:      notification.Key,
+				})
+				status = &(*statuses)[len(*statuses)-1]
+			} else if status.State != api.NotificationRetrying {
+				continue
+			} else if wait := status.LastAttempt.Add(notify.RetryBackoff(status.Attempts)).Sub(now); wait > 0 {
+				next = minRequeue(next, wait)
+				continue
+			}
+
+			nlog := log.WithValues("notifier", notifier.Name, "event", notification.Event, "key", notification.Key)
+			notification.Time = now
+			err := notifier.Deliver(ctx, notification)
+			lastAttempt := metav1.NewTime(now)
+			status.LastAttempt = &lastAttempt
+			status.Attempts++
+			switch {
+			case err == nil:
+				nlog.Info("Notification delivered")
+				status.State = api.NotificationDelivered
+				status.Message = ""
+			case status.Attempts >= notifier.MaxAttempts:
+				nlog.Error(err, "Notification not delivered, giving up", "attempts", status.Attempts)
+				status.State = api.NotificationFailed
+				status.Message = err.Error()
+			default:
+				backoff := notify.RetryBackoff(status.Attempts)
+				nlog.Error(err, fmt.Sprintf("Notification not delivered, re-trying in %v", backoff), "attempts", status.Attempts)
+				status.State = api.NotificationRetrying
+				status.Message = err.Error()
+				next = minRequeue(next, backoff)
+			}
+		}
+	}
+	return next
+}
+
+func findNotificationStatus(statuses []api.NotificationStatus, notifier string, event api.NotificationEvent, key string) *api.NotificationStatus {
+	for idx := range statuses {
+		if s := &statuses[idx]; s.Notifier == notifier && s.Event == event && s.Key == key {
+			return s
+		}
+	}
+	return nil
+}
+
+func hasNotificationRetries(statuses []api.NotificationStatus) bool {
+	for _, s := range statuses {
+		if s.State == api.NotificationRetrying {
+			return true
+		}
+	}
+	return false
+}
+
+// The shorter of two requeue intervals, zero meaning none.
+func minRequeue(a, b time.Duration) time.Duration {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// The notification about the request's current state, nil if the state isn't notified.
+// Errored requests that are re-submitted aren't notified.
+func requestNotification(ar *api.AdcsRequest, template string) *notify.Notification {
+	var event notify.Event
+	switch ar.Status.State {
+	case api.Pending:
+		event = notify.Pending
+	case api.Ready:
+		event = notify.Issued
+	case api.Rejected:
+		event = notify.Rejected
+	case api.Errored:
+		event = notify.Errored
+	default:
+		return nil
+	}
+	request := &notify.Request{
+		Namespace:     ar.Namespace,
+		Name:          ar.Name,
+		AdcsRequestId: ar.Status.Id,
+		State:         string(ar.Status.State),
+		Reason:        ar.Status.Reason,
+		Template:      template,
+	}
+	if ar.Status.PendingSince != nil {
+		since := ar.Status.PendingSince.Time
+		request.PendingSince = &since
+	}
+	key := ar.Status.Id
+	if key == "" {
+		// Errored without being accepted by ADCS.
+		key = fmt.Sprintf("attempt-%d", ar.Status.Attempts)
+	}
+	return &notify.Notification{
+		Event:   event,
+		Key:     key,
+		Issuer:  notificationIssuer(ar.Spec.IssuerRef, ar.Namespace),
+		Request: request,
+	}
+}
+
+// The notifications about the issuer's CA certificates. The notifiers pick the expiring ones.
+func caNotifications(ref cmmeta.ObjectReference, namespace string, cas []api.CACertificate) []*notify.Notification {
+	notifications := make([]*notify.Notification, 0, len(cas))
+	for _, ca := range cas {
+		notifications = append(notifications, &notify.Notification{
+			Event:  notify.CAExpiring,
+			Key:    ca.SerialNumber,
+			Issuer: notificationIssuer(ref, namespace),
+			CA: &notify.CA{
+				Renewal:      ca.Renewal,
+				Subject:      ca.Subject,
+				SerialNumber: ca.SerialNumber,
+				NotAfter:     ca.NotAfter.Time,
+			},
+		})
+	}
+	return notifications
+}
+
+func notificationIssuer(ref cmmeta.ObjectReference, namespace string) notify.Issuer {
+	issuer := notify.Issuer{Kind: ref.Kind, Name: ref.Name}
+	if !strings.EqualFold(ref.Kind, "ClusterAdcsIssuer") {
+		issuer.Namespace = namespace
+	}
+	return issuer
+}
@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+const (
+	defaultTrustBundleKey = "ca.crt"
+)
+
+// TrustDistributionReconciler writes the CA bundles of Ready issuers to ConfigMaps.
+// An AdcsIssuer's bundle is written to its own namespace, a ClusterAdcsIssuer's to the
+// namespaces selected by its trustDistribution. The bundle is taken from the issuer's
+// status, kept by the issuer controllers, so ADCS isn't called here.
+// Requests for a ClusterAdcsIssuer have an empty namespace.
+type TrustDistributionReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+func (r *TrustDistributionReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("issuer", req.NamespacedName)
+
+	obj, ref, spec, status, err := r.getIssuer(ctx, req.NamespacedName)
+	if apierrors.IsNotFound(err) {
+		// Issuer deleted
+		return ctrl.Result{}, r.cleanup(ctx, log, ref, req.Namespace, nil)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	td := spec.TrustDistribution
+	if td == nil {
+		return ctrl.Result{}, r.cleanup(ctx, log, ref, req.Namespace, nil)
+	}
+	if !issuerConditionTrue(status, api.IssuerConditionReady) {
+		// Keep the published bundles until the issuer is Ready again.
+		log.V(1).Info("Issuer not ready")
+		return ctrl.Result{}, nil
+	}
+
+	if len(status.CAChain) == 0 {
+		// Published once the issuer controller has fetched the CA chain,
+		// the status update triggers another reconcile.
+		log.V(1).Info("CA chain not fetched yet")
+		return ctrl.Result{}, nil
+	}
+	bundle := trustBundle(status.CAChain, status.CACertificates)
+
+	namespaces, err := r.namespaces(ctx, req.Namespace, td)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	key := td.Key
+	if key == "" {
+		key = defaultTrustBundleKey
+	}
+	selected := make(map[types.NamespacedName]bool)
+	for _, ns := range namespaces {
+		if ns.Status.Phase == core.NamespaceTerminating {
+			continue
+		}
+		name := types.NamespacedName{Namespace: ns.Name, Name: td.ConfigMapName}
+		selected[name] = true
+		if err := r.publish(ctx, log, obj, ref, req.Namespace, name, key, bundle); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, r.cleanup(ctx, log, ref, req.Namespace, selected)
+}
+
+// Get the namespaces the issuer's CA bundle is written to: the AdcsIssuer's own namespace,
+// or the namespaces selected for the ClusterAdcsIssuer (empty issuerNamespace).
+func (r *TrustDistributionReconciler) namespaces(ctx context.Context, issuerNamespace string, td *api.TrustDistribution) ([]core.Namespace, error) {
+	if issuerNamespace != "" {
+		ns := new(core.Namespace)
+		if err := r.Client.Get(ctx, types.NamespacedName{Name: issuerNamespace}, ns); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+		return []core.Namespace{*ns}, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&td.NamespaceSelector)
+	if err != nil {
+		// Validated by the webhook
+		r.Log.Error(err, "Invalid namespace selector")
+		return nil, nil
+	}
+	namespaces := new(core.NamespaceList)
+	if err := r.Client.List(ctx, namespaces, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	return namespaces.Items, nil
+}
+
+// Get the AdcsIssuer or, for an empty namespace, the ClusterAdcsIssuer.
+// The reference is set even if the issuer is not found.
+func (r *TrustDistributionReconciler) getIssuer(ctx context.Context, key types.NamespacedName) (runtime.Object, cmmeta.ObjectReference, *api.AdcsIssuerSpec, *api.AdcsIssuerStatus, error) {
+	if key.Namespace == "" {
+		ref := cmmeta.ObjectReference{Kind: "ClusterAdcsIssuer", Name: key.Name}
+		issuer := new(api.ClusterAdcsIssuer)
+		if err := r.Client.Get(ctx, key, issuer); err != nil {
+			return nil, ref, nil, nil, err
+		}
+		spec := api.AdcsIssuerSpec(issuer.Spec)
+		return issuer, ref, &spec, (*api.AdcsIssuerStatus)(&issuer.Status), nil
+	}
+	ref := cmmeta.ObjectReference{Kind: "AdcsIssuer", Name: key.Name}
+	issuer := new(api.AdcsIssuer)
+	if err := r.Client.Get(ctx, key, issuer); err != nil {
+		return nil, ref, nil, nil, err
+	}
+	return issuer, ref, &issuer.Spec, &issuer.Status, nil
+}
+
+// Build the bundle from the CA chain and the CA certificates of other renewals
+// so both old and new CA certificates are trusted during a CA key renewal.
+func trustBundle(chain []byte, renewals []api.CACertificate) []byte {
+	bundle := append([]byte{}, chain...)
+	for _, ca := range renewals {
+		if !bytes.Contains(bundle, bytes.TrimSpace(ca.Certificate)) {
+			bundle = append(bundle, ca.Certificate...)
+		}
+	}
+	return bundle
+}
+
+func trustLabels(ref cmmeta.ObjectReference, namespace string) map[string]string {
+	return map[string]string{
+		api.TrustIssuerKindLabel:      ref.Kind,
+		api.TrustIssuerNameLabel:      labelValue(ref.Name),
+		api.TrustIssuerNamespaceLabel: namespace,
+	}
+}
+
+// Label values are limited to 63 characters, shorter than object names. Longer values
+// are truncated and kept unique with a hash of the full value.
+func labelValue(value string) string {
+	if len(value) <= validation.LabelValueMaxLength {
+		return value
+	}
+	sum := sha256.Sum256([]byte(value))
+	suffix := hex.EncodeToString(sum[:8])
+	return strings.TrimRight(value[:validation.LabelValueMaxLength-len(suffix)-1], "-_.") + "-" + suffix
+}
+
+// Create or update the ConfigMap. ConfigMaps not written by the controller are left untouched.
+func (r *TrustDistributionReconciler) publish(ctx context.Context, log logr.Logger, issuer runtime.Object, ref cmmeta.ObjectReference, issuerNamespace string, name types.NamespacedName, key string, bundle []byte) error {
+	labels := trustLabels(ref, issuerNamespace)
+	cm := new(core.ConfigMap)
+	err := r.Client.Get(ctx, name, cm)
+	if apierrors.IsNotFound(err) {
+		cm = &core.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name.Name,
+				Namespace:   name.Namespace,
+				Labels:      labels,
+				Annotations: map[string]string{api.TrustIssuerNameAnnotation: ref.Name},
+			},
+			Data: map[string]string{key: string(bundle)},
+		}
+		log.Info("Publishing CA bundle", "configmap", name)
+		if err := r.Client.Create(ctx, cm); err != nil {
+			r.Recorder.Event(issuer, core.EventTypeWarning, "TrustDistribution", fmt.Sprintf("Cannot create ConfigMap %s: %v", name, err))
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for k, v := range labels {
+		if cm.Labels[k] != v {
+			message := fmt.Sprintf("ConfigMap %s exists and is not managed by this issuer", name)
+			log.Info(message)
+			r.Recorder.Event(issuer, core.EventTypeWarning, "TrustDistribution", message)
+			return nil
+		}
+	}
+	if len(cm.Data) == 1 && cm.Data[key] == string(bundle) {
+		return nil
+	}
+	cm.Data = map[string]string{key: string(bundle)}
+	log.Info("Updating CA bundle", "configmap", name)
+	if err := r.Client.Update(ctx, cm); err != nil {
+		r.Recorder.Event(issuer, core.EventTypeWarning, "TrustDistribution", fmt.Sprintf("Cannot update ConfigMap %s: %v", name, err))
+		return err
+	}
+	return nil
+}
+
+// Delete the issuer's ConfigMaps that are not selected (all if selected is nil).
+func (r *TrustDistributionReconciler) cleanup(ctx context.Context, log logr.Logger, ref cmmeta.ObjectReference, issuerNamespace string, selected map[types.NamespacedName]bool) error {
+	configMaps := new(core.ConfigMapList)
+	if err := r.Client.List(ctx, configMaps, client.MatchingLabels(trustLabels(ref, issuerNamespace))); err != nil {
+		return err
+	}
+	for idx := range configMaps.Items {
+		cm := &configMaps.Items[idx]
+		if selected[types.NamespacedName{Namespace: cm.Namespace, Name: cm.Name}] {
+			continue
+		}
+		log.Info("Removing CA bundle", "configmap", types.NamespacedName{Namespace: cm.Namespace, Name: cm.Name})
+		if err := r.Client.Delete(ctx, cm); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Map a namespace event to the issuers in the namespace and all the cluster issuers
+// distributing their CA bundle.
+func (r *TrustDistributionReconciler) issuersForNamespace(obj handler.MapObject) []reconcile.Request {
+	ctx := context.Background()
+	var requests []reconcile.Request
+	issuerList := new(api.AdcsIssuerList)
+	if err := r.Client.List(ctx, issuerList, client.InNamespace(obj.Meta.GetName())); err != nil {
+		r.Log.Error(err, "Cannot list issuers")
+	}
+	for _, issuer := range issuerList.Items {
+		if issuer.Spec.TrustDistribution != nil {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: issuer.Namespace, Name: issuer.Name}})
+		}
+	}
+	clusterIssuers := new(api.ClusterAdcsIssuerList)
+	if err := r.Client.List(ctx, clusterIssuers); err != nil {
+		r.Log.Error(err, "Cannot list cluster issuers")
+	}
+	for _, issuer := range clusterIssuers.Items {
+		if issuer.Spec.TrustDistribution != nil {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: issuer.Name}})
+		}
+	}
+	return requests
+}
+
+// Map a ConfigMap event to the issuer that wrote it, so changes made by others are reverted.
+func issuerForConfigMap(obj handler.MapObject) []reconcile.Request {
+	labels := obj.Meta.GetLabels()
+	if labels[api.TrustIssuerNameLabel] == "" {
+		return nil
+	}
+	name := obj.Meta.GetAnnotations()[api.TrustIssuerNameAnnotation]
+	if name == "" {
+		name = labels[api.TrustIssuerNameLabel]
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{
+		Namespace: labels[api.TrustIssuerNamespaceLabel],
+		Name:      name,
+	}}}
+}
+
+func (r *TrustDistributionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("trustdistribution").
+		For(&api.AdcsIssuer{}).
+		Watches(&source.Kind{Type: &api.ClusterAdcsIssuer{}}, &handler.EnqueueRequestForObject{}).
+		Watches(&source.Kind{Type: &core.Namespace{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.issuersForNamespace),
+		}).
+		Watches(&source.Kind{Type: &core.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(issuerForConfigMap),
+		}).
+		Complete(r)
+}
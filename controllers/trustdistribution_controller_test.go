@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+func testNamespace(name string, labels map[string]string) *core.Namespace {
+	return &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func testTrustDistributionIssuer(chain []byte) *api.ClusterAdcsIssuer {
+	return &api.ClusterAdcsIssuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "adcs"},
+		Spec: api.ClusterAdcsIssuerSpec{
+			TrustDistribution: &api.TrustDistribution{
+				ConfigMapName:     "adcs-ca-bundle",
+				NamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"adcs-trust": "true"}},
+			},
+		},
+		Status: api.ClusterAdcsIssuerStatus{
+			Conditions: []api.IssuerCondition{{Type: api.IssuerConditionReady, Status: cmmeta.ConditionTrue}},
+			CAChain:    chain,
+		},
+	}
+}
+
+func newTrustDistributionReconciler(t *testing.T, objs ...runtime.Object) (*TrustDistributionReconciler, *record.FakeRecorder) {
+	recorder := record.NewFakeRecorder(10)
+	return &TrustDistributionReconciler{Client: newFakeClient(t, objs...), Log: logf.NullLogger{}, Recorder: recorder}, recorder
+}
+
+func TestTrustBundle(t *testing.T) {
+	old := newTestCertificate(t, "Test CA", time.Now().Add(24*time.Hour), nil).pem()
+	renewed := newTestCertificate(t, "Test CA", time.Now().Add(365*24*time.Hour), nil).pem()
+	renewals := []api.CACertificate{{Renewal: 0, Certificate: old}, {Renewal: 1, Certificate: renewed}}
+
+	// The CA certificates of the other renewals are added once.
+	assert.Equal(t, append(append([]byte{}, renewed...), old...), trustBundle(renewed, renewals))
+	assert.Equal(t, renewed, trustBundle(renewed, renewals[1:]))
+	assert.Equal(t, renewed, trustBundle(renewed, nil))
+}
+
+func TestTrustDistributionReconcile(t *testing.T) {
+	ctx := context.Background()
+	ca := newTestCertificate(t, "Test CA", time.Now().Add(24*time.Hour), nil).pem()
+	renewed := newTestCertificate(t, "Test CA", time.Now().Add(365*24*time.Hour), nil).pem()
+	foreign := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "other-team", Name: "adcs-ca-bundle"},
+		Data:       map[string]string{"ca.crt": "not ours"},
+	}
+	issuer := testTrustDistributionIssuer(ca)
+	r, recorder := newTrustDistributionReconciler(t, issuer, foreign,
+		testNamespace("team", map[string]string{"adcs-trust": "true"}),
+		testNamespace("other-team", map[string]string{"adcs-trust": "true"}),
+		testNamespace("not-selected", nil))
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "adcs"}}
+	bundle := func(namespace string) (string, bool) {
+		cm := new(core.ConfigMap)
+		err := r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "adcs-ca-bundle"}, cm)
+		if apierrors.IsNotFound(err) {
+			return "", false
+		}
+		require.NoError(t, err)
+		return cm.Data["ca.crt"], true
+	}
+
+	// Created in the selected namespaces, the ConfigMap not written by the controller is left untouched.
+	_, err := r.Reconcile(req)
+	require.NoError(t, err)
+	data, ok := bundle("team")
+	assert.True(t, ok)
+	assert.Equal(t, string(ca), data)
+	data, _ = bundle("other-team")
+	assert.Equal(t, "not ours", data)
+	_, ok = bundle("not-selected")
+	assert.False(t, ok)
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Contains(t, <-recorder.Events, "ConfigMap other-team/adcs-ca-bundle exists and is not managed by this issuer")
+	}
+
+	// Updated on CA renewal.
+	require.NoError(t, r.Client.Get(ctx, req.NamespacedName, issuer))
+	issuer.Status.CAChain = renewed
+	require.NoError(t, r.Client.Update(ctx, issuer))
+	_, err = r.Reconcile(req)
+	require.NoError(t, err)
+	data, _ = bundle("team")
+	assert.Equal(t, string(renewed), data)
+
+	// Removed when the namespace is deselected, or the distribution is disabled.
+	ns := new(core.Namespace)
+	require.NoError(t, r.Client.Get(ctx, types.NamespacedName{Name: "team"}, ns))
+	ns.Labels = nil
+	require.NoError(t, r.Client.Update(ctx, ns))
+	_, err = r.Reconcile(req)
+	require.NoError(t, err)
+	_, ok = bundle("team")
+	assert.False(t, ok)
+	data, _ = bundle("other-team")
+	assert.Equal(t, "not ours", data)
+
+	require.NoError(t, r.Client.Get(ctx, types.NamespacedName{Name: "team"}, ns))
+	ns.Labels = map[string]string{"adcs-trust": "true"}
+	require.NoError(t, r.Client.Update(ctx, ns))
+	_, err = r.Reconcile(req)
+	require.NoError(t, err)
+	_, ok = bundle("team")
+	assert.True(t, ok)
+	require.NoError(t, r.Client.Get(ctx, req.NamespacedName, issuer))
+	issuer.Spec.TrustDistribution = nil
+	require.NoError(t, r.Client.Update(ctx, issuer))
+	_, err = r.Reconcile(req)
+	require.NoError(t, err)
+	_, ok = bundle("team")
+	assert.False(t, ok)
+	data, _ = bundle("other-team")
+	assert.Equal(t, "not ours", data)
+}
+
+func TestTrustDistributionLongIssuerName(t *testing.T) {
+	ctx := context.Background()
+	name := strings.Repeat("long-issuer-name.", 10) + "example"
+	issuer := &api.AdcsIssuer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: name},
+		Spec:       api.AdcsIssuerSpec{TrustDistribution: &api.TrustDistribution{ConfigMapName: "adcs-ca-bundle"}},
+		Status: api.AdcsIssuerStatus{
+			Conditions: []api.IssuerCondition{{Type: api.IssuerConditionReady, Status: cmmeta.ConditionTrue}},
+			CAChain:    newTestCertificate(t, "Test CA", time.Now().Add(24*time.Hour), nil).pem(),
+		},
+	}
+	r, _ := newTrustDistributionReconciler(t, issuer, testNamespace("team", nil))
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "team", Name: name}})
+	require.NoError(t, err)
+
+	cm := new(core.ConfigMap)
+	require.NoError(t, r.Client.Get(ctx, types.NamespacedName{Namespace: "team", Name: "adcs-ca-bundle"}, cm))
+	assert.Empty(t, validation.IsValidLabelValue(cm.Labels[api.TrustIssuerNameLabel]))
+	assert.Equal(t, []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "team", Name: name}}},
+		issuerForConfigMap(handler.MapObject{Meta: cm, Object: cm}))
+}
+
+// failingCreateClient fails to create any object.
+type failingCreateClient struct {
+	client.Client
+}
+
+func (c failingCreateClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	return errors.New("admission webhook denied the request")
+}
+
+func TestTrustDistributionCreateFailure(t *testing.T) {
+	r, recorder := newTrustDistributionReconciler(t, testTrustDistributionIssuer([]byte("CA")),
+		testNamespace("team", map[string]string{"adcs-trust": "true"}))
+	r.Client = failingCreateClient{r.Client}
+
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "adcs"}})
+	assert.Error(t, err)
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Contains(t, <-recorder.Events, "Cannot create ConfigMap team/adcs-ca-bundle: admission webhook denied the request")
+	}
+}
+
+func TestLabelValue(t *testing.T) {
+	assert.Equal(t, "adcs", labelValue("adcs"))
+	assert.Equal(t, strings.Repeat("a", 63), labelValue(strings.Repeat("a", 63)))
+
+	// Longer values are truncated, ending in an alphanumeric character, and stay unique.
+	long := labelValue(strings.Repeat("a", 45) + "." + strings.Repeat("b", 30))
+	assert.Empty(t, validation.IsValidLabelValue(long))
+	assert.True(t, strings.HasPrefix(long, strings.Repeat("a", 45)+"-"))
+	assert.NotEqual(t, long, labelValue(strings.Repeat("a", 45)+"."+strings.Repeat("c", 30)))
+}
+
+func TestIssuersForNamespace(t *testing.T) {
+	td := &api.TrustDistribution{ConfigMapName: "adcs-ca-bundle"}
+	r, _ := newTrustDistributionReconciler(t,
+		&api.AdcsIssuer{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "distributing"}, Spec: api.AdcsIssuerSpec{TrustDistribution: td}},
+		&api.AdcsIssuer{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "not-distributing"}},
+		&api.AdcsIssuer{ObjectMeta: metav1.ObjectMeta{Namespace: "other-team", Name: "distributing"}, Spec: api.AdcsIssuerSpec{TrustDistribution: td}},
+		&api.ClusterAdcsIssuer{ObjectMeta: metav1.ObjectMeta{Name: "distributing"}, Spec: api.ClusterAdcsIssuerSpec{TrustDistribution: td}},
+		&api.ClusterAdcsIssuer{ObjectMeta: metav1.ObjectMeta{Name: "not-distributing"}})
+	ns := testNamespace("team", nil)
+
+	assert.ElementsMatch(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "team", Name: "distributing"}},
+		{NamespacedName: types.NamespacedName{Name: "distributing"}},
+	}, r.issuersForNamespace(handler.MapObject{Meta: ns, Object: ns}))
+}
+
+func TestIssuerForConfigMap(t *testing.T) {
+	cm := &core.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "adcs-ca-bundle"}}
+	assert.Nil(t, issuerForConfigMap(handler.MapObject{Meta: cm, Object: cm}))
+
+	cm.Labels = trustLabels(cmmeta.ObjectReference{Kind: "ClusterAdcsIssuer", Name: "adcs"}, "")
+	assert.Equal(t, []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "adcs"}}},
+		issuerForConfigMap(handler.MapObject{Meta: cm, Object: cm}))
+}
@@ -0,0 +1,70 @@
+package issuers
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/chojnack/adcs-issuer/adcs"
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+// Get the CA certificates of all the ADCS CA renewals, the oldest first.
+func (i *Issuer) GetCaCertificates(ctx context.Context) ([]api.CACertificate, error) {
+	renewals, err := i.certServ.GetCaCertificates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var cas []api.CACertificate
+	for renewal, data := range renewals {
+		cert, err := parseCertificate([]byte(data))
+		if err != nil {
+			return nil, fmt.Errorf("CA renewal %d: %v", renewal, err)
+		}
+		cas = append(cas, api.CACertificate{
+			Renewal:      renewal,
+			Subject:      cert.Subject.String(),
+			SerialNumber: fmt.Sprintf("%x", cert.SerialNumber),
+			NotAfter:     metav1.NewTime(cert.NotAfter),
+			Certificate:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		})
+	}
+	return cas, nil
+}
+
+// Get the CA chain (PEM) of the CA's newest renewal.
+func (i *Issuer) GetCaCertificateChain(ctx context.Context) ([]byte, error) {
+	chain, err := i.certServ.GetCaCertificateChain(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(chain), nil
+}
+
+// Complete the CA chain (PEM) of the issued certificate if the issuer has chain completion set.
+// Returns the certificate and the chain ordered from the certificate's issuer to the root.
+// If the chain can't be completed the failure is logged and the chain is returned as ADCS sent it,
+// the certificate is issued anyway.
+func (i *Issuer) completeChain(ctx context.Context, cert, ca []byte) ([]byte, []byte, error) {
+	if i.chainCompleter == nil {
+		return cert, ca, nil
+	}
+	leaf, err := parseCertificate(cert)
+	if err != nil {
+		adcs.LoggerFrom(ctx).Error(err, "Cannot parse the issued certificate, using the chain from ADCS")
+		return cert, ca, nil
+	}
+	chain, err := parseCertificates(ca)
+	if err != nil {
+		adcs.LoggerFrom(ctx).Error(err, "Cannot parse the CA chain, using the chain from ADCS")
+		return cert, ca, nil
+	}
+	completed, err := i.chainCompleter.Complete(ctx, leaf, chain)
+	if err != nil {
+		adcs.LoggerFrom(ctx).Error(err, "Cannot complete CA chain, using the chain from ADCS")
+		return cert, ca, nil
+	}
+	return cert, adcs.EncodeCertificatesPem(completed), nil
+}
@@ -0,0 +1,47 @@
+package issuers
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chojnack/adcs-issuer/adcs"
+)
+
+func TestCompleteChain(t *testing.T) {
+	ctx := context.Background()
+	root := newTestCA(t, "Test Root", nil)
+	intermediate := newTestCA(t, "Test Intermediate", root)
+	other := newTestCA(t, "Other Root", nil)
+	_, csr := newTestRequest(t, newTestKey(t), &x509.CertificateRequest{Subject: pkix.Name{CommonName: "app.example.com"}})
+	cert := intermediate.issueForCSR(t, csr, nil)
+	ca := adcs.EncodeCertificatesPem([]*x509.Certificate{root.cert, other.cert, intermediate.cert})
+	issuer := &Issuer{chainCompleter: adcs.NewChainCompleter(nil, nil)}
+
+	// Ordered from the certificate's issuer to the root.
+	chainCert, chain, err := issuer.completeChain(ctx, cert, ca)
+	require.NoError(t, err)
+	assert.Equal(t, cert, chainCert)
+	assert.Equal(t, adcs.EncodeCertificatesPem([]*x509.Certificate{intermediate.cert, root.cert}), chain)
+
+	// Returned as ADCS sent it without chain completion.
+	chainCert, chain, err = (&Issuer{}).completeChain(ctx, cert, ca)
+	require.NoError(t, err)
+	assert.Equal(t, cert, chainCert)
+	assert.Equal(t, ca, chain)
+
+	// The certificate is issued anyway if the certificate or the chain can't be parsed.
+	for name, test := range map[string][2][]byte{
+		"certificate": {[]byte("not a certificate"), ca},
+		"chain":       {cert, []byte("-----BEGIN CERTIFICATE-----\nbm90IGEgY2VydGlmaWNhdGU=\n-----END CERTIFICATE-----\n")},
+	} {
+		chainCert, chain, err = issuer.completeChain(ctx, test[0], test[1])
+		require.NoError(t, err, name)
+		assert.Equal(t, test[0], chainCert, name)
+		assert.Equal(t, test[1], chain, name)
+	}
+}
@@ -0,0 +1,170 @@
+package issuers
+
+import (
+	"container/list"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/chojnack/adcs-issuer/adcs"
+	"github.com/chojnack/adcs-issuer/notify"
+)
+
+// CertsrvCache keeps ADCS certsrv clients between reconciles so their
+// HTTP transports (TLS sessions, NTLM authenticated keep-alive connections)
+// are reused instead of being set up for every request.
+// Entries are keyed by issuer UID and are invalidated when the issuer spec or
+// the credentials Secret change. The least recently used entry is evicted
+// when the cache is full.
+// The issuer's notifiers and revocation gateway client are kept with its certsrv client.
+type CertsrvCache struct {
+	mu      sync.Mutex
+	size    int
+	lru     *list.List
+	entries map[types.UID]*list.Element
+}
+
+type certsrvCacheEntry struct {
+	uid types.UID
+	// Issuer generation (not resourceVersion) so status updates don't evict the client.
+	issuerGeneration int64
+	secretVersion    string
+	certServ         adcs.AdcsCertsrv
+
+	// Built from the spec only.
+	notifiers    []*notify.Notifier
+	hasNotifiers bool
+	// Built from the spec and the revocation gateway's Secret, if any.
+	revokerSecretVersion string
+	revoker              adcs.Revoker
+}
+
+// NewCertsrvCache creates a cache holding at most size clients.
+func NewCertsrvCache(size int) *CertsrvCache {
+	if size < 1 {
+		size = 1
+	}
+	return &CertsrvCache{
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[types.UID]*list.Element),
+	}
+}
+
+// Get returns the cached client for the issuer or nil if there's none or
+// it was built for a different issuer generation or Secret version.
+// Stale entries are dropped.
+func (c *CertsrvCache) Get(uid types.UID, issuerGeneration int64, secretVersion string) adcs.AdcsCertsrv {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[uid]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*certsrvCacheEntry)
+	if entry.issuerGeneration != issuerGeneration || entry.secretVersion != secretVersion {
+		c.remove(el)
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return entry.certServ
+}
+
+// Add stores the client for the issuer replacing any previous one.
+func (c *CertsrvCache) Add(uid types.UID, issuerGeneration int64, secretVersion string, certServ adcs.AdcsCertsrv) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[uid]; ok {
+		c.remove(el)
+	}
+	c.entries[uid] = c.lru.PushFront(&certsrvCacheEntry{
+		uid:              uid,
+		issuerGeneration: issuerGeneration,
+		secretVersion:    secretVersion,
+		certServ:         certServ,
+	})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// GetNotifiers returns the notifiers cached for the issuer generation.
+// The certsrv client must have been taken from the cache or added first.
+func (c *CertsrvCache) GetNotifiers(uid types.UID, issuerGeneration int64) ([]*notify.Notifier, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(uid, issuerGeneration)
+	if entry == nil || !entry.hasNotifiers {
+		return nil, false
+	}
+	return entry.notifiers, true
+}
+
+// AddNotifiers stores the notifiers with the issuer's certsrv client.
+func (c *CertsrvCache) AddNotifiers(uid types.UID, issuerGeneration int64, notifiers []*notify.Notifier) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry := c.entry(uid, issuerGeneration); entry != nil {
+		entry.notifiers = notifiers
+		entry.hasNotifiers = true
+	}
+}
+
+// GetRevoker returns the revocation gateway client cached for the issuer generation
+// and the version of the gateway's Secret (empty without credentials), or nil.
+func (c *CertsrvCache) GetRevoker(uid types.UID, issuerGeneration int64, secretVersion string) adcs.Revoker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(uid, issuerGeneration)
+	if entry == nil || entry.revoker == nil || entry.revokerSecretVersion != secretVersion {
+		return nil
+	}
+	return entry.revoker
+}
+
+// AddRevoker stores the revocation gateway client with the issuer's certsrv client
+// replacing any previous one.
+func (c *CertsrvCache) AddRevoker(uid types.UID, issuerGeneration int64, secretVersion string, revoker adcs.Revoker) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry := c.entry(uid, issuerGeneration); entry != nil {
+		if entry.revoker != nil && entry.revoker != revoker {
+			closeIdleConnections(entry.revoker)
+		}
+		entry.revoker = revoker
+		entry.revokerSecretVersion = secretVersion
+	}
+}
+
+// The issuer's entry if it is for the generation.
+func (c *CertsrvCache) entry(uid types.UID, issuerGeneration int64) *certsrvCacheEntry {
+	el, ok := c.entries[uid]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*certsrvCacheEntry)
+	if entry.issuerGeneration != issuerGeneration {
+		return nil
+	}
+	return entry
+}
+
+func (c *CertsrvCache) remove(el *list.Element) {
+	entry := c.lru.Remove(el).(*certsrvCacheEntry)
+	delete(c.entries, entry.uid)
+	// Don't leave the evicted clients' keep-alive connections open.
+	closeIdleConnections(entry.certServ)
+	closeIdleConnections(entry.revoker)
+}
+
+func closeIdleConnections(client interface{}) {
+	if closer, ok := client.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,113 @@
+package issuers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chojnack/adcs-issuer/adcs"
+	"github.com/chojnack/adcs-issuer/notify"
+)
+
+type cachedCertsrv struct {
+	adcs.AdcsCertsrv
+	closed int
+}
+
+func (c *cachedCertsrv) CloseIdleConnections() {
+	c.closed++
+}
+
+type cachedRevoker struct {
+	adcs.Revoker
+	closed int
+}
+
+func (r *cachedRevoker) CloseIdleConnections() {
+	r.closed++
+}
+
+func TestCertsrvCacheKey(t *testing.T) {
+	cache := NewCertsrvCache(2)
+	certServ := &cachedCertsrv{}
+	cache.Add("uid", 1, "100", certServ)
+	assert.Same(t, certServ, cache.Get("uid", 1, "100"))
+	assert.Nil(t, cache.Get("other", 1, "100"))
+	assert.Equal(t, 0, certServ.closed)
+
+	// A new issuer generation or Secret version drops the client.
+	assert.Nil(t, cache.Get("uid", 2, "100"))
+	assert.Equal(t, 1, certServ.closed)
+	assert.Nil(t, cache.Get("uid", 1, "100"))
+
+	cache.Add("uid", 1, "100", certServ)
+	assert.Nil(t, cache.Get("uid", 1, "101"))
+	assert.Equal(t, 2, certServ.closed)
+
+	// Replaced clients are closed.
+	cache.Add("uid", 1, "100", certServ)
+	replacement := &cachedCertsrv{}
+	cache.Add("uid", 1, "100", replacement)
+	assert.Equal(t, 3, certServ.closed)
+	assert.Same(t, replacement, cache.Get("uid", 1, "100"))
+}
+
+func TestCertsrvCacheEviction(t *testing.T) {
+	cache := NewCertsrvCache(2)
+	a, b, c := &cachedCertsrv{}, &cachedCertsrv{}, &cachedCertsrv{}
+	cache.Add("a", 1, "1", a)
+	cache.Add("b", 1, "1", b)
+	// a is now used more recently than b.
+	assert.Same(t, a, cache.Get("a", 1, "1"))
+
+	cache.Add("c", 1, "1", c)
+	assert.Equal(t, 1, b.closed)
+	assert.Nil(t, cache.Get("b", 1, "1"))
+	assert.Same(t, a, cache.Get("a", 1, "1"))
+	assert.Same(t, c, cache.Get("c", 1, "1"))
+	assert.Equal(t, 0, a.closed)
+	assert.Equal(t, 0, c.closed)
+
+	// At least one client is kept.
+	cache = NewCertsrvCache(0)
+	cache.Add("a", 1, "1", a)
+	assert.Same(t, a, cache.Get("a", 1, "1"))
+}
+
+func TestCertsrvCacheNotifiersAndRevoker(t *testing.T) {
+	cache := NewCertsrvCache(2)
+	notifiers := []*notify.Notifier{{Name: "ops"}}
+	revoker := &cachedRevoker{}
+
+	// Kept only with the issuer's certsrv client.
+	cache.AddNotifiers("uid", 1, notifiers)
+	cache.AddRevoker("uid", 1, "200", revoker)
+	_, ok := cache.GetNotifiers("uid", 1)
+	assert.False(t, ok)
+	assert.Nil(t, cache.GetRevoker("uid", 1, "200"))
+
+	certServ := &cachedCertsrv{}
+	cache.Add("uid", 1, "100", certServ)
+	cache.AddNotifiers("uid", 1, notifiers)
+	cache.AddRevoker("uid", 1, "200", revoker)
+	cached, ok := cache.GetNotifiers("uid", 1)
+	assert.True(t, ok)
+	assert.Equal(t, notifiers, cached)
+	assert.Same(t, revoker, cache.GetRevoker("uid", 1, "200"))
+	_, ok = cache.GetNotifiers("uid", 2)
+	assert.False(t, ok)
+
+	// The revoker is replaced when the gateway's Secret changes.
+	assert.Nil(t, cache.GetRevoker("uid", 1, "201"))
+	replacement := &cachedRevoker{}
+	cache.AddRevoker("uid", 1, "201", replacement)
+	assert.Equal(t, 1, revoker.closed)
+	assert.Same(t, replacement, cache.GetRevoker("uid", 1, "201"))
+
+	// Dropped with the certsrv client.
+	assert.Nil(t, cache.Get("uid", 2, "100"))
+	assert.Equal(t, 1, replacement.closed)
+	_, ok = cache.GetNotifiers("uid", 1)
+	assert.False(t, ok)
+	assert.Nil(t, cache.GetRevoker("uid", 1, "201"))
+}
@@ -7,59 +7,190 @@ import (
 
 	//cmapi "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
 	//cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
-	//metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/chojnack/adcs-issuer/adcs"
 	api "github.com/chojnack/adcs-issuer/api/v1"
+	"github.com/chojnack/adcs-issuer/notify"
+	"github.com/chojnack/adcs-issuer/tracing"
 )
 
 const (
-	adcsCertTemplate = "BasicSSLWebServer"
+	defaultTemplate = "BasicSSLWebServer"
 )
 
 type Issuer struct {
 	client.Client
-	certServ            adcs.AdcsCertsrv
+	certServ           adcs.AdcsCertsrv
+	throttle           *throttle
+	retryPolicy        *retryPolicy
+	strictVerification bool
+	retrievalMode      api.RetrievalMode
+	// Nil means the CA chain from ADCS is used as is.
+	chainCompleter      *adcs.ChainCompleter
 	RetryInterval       time.Duration
 	StatusCheckInterval time.Duration
+	CACheckInterval     time.Duration
+	// Zero means certificates are not re-issued on CA renewal.
+	ReissueBeforeCAExpiry time.Duration
+	// ADCS template used when the request doesn't select one.
+	Template string
+	// ADCS URL and the user the requests are sent as (for the audit).
+	URL      string
+	Username string
+	// Notifiers of the requests' and CA certificates' events.
+	Notifiers []*notify.Notifier
+	// Nil means the certificates are not revoked.
+	Revoker          adcs.Revoker
+	RevocationReason adcs.RevocationReason
+	// Nil means CA requests use the issuer's templates like the others.
+	subCA *subCAPolicy
+	// Settings for requests using templates not listed in 'templates'.
+	settings templateSettings
+	// Settings overridden per template.
+	templates map[string]templateSettings
+}
+
+// Settings that can be overridden per ADCS template.
+type templateSettings struct {
+	polling pollingPolicy
+	// Zero means no limit.
+	maxPendingDuration time.Duration
+	requireApproval    bool
+}
+
+// Get the ADCS template for the request.
+func (i *Issuer) TemplateFor(ar *api.AdcsRequest) string {
+	if ar.Spec.Template != "" {
+		return ar.Spec.Template
+	}
+	if ar.Spec.IsCA && i.subCA != nil {
+		return i.subCA.template
+	}
+	return i.Template
+}
+
+func (i *Issuer) settingsFor(ar *api.AdcsRequest) templateSettings {
+	if settings, ok := i.templates[i.TemplateFor(ar)]; ok {
+		return settings
+	}
+	return i.settings
+}
+
+// Get the time after which the pending request expires.
+// Returns nil if the request doesn't expire.
+func (i *Issuer) ExpiresAt(ar *api.AdcsRequest) *time.Time {
+	max := i.settingsFor(ar).maxPendingDuration
+	if max == 0 || ar.Status.PendingSince == nil {
+		return nil
+	}
+	expiresAt := ar.Status.PendingSince.Add(max)
+	return &expiresAt
+}
+
+// Check a pending request before its status is checked in ADCS. Returns true if it has expired,
+// otherwise the time to wait until its next scheduled check, zero if it's due.
+// The wait doesn't go past the expiry.
+func (i *Issuer) PendingWait(ar *api.AdcsRequest, now time.Time) (bool, time.Duration) {
+	expiresAt := i.ExpiresAt(ar)
+	if expiresAt != nil && !now.Before(*expiresAt) {
+		return true, 0
+	}
+	if ar.Status.NextPollAt == nil {
+		return false, 0
+	}
+	wait := ar.Status.NextPollAt.Sub(now)
+	if wait <= 0 {
+		return false, 0
+	}
+	if expiresAt != nil && expiresAt.Sub(now) < wait {
+		wait = expiresAt.Sub(now)
+	}
+	return false, wait
+}
+
+// Tells if the request may be submitted to ADCS only once approved.
+func (i *Issuer) RequiresApproval(ar *api.AdcsRequest) bool {
+	return i.settingsFor(ar).requireApproval
+}
+
+// Get the time to wait before checking the status of the pending request again.
+func (i *Issuer) NextPollInterval(ar *api.AdcsRequest) time.Duration {
+	return i.settingsFor(ar).polling.interval(ar.Status.Polls)
 }
 
 // Go to ADCS for a certificate. If current status is 'Pending' then
 // check for existing request. Otherwise ask for new.
 // The current status is set in the passed request.
 // If status is 'Ready' the returns include certificate and CA cert respectively.
+// If the issuer's rate limits don't allow talking to ADCS now a *ThrottledError is returned.
 func (i *Issuer) Issue(ctx context.Context, ar *api.AdcsRequest) ([]byte, []byte, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Issuer.Issue", trace.WithAttributes(
+		attribute.String("adcs.template", i.TemplateFor(ar)),
+		attribute.String("adcs.request.previous_state", string(ar.Status.State)),
+	))
+	cert, ca, err := i.issue(ctx, ar)
+	span.SetAttributes(
+		attribute.String("adcs.request.id", ar.Status.Id),
+		attribute.String("adcs.request.state", string(ar.Status.State)),
+	)
+	tracing.End(span, err)
+	return cert, ca, err
+}
+
+func (i *Issuer) issue(ctx context.Context, ar *api.AdcsRequest) ([]byte, []byte, error) {
 	var adcsResponseStatus adcs.AdcsResponseStatus
 	var desc string
 	var id string
 	var err error
-	if ar.Status.State != api.Unknown {
+	if ar.Status.State != api.Unknown && ar.Status.State != api.Pending {
 		// Of all the statuses only Pending requires processing.
 		// All others are final
-		if ar.Status.State == api.Pending {
-			// Check the status of the reqeust on the ADCS
-			if ar.Status.Id == "" {
-				return nil, nil, fmt.Errorf("ADCS ID not set.")
-			}
-			adcsResponseStatus, desc, id, err = i.certServ.GetExistingCertificate(ar.Status.Id)
-		} else {
-			// Nothing to do
-			return nil, nil, nil
+		// Nothing to do
+		return nil, nil, nil
+	}
+	if i.throttle != nil {
+		release, err := i.throttle.acquire(string(ar.UID))
+		if err != nil {
+			return nil, nil, err
+		}
+		defer release()
+	}
+	if ar.Status.State == api.Pending {
+		// Check the status of the reqeust on the ADCS
+		if ar.Status.Id == "" {
+			return nil, nil, fmt.Errorf("ADCS ID not set.")
 		}
+		adcsResponseStatus, desc, id, err = i.certServ.GetExistingCertificate(ctx, ar.Status.Id)
 	} else {
 		// New request
-		adcsResponseStatus, desc, id, err = i.certServ.RequestCertificate(string(ar.Spec.CSRPEM), adcsCertTemplate)
+		if err := i.checkBasicConstraints(ar); err != nil {
+			// Not sent to ADCS.
+			ar.Status.State = api.Errored
+			ar.Status.Reason = err.Error()
+			return nil, nil, nil
+		}
+		adcsResponseStatus, desc, id, err = i.certServ.RequestCertificate(ctx, string(ar.Spec.CSRPEM), i.TemplateFor(ar))
 	}
 	if err != nil {
 		// This is a local error
 		return nil, nil, err
 	}
+	if ar.Status.State == api.Unknown {
+		ar.Status.Attempts++
+	}
 
 	var cert []byte
 	switch adcsResponseStatus {
 	case adcs.Pending:
 		// It must be checked again later
+		if ar.Status.PendingSince == nil {
+			now := metav1.Now()
+			ar.Status.PendingSince = &now
+		}
 		ar.Status.State = api.Pending
 		ar.Status.Id = id
 		ar.Status.Reason = desc
@@ -81,11 +212,23 @@ func (i *Issuer) Issue(ctx context.Context, ar *api.AdcsRequest) ([]byte, []byte
 		ar.Status.Reason = desc
 	}
 
-	ca, err := i.certServ.GetCaCertificateChain()
+	if cert != nil && i.retrievalMode == api.RetrievalModeChain && id != "none" {
+		// Get the chain of the CA key that issued the certificate.
+		chainCert, ca, err := i.certServ.GetCertificateChain(ctx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		return i.completeChain(ctx, []byte(chainCert), []byte(ca))
+	}
+
+	ca, err := i.certServ.GetCaCertificateChain(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	if cert != nil {
+		return i.completeChain(ctx, cert, []byte(ca))
+	}
 	return cert, []byte(ca), nil
 
 }
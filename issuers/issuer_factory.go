@@ -9,23 +9,31 @@ import (
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	"github.com/jetstack/cert-manager/pkg/util/pki"
 
 	"github.com/chojnack/adcs-issuer/adcs"
 	api "github.com/chojnack/adcs-issuer/api/v1"
+	"github.com/chojnack/adcs-issuer/notify"
 )
 
 const (
 	defaultStatusCheckInterval = "6h"
 	defaultRetryInterval       = "1h"
+	defaultCACheckInterval     = "1h"
 )
 
 type IssuerFactory struct {
 	client.Client
 	Log                      logr.Logger
 	ClusterResourceNamespace string
+	// CertsrvCache is optional. Without it a new certsrv client is built on every call.
+	CertsrvCache *CertsrvCache
+	// Throttles is optional. Without it the issuers' rate limits are ignored.
+	Throttles *Throttles
 }
 
 func (f *IssuerFactory) GetIssuer(ctx context.Context, ref cmmeta.ObjectReference, namespace string) (*Issuer, error) {
@@ -50,41 +58,7 @@ func (f *IssuerFactory) getAdcsIssuer(ctx context.Context, key client.ObjectKey)
 	}
 	// TODO: add checking issuer status
 
-	username, password, err := f.getUserPassword(ctx, issuer.Spec.CredentialsRef.Name, issuer.Namespace)
-	if err != nil {
-		return nil, err
-	}
-
-	certs := issuer.Spec.CABundle
-	if len(certs) == 0 {
-		return nil, fmt.Errorf("CA Bundle required")
-	}
-
-	caCertPool := x509.NewCertPool()
-	ok := caCertPool.AppendCertsFromPEM(certs)
-	if ok == false {
-		return nil, fmt.Errorf("error loading ADCS CA bundle")
-	}
-
-	certServ, err := adcs.NewNtlmCertsrv(issuer.Spec.URL, username, password, caCertPool, false)
-	if err != nil {
-		return nil, err
-	}
-
-	statusCheckInterval := getInterval(
-		issuer.Spec.StatusCheckInterval,
-		defaultStatusCheckInterval,
-		log.WithValues("interval", "statusCheckInterval"))
-	retryInterval := getInterval(
-		issuer.Spec.RetryInterval,
-		defaultRetryInterval,
-		log.WithValues("interval", "retryInterval"))
-	return &Issuer{
-		f.Client,
-		certServ,
-		retryInterval,
-		statusCheckInterval,
-	}, nil
+	return f.newIssuer(ctx, log, issuer.UID, issuer.Generation, &issuer.Spec, issuer.Namespace)
 }
 
 // Get ClusterAdcsIssuer object from K8s and create Issuer
@@ -98,43 +72,233 @@ func (f *IssuerFactory) getClusterAdcsIssuer(ctx context.Context, key client.Obj
 	}
 	// TODO: add checking issuer status
 
-	username, password, err := f.getUserPassword(ctx, issuer.Spec.CredentialsRef.Name, f.ClusterResourceNamespace)
+	// Both issuer kinds share the same spec fields.
+	spec := api.AdcsIssuerSpec(issuer.Spec)
+	return f.newIssuer(ctx, log, issuer.UID, issuer.Generation, &spec, f.ClusterResourceNamespace)
+}
+
+// Create Issuer for the spec. The certsrv client, the notifiers and the revocation gateway
+// client are taken from the cache if the issuer and its credentials haven't changed since they were built.
+func (f *IssuerFactory) newIssuer(ctx context.Context, log logr.Logger, uid types.UID, generation int64, spec *api.AdcsIssuerSpec, secretNamespace string) (*Issuer, error) {
+	username, password, secretVersion, err := f.getUserPassword(ctx, spec.CredentialsRef.Name, secretNamespace)
 	if err != nil {
 		return nil, err
 	}
 
-	certs := issuer.Spec.CABundle
-	if len(certs) == 0 {
-		return nil, fmt.Errorf("CA Bundle required")
+	var certServ adcs.AdcsCertsrv
+	if f.CertsrvCache != nil {
+		certServ = f.CertsrvCache.Get(uid, generation, secretVersion)
 	}
+	if certServ == nil {
+		certs := spec.CABundle
+		if len(certs) == 0 {
+			return nil, fmt.Errorf("CA Bundle required")
+		}
+
+		caCertPool := x509.NewCertPool()
+		ok := caCertPool.AppendCertsFromPEM(certs)
+		if ok == false {
+			return nil, fmt.Errorf("error loading ADCS CA bundle")
+		}
 
-	caCertPool := x509.NewCertPool()
-	ok := caCertPool.AppendCertsFromPEM(certs)
-	if ok == false {
-		return nil, fmt.Errorf("error loading ADCS CA bundle")
+		var phrases *adcs.Phrases
+		if p := spec.Phrases; p != nil {
+			phrases = &adcs.Phrases{
+				Pending:                  p.Pending,
+				Denied:                   p.Denied,
+				DispositionMessageLabels: p.DispositionMessageLabels,
+				LastStatusLabels:         p.LastStatusLabels,
+				RequestId:                p.RequestId,
+				DispositionMessage:       p.DispositionMessage,
+			}
+		}
+		parser, err := adcs.NewPageParser(spec.PageProfile, phrases)
+		if err != nil {
+			return nil, err
+		}
+
+		certServ, err = adcs.NewNtlmCertsrv(spec.URL, username, password, caCertPool, false, parser, spec.TraceHTTP)
+		if err != nil {
+			return nil, err
+		}
+		if f.CertsrvCache != nil {
+			log.V(1).Info("Caching certsrv client")
+			f.CertsrvCache.Add(uid, generation, secretVersion, certServ)
+		}
 	}
 
-	certServ, err := adcs.NewNtlmCertsrv(issuer.Spec.URL, username, password, caCertPool, false)
-	if err != nil {
-		return nil, err
+	var throttle *throttle
+	if f.Throttles != nil {
+		throttle, err = f.Throttles.get(spec.URL, uid, spec.RateLimit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var chainCompleter *adcs.ChainCompleter
+	if cc := spec.ChainCompletion; cc != nil {
+		var anchors []*x509.Certificate
+		if len(cc.TrustAnchors) > 0 {
+			anchors, err = pki.DecodeX509CertificateChainBytes(cc.TrustAnchors)
+			if err != nil {
+				return nil, fmt.Errorf("error loading chain completion trust anchors: %v", err)
+			}
+		}
+		chainCompleter = adcs.NewChainCompleter(cc.AllowedHosts, anchors)
 	}
 
 	statusCheckInterval := getInterval(
-		issuer.Spec.StatusCheckInterval,
+		spec.StatusCheckInterval,
 		defaultStatusCheckInterval,
 		log.WithValues("interval", "statusCheckInterval"))
 	retryInterval := getInterval(
-		issuer.Spec.RetryInterval,
+		spec.RetryInterval,
 		defaultRetryInterval,
 		log.WithValues("interval", "retryInterval"))
+	template := spec.Template
+	if template == "" {
+		template = defaultTemplate
+	}
+	settings := templateSettings{
+		polling: getPollingPolicy(spec.PollingPolicy, pollingPolicy{
+			initialInterval: statusCheckInterval,
+			multiplier:      1,
+		}, log.WithValues("policy", "pollingPolicy")),
+		maxPendingDuration: getInterval(spec.MaxPendingDuration, "0s", log.WithValues("interval", "maxPendingDuration")),
+		requireApproval:    spec.RequireApproval,
+	}
+	templates := make(map[string]templateSettings, len(spec.Templates))
+	for _, t := range spec.Templates {
+		tlog := log.WithValues("template", t.Name)
+		templates[t.Name] = templateSettings{
+			polling:            getPollingPolicy(t.PollingPolicy, settings.polling, tlog.WithValues("policy", "pollingPolicy")),
+			maxPendingDuration: getInterval(t.MaxPendingDuration, settings.maxPendingDuration.String(), tlog.WithValues("interval", "maxPendingDuration")),
+			requireApproval:    settings.requireApproval || t.RequireApproval,
+		}
+	}
+
+	notifiers, err := f.getNotifiers(log, uid, generation, spec.Notifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	var revoker adcs.Revoker
+	var revocationReason adcs.RevocationReason
+	if r := spec.Revocation; r != nil {
+		if revoker, err = f.getRevoker(ctx, uid, generation, r, secretNamespace); err != nil {
+			return nil, err
+		}
+		if revocationReason, err = adcs.ParseRevocationReason(string(r.Reason)); err != nil {
+			return nil, err
+		}
+	}
+
 	return &Issuer{
-		f.Client,
-		certServ,
-		retryInterval,
-		statusCheckInterval,
+		Client:                f.Client,
+		certServ:              certServ,
+		throttle:              throttle,
+		retryPolicy:           getRetryPolicy(spec.RetryPolicy, log.WithValues("policy", "retryPolicy")),
+		strictVerification:    spec.StrictVerification,
+		retrievalMode:         spec.RetrievalMode,
+		chainCompleter:        chainCompleter,
+		RetryInterval:         retryInterval,
+		StatusCheckInterval:   statusCheckInterval,
+		CACheckInterval:       getInterval(spec.CACheckInterval, defaultCACheckInterval, log.WithValues("interval", "caCheckInterval")),
+		ReissueBeforeCAExpiry: getInterval(spec.ReissueBeforeCAExpiry, "0s", log.WithValues("interval", "reissueBeforeCAExpiry")),
+		Template:              template,
+		URL:                   spec.URL,
+		Username:              username,
+		Notifiers:             notifiers,
+		Revoker:               revoker,
+		RevocationReason:      revocationReason,
+		subCA:                 getSubCAPolicy(spec.SubCA),
+		settings:              settings,
+		templates:             templates,
 	}, nil
 }
 
+// Get the issuer's notifiers from the cache or create them.
+func (f *IssuerFactory) getNotifiers(log logr.Logger, uid types.UID, generation int64, specs []api.Notifier) ([]*notify.Notifier, error) {
+	if f.CertsrvCache != nil {
+		if notifiers, ok := f.CertsrvCache.GetNotifiers(uid, generation); ok {
+			return notifiers, nil
+		}
+	}
+	notifiers := make([]*notify.Notifier, 0, len(specs))
+	for _, n := range specs {
+		nlog := log.WithValues("notifier", n.Name)
+		events := make([]notify.Event, 0, len(n.Events))
+		for _, event := range n.Events {
+			events = append(events, notify.Event(event))
+		}
+		notifier, err := notify.NewNotifier(notify.Config{
+			Name:              n.Name,
+			URL:               n.URL,
+			Events:            events,
+			Template:          n.Template,
+			PendingThreshold:  getInterval(n.PendingThreshold, "24h", nlog.WithValues("interval", "pendingThreshold")),
+			CAExpiryThreshold: getInterval(n.CAExpiryThreshold, "720h", nlog.WithValues("interval", "caExpiryThreshold")),
+			MaxAttempts:       n.MaxAttempts,
+		})
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	if f.CertsrvCache != nil {
+		f.CertsrvCache.AddNotifiers(uid, generation, notifiers)
+	}
+	return notifiers, nil
+}
+
+// Get the revocation gateway client from the cache or create it with the credentials
+// from the secret, if any. The cached client is used while the secret is unchanged.
+func (f *IssuerFactory) getRevoker(ctx context.Context, uid types.UID, generation int64, r *api.Revocation, secretNamespace string) (adcs.Revoker, error) {
+	var secret *corev1.Secret
+	var secretVersion string
+	if r.CredentialsRef != nil {
+		secret = new(corev1.Secret)
+		if err := f.Client.Get(ctx, client.ObjectKey{Namespace: secretNamespace, Name: r.CredentialsRef.Name}, secret); err != nil {
+			return nil, err
+		}
+		secretVersion = secret.ResourceVersion
+	}
+	if f.CertsrvCache != nil {
+		if revoker := f.CertsrvCache.GetRevoker(uid, generation, secretVersion); revoker != nil {
+			return revoker, nil
+		}
+	}
+	revoker, err := newRevoker(r, secret)
+	if err != nil {
+		return nil, err
+	}
+	if f.CertsrvCache != nil {
+		f.CertsrvCache.AddRevoker(uid, generation, secretVersion, revoker)
+	}
+	return revoker, nil
+}
+
+// Create the revocation gateway client with the credentials from the secret, if any.
+func newRevoker(r *api.Revocation, secret *corev1.Secret) (adcs.Revoker, error) {
+	var caCertPool *x509.CertPool
+	if len(r.CABundle) > 0 {
+		caCertPool = x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(r.CABundle) {
+			return nil, fmt.Errorf("error loading revocation gateway CA bundle")
+		}
+	}
+	var username, password, token string
+	if secret != nil {
+		token = string(secret.Data["token"])
+		username = string(secret.Data["username"])
+		password = string(secret.Data["password"])
+		if token == "" && username == "" {
+			return nil, fmt.Errorf("Neither token nor user name set in revocation gateway secret")
+		}
+	}
+	return adcs.NewHttpRevoker(r.URL, caCertPool, username, password, token), nil
+}
+
 func getInterval(specValue string, def string, log logr.Logger) time.Duration {
 	interval, _ := time.ParseDuration(def)
 	if specValue != "" {
@@ -145,23 +309,24 @@ func getInterval(specValue string, def string, log logr.Logger) time.Duration {
 			interval = i
 		}
 	} else {
-		log.Info("Using default")
+		log.V(1).Info("Using default")
 	}
 	return interval
 }
 
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 
-func (f *IssuerFactory) getUserPassword(ctx context.Context, secretName string, namespace string) (string, string, error) {
+// Returns (username, password, secret's resourceVersion, error)
+func (f *IssuerFactory) getUserPassword(ctx context.Context, secretName string, namespace string) (string, string, string, error) {
 	secret := new(corev1.Secret)
 	if err := f.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: secretName}, secret); err != nil {
-		return "", "", err
+		return "", "", "", err
 	}
 	if _, ok := secret.Data["username"]; !ok {
-		return "", "", fmt.Errorf("User name not set in secret")
+		return "", "", "", fmt.Errorf("User name not set in secret")
 	}
 	if _, ok := secret.Data["password"]; !ok {
-		return "", "", fmt.Errorf("Password not set in secret")
+		return "", "", "", fmt.Errorf("Password not set in secret")
 	}
-	return string(secret.Data["username"]), string(secret.Data["password"]), nil
+	return string(secret.Data["username"]), string(secret.Data["password"]), secret.ResourceVersion, nil
 }
@@ -0,0 +1,75 @@
+package issuers
+
+import (
+	"context"
+	"testing"
+
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+func TestIssuerFactoryCachesClients(t *testing.T) {
+	ctx := context.Background()
+	issuer := &api.AdcsIssuer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "adcs", UID: "uid-adcs", Generation: 1},
+		Spec: api.AdcsIssuerSpec{
+			URL:            "https://adcs.example.com/certsrv",
+			CredentialsRef: api.LocalObjectReference{Name: "adcs-credentials"},
+			Notifiers:      []api.Notifier{{Name: "ops", URL: "https://hooks.example.com"}},
+			Revocation: &api.Revocation{
+				URL:            "https://revocation.example.com",
+				CredentialsRef: &api.LocalObjectReference{Name: "revocation-credentials"},
+			},
+		},
+	}
+	secret := func(name string, data map[string]string) *corev1.Secret {
+		s := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: name}, Data: map[string][]byte{}}
+		for k, v := range data {
+			s.Data[k] = []byte(v)
+		}
+		return s
+	}
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, api.AddToScheme(scheme))
+	c := fake.NewFakeClientWithScheme(scheme, issuer,
+		secret("adcs-credentials", map[string]string{"username": "user", "password": "password"}),
+		secret("revocation-credentials", map[string]string{"token": "token"}))
+	credentials := new(corev1.Secret)
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "team", Name: "adcs-credentials"}, credentials))
+	cache := NewCertsrvCache(1)
+	cache.Add(issuer.UID, issuer.Generation, credentials.ResourceVersion, &cachedCertsrv{})
+	factory := IssuerFactory{Client: c, Log: logf.NullLogger{}, CertsrvCache: cache}
+	ref := cmmeta.ObjectReference{Kind: "AdcsIssuer", Name: "adcs"}
+
+	first, err := factory.GetIssuer(ctx, ref, "team")
+	require.NoError(t, err)
+	require.Len(t, first.Notifiers, 1)
+	require.NotNil(t, first.Revoker)
+
+	// Reused while the issuer and the Secrets are unchanged.
+	second, err := factory.GetIssuer(ctx, ref, "team")
+	require.NoError(t, err)
+	assert.Same(t, first.Notifiers[0], second.Notifiers[0])
+	assert.Same(t, first.Revoker, second.Revoker)
+
+	// A new revocation gateway client once its Secret changes.
+	revocation := new(corev1.Secret)
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "team", Name: "revocation-credentials"}, revocation))
+	revocation.Data["token"] = []byte("new token")
+	require.NoError(t, c.Update(ctx, revocation))
+	third, err := factory.GetIssuer(ctx, ref, "team")
+	require.NoError(t, err)
+	assert.Same(t, first.Notifiers[0], third.Notifiers[0])
+	assert.NotSame(t, first.Revoker, third.Revoker)
+}
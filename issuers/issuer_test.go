@@ -0,0 +1,96 @@
+package issuers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+// An issuer expiring requests pending for an hour, or a day for the 'Slow' template.
+func testExpiringIssuer() *Issuer {
+	return &Issuer{
+		Template: "WebServer",
+		settings: templateSettings{maxPendingDuration: time.Hour},
+		templates: map[string]templateSettings{
+			"Slow":      {maxPendingDuration: 24 * time.Hour},
+			"Unlimited": {},
+		},
+	}
+}
+
+func pendingRequest(template string, pendingSince time.Time, nextPollAt *time.Time) *api.AdcsRequest {
+	since := metav1.NewTime(pendingSince)
+	ar := &api.AdcsRequest{
+		Spec:   api.AdcsRequestSpec{Template: template},
+		Status: api.AdcsRequestStatus{State: api.Pending, PendingSince: &since},
+	}
+	if nextPollAt != nil {
+		next := metav1.NewTime(*nextPollAt)
+		ar.Status.NextPollAt = &next
+	}
+	return ar
+}
+
+func TestExpiresAt(t *testing.T) {
+	issuer := testExpiringIssuer()
+	since := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name     string
+		ar       *api.AdcsRequest
+		expected time.Duration
+		expires  bool
+	}{
+		{"issuer's limit", pendingRequest("", since, nil), time.Hour, true},
+		{"template's limit", pendingRequest("Slow", since, nil), 24 * time.Hour, true},
+		{"template without limit", pendingRequest("Unlimited", since, nil), 0, false},
+		{"not pending", &api.AdcsRequest{Status: api.AdcsRequestStatus{State: api.Unknown}}, 0, false},
+	}
+	for _, test := range tests {
+		expiresAt := issuer.ExpiresAt(test.ar)
+		if !test.expires {
+			assert.Nil(t, expiresAt, test.name)
+			continue
+		}
+		if assert.NotNil(t, expiresAt, test.name) {
+			assert.Equal(t, since.Add(test.expected), *expiresAt, test.name)
+		}
+	}
+
+	// No limit set on the issuer.
+	assert.Nil(t, (&Issuer{}).ExpiresAt(pendingRequest("", since, nil)))
+}
+
+func TestPendingWait(t *testing.T) {
+	issuer := testExpiringIssuer()
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name    string
+		ar      *api.AdcsRequest
+		expired bool
+		wait    time.Duration
+	}{
+		{"poll due", pendingRequest("", now.Add(-time.Minute), at(-time.Second)), false, 0},
+		{"no poll scheduled", pendingRequest("", now.Add(-time.Minute), nil), false, 0},
+		{"poll scheduled", pendingRequest("", now.Add(-time.Minute), at(10*time.Minute)), false, 10 * time.Minute},
+		{"poll scheduled after the expiry", pendingRequest("", now.Add(-50*time.Minute), at(30*time.Minute)), false, 10 * time.Minute},
+		{"expired", pendingRequest("", now.Add(-time.Hour), at(10*time.Minute)), true, 0},
+		{"expired long ago", pendingRequest("", now.Add(-48*time.Hour), nil), true, 0},
+		{"template's limit", pendingRequest("Slow", now.Add(-2*time.Hour), at(time.Hour)), false, time.Hour},
+		{"template without limit", pendingRequest("Unlimited", now.Add(-48*time.Hour), at(time.Hour)), false, time.Hour},
+	}
+	for _, test := range tests {
+		expired, wait := issuer.PendingWait(test.ar, now)
+		assert.Equal(t, test.expired, expired, test.name)
+		assert.Equal(t, test.wait, wait, test.name)
+	}
+}
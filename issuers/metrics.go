@@ -0,0 +1,27 @@
+package issuers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	throttledTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "adcs_issuer_throttled_requests_total",
+			Help: "Number of ADCS requests held back by the issuer's rate limits.",
+		},
+		[]string{"endpoint", "reason"},
+	)
+	inFlightRequests = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "adcs_issuer_inflight_requests",
+			Help: "Number of requests currently in flight to ADCS servers with rate limits set.",
+		},
+		[]string{"endpoint"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(throttledTotal, inFlightRequests)
+}
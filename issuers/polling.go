@@ -0,0 +1,80 @@
+package issuers
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+// Shortest and longest interval between the status checks of a request, whatever the policy.
+// The longest also keeps the growing intervals of policies without maxInterval within a time.Duration.
+const (
+	minPollingInterval = time.Second
+	maxPollingInterval = 7 * 24 * time.Hour
+)
+
+// pollingPolicy is the parsed api.PollingPolicy.
+type pollingPolicy struct {
+	initialInterval time.Duration
+	multiplier      float64
+	maxInterval     time.Duration
+	jitter          float64
+}
+
+// Parse the policy. Values not set in spec are taken from def.
+func getPollingPolicy(spec *api.PollingPolicy, def pollingPolicy, log logr.Logger) pollingPolicy {
+	policy := def
+	if spec == nil {
+		return policy
+	}
+	if spec.InitialInterval != "" {
+		policy.initialInterval = getInterval(spec.InitialInterval, def.initialInterval.String(), log.WithValues("interval", "initialInterval"))
+	}
+	if spec.MaxInterval != "" {
+		policy.maxInterval = getInterval(spec.MaxInterval, def.maxInterval.String(), log.WithValues("interval", "maxInterval"))
+	}
+	policy.multiplier = getFactor(spec.Multiplier, def.multiplier, log.WithValues("factor", "multiplier"))
+	policy.jitter = getFactor(spec.Jitter, def.jitter, log.WithValues("factor", "jitter"))
+	if policy.jitter > 1 {
+		log.Info("Jitter greater than 1. Using default.", "value", spec.Jitter)
+		policy.jitter = def.jitter
+	}
+	return policy
+}
+
+// Interval to wait before the next status check of a request that has been checked 'polls' times.
+func (p pollingPolicy) interval(polls int) time.Duration {
+	maxInterval := maxPollingInterval
+	if p.maxInterval > 0 && p.maxInterval < maxInterval {
+		maxInterval = p.maxInterval
+	}
+	interval := float64(p.initialInterval) * math.Pow(p.multiplier, float64(polls))
+	// Also true for the infinite (or NaN) intervals of many polls.
+	if !(interval <= float64(maxInterval)) {
+		interval = float64(maxInterval)
+	}
+	if p.jitter > 0 {
+		interval += interval * p.jitter * (2*rand.Float64() - 1)
+	}
+	if interval < float64(minPollingInterval) {
+		return minPollingInterval
+	}
+	return time.Duration(interval)
+}
+
+func getFactor(specValue string, def float64, log logr.Logger) float64 {
+	if specValue == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(specValue, 64)
+	if err != nil || f < 0 {
+		log.Error(err, "Cannot parse factor. Using default.", "value", specValue)
+		return def
+	}
+	return f
+}
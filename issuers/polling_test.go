@@ -0,0 +1,45 @@
+package issuers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+func TestPollingPolicyInterval(t *testing.T) {
+	def := pollingPolicy{initialInterval: time.Minute, multiplier: 1}
+	policy := getPollingPolicy(&api.PollingPolicy{InitialInterval: "10s", Multiplier: "2", MaxInterval: "1m"}, def, logf.NullLogger{})
+	assert.Equal(t, 10*time.Second, policy.interval(0))
+	assert.Equal(t, 40*time.Second, policy.interval(2))
+	assert.Equal(t, time.Minute, policy.interval(5))
+
+	// The jitter is limited to the interval.
+	policy = getPollingPolicy(&api.PollingPolicy{Jitter: "5"}, def, logf.NullLogger{})
+	assert.Equal(t, 0.0, policy.jitter)
+	policy = getPollingPolicy(&api.PollingPolicy{Jitter: "1"}, def, logf.NullLogger{})
+	for i := 0; i < 100; i++ {
+		interval := policy.interval(0)
+		assert.True(t, interval >= minPollingInterval && interval <= 2*time.Minute, interval)
+	}
+
+	// Never shorter than the minimum.
+	policy = getPollingPolicy(&api.PollingPolicy{InitialInterval: "0s"}, def, logf.NullLogger{})
+	assert.Equal(t, minPollingInterval, policy.interval(0))
+
+	// Never longer than the maximum, even when the interval overflows without maxInterval.
+	for _, spec := range []*api.PollingPolicy{
+		{InitialInterval: "10s", Multiplier: "2"},
+		{InitialInterval: "10s", Multiplier: "2", MaxInterval: "8760h"},
+		{InitialInterval: "10s", Multiplier: "Inf"},
+		{InitialInterval: "0s", Multiplier: "Inf"},
+	} {
+		policy = getPollingPolicy(spec, def, logf.NullLogger{})
+		for _, polls := range []int{100, 10000} {
+			assert.Equal(t, maxPollingInterval, policy.interval(polls), "%+v after %d polls", spec, polls)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package issuers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+const (
+	defaultMaxAttempts = 3
+	defaultBackoff     = "5m"
+	defaultMaxBackoff  = "1h"
+)
+
+// Disposition codes treated as transient when the retry policy doesn't list any.
+var defaultTransientCodes = []string{
+	"0x800706ba", // RPC_S_SERVER_UNAVAILABLE
+	"0x800706be", // RPC_S_CALL_FAILED
+	"0x800706bf", // RPC_S_CALL_FAILED_DNE
+	"0x80070015", // ERROR_NOT_READY
+	"0x800705b4", // ERROR_TIMEOUT
+	"0x8007000e", // E_OUTOFMEMORY
+}
+
+// retryPolicy is the parsed api.RetryPolicy.
+type retryPolicy struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	codes       []string
+}
+
+func getRetryPolicy(spec *api.RetryPolicy, log logr.Logger) *retryPolicy {
+	if spec == nil {
+		return nil
+	}
+	policy := &retryPolicy{
+		maxAttempts: spec.MaxAttempts,
+		backoff:     getInterval(spec.Backoff, defaultBackoff, log.WithValues("interval", "backoff")),
+		maxBackoff:  getInterval(spec.MaxBackoff, defaultMaxBackoff, log.WithValues("interval", "maxBackoff")),
+	}
+	if policy.maxAttempts < 1 {
+		policy.maxAttempts = defaultMaxAttempts
+	}
+	codes := spec.DispositionCodes
+	if len(codes) == 0 {
+		codes = defaultTransientCodes
+	}
+	for _, code := range codes {
+		policy.codes = append(policy.codes, strings.ToLower(code))
+	}
+	return policy
+}
+
+// Check if the errored request should be submitted again.
+// Returns the time to wait before re-submitting and true if so.
+func (i *Issuer) RetryErrored(ar *api.AdcsRequest) (time.Duration, bool) {
+	p := i.retryPolicy
+	if p == nil || ar.Status.State != api.Errored {
+		return 0, false
+	}
+	attempts := ar.Status.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts >= p.maxAttempts || !p.transient(ar.Status.Reason) {
+		return 0, false
+	}
+	backoff := p.backoff
+	for n := 1; n < attempts && backoff < p.maxBackoff; n++ {
+		backoff *= 2
+	}
+	if backoff > p.maxBackoff {
+		backoff = p.maxBackoff
+	}
+	return backoff, true
+}
+
+// The disposition code is a part of the ADCS status message e.g.
+// "... 0x800706ba (WIN32: 1722 RPC_S_SERVER_UNAVAILABLE)"
+func (p *retryPolicy) transient(reason string) bool {
+	reason = strings.ToLower(reason)
+	for _, code := range p.codes {
+		if strings.Contains(reason, code) {
+			return true
+		}
+	}
+	return false
+}
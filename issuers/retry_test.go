@@ -0,0 +1,61 @@
+package issuers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+func erroredRequest(reason string, attempts int) *api.AdcsRequest {
+	return &api.AdcsRequest{Status: api.AdcsRequestStatus{State: api.Errored, Reason: reason, Attempts: attempts}}
+}
+
+func TestGetRetryPolicy(t *testing.T) {
+	assert.Nil(t, getRetryPolicy(nil, logf.NullLogger{}))
+
+	p := getRetryPolicy(&api.RetryPolicy{}, logf.NullLogger{})
+	assert.Equal(t, defaultMaxAttempts, p.maxAttempts)
+	assert.Equal(t, 5*time.Minute, p.backoff)
+	assert.Equal(t, time.Hour, p.maxBackoff)
+	assert.Equal(t, defaultTransientCodes, p.codes)
+
+	p = getRetryPolicy(&api.RetryPolicy{MaxAttempts: 5, Backoff: "1m", MaxBackoff: "10m", DispositionCodes: []string{"0x8007000D"}}, logf.NullLogger{})
+	assert.Equal(t, 5, p.maxAttempts)
+	assert.Equal(t, time.Minute, p.backoff)
+	assert.Equal(t, 10*time.Minute, p.maxBackoff)
+	assert.Equal(t, []string{"0x8007000d"}, p.codes)
+}
+
+func TestRetryErrored(t *testing.T) {
+	issuer := &Issuer{retryPolicy: getRetryPolicy(&api.RetryPolicy{MaxAttempts: 5, Backoff: "1m", MaxBackoff: "3m"}, logf.NullLogger{})}
+	transient := "Denied by Policy Module 0x800706BA (WIN32: 1722 RPC_S_SERVER_UNAVAILABLE)"
+
+	// The backoff doubles with the attempts up to the maximum.
+	for attempts, expected := range map[int]time.Duration{0: time.Minute, 1: time.Minute, 2: 2 * time.Minute, 3: 3 * time.Minute, 4: 3 * time.Minute} {
+		after, retry := issuer.RetryErrored(erroredRequest(transient, attempts))
+		assert.True(t, retry, "attempts %d", attempts)
+		assert.Equal(t, expected, after, "attempts %d", attempts)
+	}
+
+	// Out of attempts.
+	_, retry := issuer.RetryErrored(erroredRequest(transient, 5))
+	assert.False(t, retry)
+
+	// Not a transient error.
+	_, retry = issuer.RetryErrored(erroredRequest("Denied by Policy Module 0x80094801 (CERTSRV_E_NO_CERT_TYPE)", 1))
+	assert.False(t, retry)
+
+	// Not errored.
+	ar := erroredRequest(transient, 1)
+	ar.Status.State = api.Rejected
+	_, retry = issuer.RetryErrored(ar)
+	assert.False(t, retry)
+
+	// No retry policy.
+	_, retry = (&Issuer{}).RetryErrored(erroredRequest(transient, 1))
+	assert.False(t, retry)
+}
@@ -0,0 +1,122 @@
+package issuers
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/chojnack/adcs-issuer/adcs"
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+// Issuance of subordinate CA certificates.
+type subCAPolicy struct {
+	template string
+	// Negative means not limited.
+	maxPathLen int
+}
+
+func getSubCAPolicy(spec *api.SubCA) *subCAPolicy {
+	if spec == nil {
+		return nil
+	}
+	p := &subCAPolicy{template: spec.Template, maxPathLen: -1}
+	if spec.MaxPathLen != nil {
+		p.maxPathLen = *spec.MaxPathLen
+	}
+	return p
+}
+
+var oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+
+// The basic constraints extension (RFC 5280, 4.2.1.9).
+type basicConstraints struct {
+	IsCA       bool `asn1:"optional"`
+	MaxPathLen int  `asn1:"optional,default:-1"`
+}
+
+// Check the basic constraints of the request's CSR before it's submitted. The CSR must not
+// ask for a CA certificate unless the request is for a CA, and not for a longer path than the
+// issuer allows. A CSR without basic constraints (as cert-manager creates them) is accepted,
+// the constraints are then up to the ADCS template and checked in the issued certificate.
+func (i *Issuer) checkBasicConstraints(ar *api.AdcsRequest) error {
+	csr, err := parseCSR(ar.Spec.CSRPEM)
+	if err != nil {
+		return err
+	}
+	for _, ext := range csr.Extensions {
+		if !ext.Id.Equal(oidExtensionBasicConstraints) {
+			continue
+		}
+		var bc basicConstraints
+		if rest, err := asn1.Unmarshal(ext.Value, &bc); err != nil || len(rest) > 0 {
+			return fmt.Errorf("CSR has invalid basic constraints")
+		}
+		switch {
+		case bc.IsCA && !ar.Spec.IsCA:
+			return fmt.Errorf("CSR asks for a CA certificate (CA:TRUE) but the request isn't for a CA")
+		case !bc.IsCA && ar.Spec.IsCA:
+			return fmt.Errorf("CSR basic constraints are CA:FALSE but the request is for a CA")
+		case bc.IsCA && i.subCA != nil && i.subCA.maxPathLen >= 0 && (bc.MaxPathLen < 0 || bc.MaxPathLen > i.subCA.maxPathLen):
+			return fmt.Errorf("CSR path length %s exceeds the issuer's maximum %d", pathLenString(bc.MaxPathLen), i.subCA.maxPathLen)
+		}
+	}
+	return nil
+}
+
+// Check that the certificate issued for a CA request can sign certificates
+// within the issuer's path length.
+func (i *Issuer) verifyCACertificate(cert *x509.Certificate) error {
+	if !cert.BasicConstraintsValid || !cert.IsCA {
+		return fmt.Errorf("certificate is not a CA certificate (CA:TRUE), check the ADCS template")
+	}
+	if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return fmt.Errorf("CA certificate doesn't allow certificate signing")
+	}
+	if i.subCA != nil && i.subCA.maxPathLen >= 0 && (cert.MaxPathLen < 0 || cert.MaxPathLen > i.subCA.maxPathLen) {
+		return fmt.Errorf("CA certificate path length %s exceeds the issuer's maximum %d", pathLenString(cert.MaxPathLen), i.subCA.maxPathLen)
+	}
+	return nil
+}
+
+func pathLenString(pathLen int) string {
+	if pathLen < 0 {
+		return "unlimited"
+	}
+	return fmt.Sprint(pathLen)
+}
+
+// Get the full chain of an issued CA certificate as cert-manager's CA issuer expects it in
+// its Secret: the certificate followed by its intermediate CAs, and the root CA.
+// An error is returned if the CA certificates don't chain up to a self-signed root.
+func (i *Issuer) SubCAChain(certPEM []byte, caPEM []byte) ([]byte, []byte, error) {
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	cas, err := parseCertificates(caPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	chain := []*x509.Certificate{cert}
+	for current := cert; !adcs.IsSelfSigned(current); {
+		parent := findIssuer(current, cas)
+		if parent == nil || len(chain) > len(cas) {
+			return nil, nil, fmt.Errorf("CA chain doesn't reach a root CA, no issuer of %s found (see chainCompletion)", current.Subject)
+		}
+		chain = append(chain, parent)
+		current = parent
+	}
+	last := len(chain) - 1
+	return adcs.EncodeCertificatesPem(chain[:last]), adcs.EncodeCertificatesPem(chain[last:]), nil
+}
+
+func findIssuer(cert *x509.Certificate, cas []*x509.Certificate) *x509.Certificate {
+	for _, ca := range cas {
+		if bytes.Equal(cert.RawIssuer, ca.RawSubject) && cert.CheckSignatureFrom(ca) == nil {
+			return ca
+		}
+	}
+	return nil
+}
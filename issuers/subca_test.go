@@ -0,0 +1,137 @@
+package issuers
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chojnack/adcs-issuer/adcs"
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+func basicConstraintsExtension(t *testing.T, isCA bool, maxPathLen int) pkix.Extension {
+	value, err := asn1.Marshal(basicConstraints{IsCA: isCA, MaxPathLen: maxPathLen})
+	require.NoError(t, err)
+	return pkix.Extension{Id: oidExtensionBasicConstraints, Critical: true, Value: value}
+}
+
+func testSubCAIssuer(maxPathLen int) *Issuer {
+	return &Issuer{subCA: getSubCAPolicy(&api.SubCA{Template: "SubCA", MaxPathLen: &maxPathLen})}
+}
+
+func TestCheckBasicConstraints(t *testing.T) {
+	issuer := testSubCAIssuer(0)
+	key := newTestKey(t)
+	subject := pkix.Name{CommonName: "Team CA"}
+
+	// cert-manager's CSRs have no basic constraints.
+	ar, _ := newTestRequest(t, key, &x509.CertificateRequest{Subject: subject})
+	assert.NoError(t, issuer.checkBasicConstraints(ar))
+	ar.Spec.IsCA = true
+	assert.NoError(t, issuer.checkBasicConstraints(ar))
+
+	ar, _ = newTestRequest(t, key, &x509.CertificateRequest{Subject: subject, ExtraExtensions: []pkix.Extension{basicConstraintsExtension(t, true, 0)}})
+	ar.Spec.IsCA = true
+	assert.NoError(t, issuer.checkBasicConstraints(ar))
+	ar.Spec.IsCA = false
+	assert.Error(t, issuer.checkBasicConstraints(ar), "CA CSR of a request that isn't for a CA")
+
+	ar, _ = newTestRequest(t, key, &x509.CertificateRequest{Subject: subject, ExtraExtensions: []pkix.Extension{basicConstraintsExtension(t, false, -1)}})
+	ar.Spec.IsCA = true
+	assert.Error(t, issuer.checkBasicConstraints(ar), "non-CA CSR of a CA request")
+
+	ar, _ = newTestRequest(t, key, &x509.CertificateRequest{Subject: subject, ExtraExtensions: []pkix.Extension{basicConstraintsExtension(t, true, 1)}})
+	ar.Spec.IsCA = true
+	assert.Error(t, issuer.checkBasicConstraints(ar), "path length over the maximum")
+	assert.NoError(t, testSubCAIssuer(1).checkBasicConstraints(ar))
+	assert.NoError(t, testSubCAIssuer(-1).checkBasicConstraints(ar))
+}
+
+func TestVerifyCACertificate(t *testing.T) {
+	root := newTestCA(t, "Test Root", nil)
+	ar, csr := newTestRequest(t, newTestKey(t), &x509.CertificateRequest{Subject: pkix.Name{CommonName: "Team CA"}})
+	caTemplate := func(pathLen int) func(*x509.Certificate) {
+		return func(c *x509.Certificate) {
+			c.BasicConstraintsValid = true
+			c.IsCA = true
+			c.MaxPathLen = pathLen
+			c.MaxPathLenZero = pathLen == 0
+			c.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+			c.ExtKeyUsage = nil
+		}
+	}
+	issuer := testSubCAIssuer(0)
+
+	_, err := issuer.VerifyCertificate(ar, root.issueForCSR(t, csr, caTemplate(0)), root.pem(), nil, true)
+	assert.NoError(t, err)
+
+	_, err = issuer.VerifyCertificate(ar, root.issueForCSR(t, csr, nil), root.pem(), nil, true)
+	assert.EqualError(t, err, "certificate is not a CA certificate (CA:TRUE), check the ADCS template")
+
+	_, err = issuer.VerifyCertificate(ar, root.issueForCSR(t, csr, caTemplate(2)), root.pem(), nil, true)
+	assert.EqualError(t, err, "CA certificate path length 2 exceeds the issuer's maximum 0")
+
+	noCertSign := root.issueForCSR(t, csr, func(c *x509.Certificate) {
+		caTemplate(0)(c)
+		c.KeyUsage = x509.KeyUsageDigitalSignature
+	})
+	_, err = issuer.VerifyCertificate(ar, noCertSign, root.pem(), nil, true)
+	assert.EqualError(t, err, "CA certificate doesn't allow certificate signing")
+}
+
+func TestVerifyCACertificateForNonCARequest(t *testing.T) {
+	root := newTestCA(t, "Test Root", nil)
+	ar, csr := newTestRequest(t, newTestKey(t), &x509.CertificateRequest{Subject: pkix.Name{CommonName: "app.example.com"}})
+	cert := root.issueForCSR(t, csr, func(c *x509.Certificate) {
+		c.BasicConstraintsValid = true
+		c.IsCA = true
+	})
+
+	// Whatever the verification mode and the issuer's SubCA policy.
+	for _, issuer := range []*Issuer{{}, {strictVerification: true}, testSubCAIssuer(-1)} {
+		_, err := issuer.VerifyCertificate(ar, cert, root.pem(), nil, false)
+		assert.EqualError(t, err, "CA certificate (CA:TRUE) issued for a request that isn't for a CA, check the ADCS template")
+	}
+
+	// A CA:FALSE certificate is fine.
+	cert = root.issueForCSR(t, csr, func(c *x509.Certificate) {
+		c.BasicConstraintsValid = true
+	})
+	_, err := (&Issuer{}).VerifyCertificate(ar, cert, root.pem(), nil, false)
+	assert.NoError(t, err)
+}
+
+func TestSubCAChain(t *testing.T) {
+	root := newTestCA(t, "Test Root", nil)
+	intermediate := newTestCA(t, "Test Intermediate", root)
+	_, csr := newTestRequest(t, newTestKey(t), &x509.CertificateRequest{Subject: pkix.Name{CommonName: "Team CA"}})
+	certPEM := intermediate.issueForCSR(t, csr, func(c *x509.Certificate) {
+		c.BasicConstraintsValid = true
+		c.IsCA = true
+	})
+	cert, err := parseCertificate(certPEM)
+	require.NoError(t, err)
+	issuer := &Issuer{}
+
+	// The CA certificates in any order, with one not in the chain.
+	other := newTestCA(t, "Other Root", nil)
+	chain, ca, err := issuer.SubCAChain(certPEM, adcs.EncodeCertificatesPem([]*x509.Certificate{root.cert, other.cert, intermediate.cert}))
+	require.NoError(t, err)
+	assert.Equal(t, adcs.EncodeCertificatesPem([]*x509.Certificate{cert, intermediate.cert}), chain)
+	assert.Equal(t, root.pem(), ca)
+
+	// Issued by the root.
+	direct := root.issueForCSR(t, csr, nil)
+	chain, ca, err = issuer.SubCAChain(direct, root.pem())
+	require.NoError(t, err)
+	assert.Equal(t, direct, chain)
+	assert.Equal(t, root.pem(), ca)
+
+	// Without the root.
+	_, _, err = issuer.SubCAChain(certPEM, intermediate.pem())
+	assert.Error(t, err)
+}
@@ -0,0 +1,264 @@
+package issuers
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+const (
+	// How long to wait before re-trying a request held back by the concurrency cap.
+	concurrencyRetryInterval = 2 * time.Second
+	// Queued requests not asking for admission again within this time are passed over by the ones
+	// behind them, e.g. finished or deleted requests or requests re-queued for longer.
+	throttleQueueActive = 3 * concurrencyRetryInterval
+	// Queued requests not seen again within this time are forgotten.
+	throttleQueueTimeout = 5 * time.Minute
+	// The limits of issuers not seen within this time are forgotten, e.g. of deleted issuers.
+	// The issuers are seen on every request reconcile and CA check.
+	throttleLimitsTimeout = 24 * time.Hour
+)
+
+// ThrottledError is returned when a request can't be sent to ADCS now
+// because of the issuer's rate limits.
+type ThrottledError struct {
+	// Reason is 'RateLimited' or 'ConcurrencyLimited'.
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s, retry in %v", e.Reason, e.RetryAfter)
+}
+
+// Throttles keeps the rate limiters of all ADCS endpoints.
+type Throttles struct {
+	mu        sync.Mutex
+	endpoints map[string]*throttle
+}
+
+func NewThrottles() *Throttles {
+	return &Throttles{
+		endpoints: make(map[string]*throttle),
+	}
+}
+
+// Get the throttle for the ADCS URL, updated with the issuer's limits. The issuers of the
+// same URL share the throttle, it applies the strictest of their limits.
+// Returns nil if none of them has limits set.
+func (t *Throttles) get(url string, issuer types.UID, spec *api.RateLimit) (*throttle, error) {
+	return t.getAt(url, issuer, spec, time.Now())
+}
+
+func (t *Throttles) getAt(url string, issuer types.UID, spec *api.RateLimit, now time.Time) (*throttle, error) {
+	var limits *throttleLimits
+	if spec != nil {
+		limits = &throttleLimits{limit: rate.Inf, burst: spec.Burst, maxConcurrent: spec.MaxConcurrent, seen: now}
+		if spec.RequestsPerSecond != "" {
+			rps, err := strconv.ParseFloat(spec.RequestsPerSecond, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid requestsPerSecond %q: %v", spec.RequestsPerSecond, err)
+			}
+			if rps > 0 {
+				limits.limit = rate.Limit(rps)
+			}
+		}
+		if limits.burst < 1 {
+			limits.burst = 1
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	th, ok := t.endpoints[url]
+	if !ok {
+		if limits == nil {
+			return nil, nil
+		}
+		th = &throttle{
+			endpoint:     url,
+			limiter:      rate.NewLimiter(limits.limit, limits.burst),
+			issuers:      make(map[types.UID]*throttleLimits),
+			reservations: make(map[string]time.Time),
+			queued:       make(map[string]time.Time),
+		}
+		t.endpoints[url] = th
+	}
+	if !th.update(issuer, limits, now) {
+		return nil, nil
+	}
+	return th, nil
+}
+
+// throttleLimits are the limits of an issuer.
+type throttleLimits struct {
+	limit         rate.Limit
+	burst         int
+	maxConcurrent int
+	// Last time the issuer was seen with the limits.
+	seen time.Time
+}
+
+// throttle limits the requests sent to a single ADCS endpoint.
+// Requests that can't be sent now get a slot in the future (rate limit) or
+// a place in the queue (concurrency cap) so they are served in arrival order.
+// Queued requests that stopped asking for admission don't hold up the others.
+type throttle struct {
+	mu            sync.Mutex
+	endpoint      string
+	limiter       *rate.Limiter
+	maxConcurrent int
+	inFlight      int
+	// Limits of the issuers of the endpoint.
+	issuers map[types.UID]*throttleLimits
+	// Time slots reserved for rate limited requests.
+	reservations map[string]time.Time
+	// Requests waiting for the concurrency cap, in arrival order.
+	queue []string
+	// Last time each queued request asked for admission.
+	queued map[string]time.Time
+}
+
+// Set or, if nil, remove the issuer's limits and apply the strictest limits of the issuers.
+// The limiter is updated in place so it keeps the tokens spent. Returns false if no issuer
+// has limits set.
+func (t *throttle) update(issuer types.UID, limits *throttleLimits, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if limits != nil {
+		t.issuers[issuer] = limits
+	} else {
+		delete(t.issuers, issuer)
+	}
+
+	limit, burst, maxConcurrent := rate.Inf, 0, 0
+	for uid, l := range t.issuers {
+		if now.Sub(l.seen) > throttleLimitsTimeout {
+			delete(t.issuers, uid)
+			continue
+		}
+		if l.limit < limit {
+			limit = l.limit
+		}
+		if l.limit != rate.Inf && (burst == 0 || l.burst < burst) {
+			burst = l.burst
+		}
+		if l.maxConcurrent > 0 && (maxConcurrent == 0 || l.maxConcurrent < maxConcurrent) {
+			maxConcurrent = l.maxConcurrent
+		}
+	}
+	if len(t.issuers) == 0 {
+		return false
+	}
+	if burst == 0 {
+		burst = 1
+	}
+	if t.limiter.Limit() != limit {
+		t.limiter.SetLimitAt(now, limit)
+	}
+	if t.limiter.Burst() != burst {
+		t.limiter.SetBurstAt(now, burst)
+	}
+	t.maxConcurrent = maxConcurrent
+	return true
+}
+
+// Acquire admission for the request identified by key.
+// On success the returned function must be called when the request completes.
+// Otherwise a *ThrottledError is returned.
+func (t *throttle) acquire(key string) (func(), error) {
+	return t.acquireAt(key, time.Now())
+}
+
+func (t *throttle) acquireAt(key string, now time.Time) (func(), error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.dropStale(now)
+	if t.maxConcurrent > 0 {
+		if _, ok := t.queued[key]; !ok {
+			t.queue = append(t.queue, key)
+		}
+		t.queued[key] = now
+		if !t.admissible(key, now) {
+			throttledTotal.WithLabelValues(t.endpoint, "ConcurrencyLimited").Inc()
+			return nil, &ThrottledError{Reason: "ConcurrencyLimited", RetryAfter: concurrencyRetryInterval}
+		}
+	}
+
+	if slot, ok := t.reservations[key]; ok {
+		if now.Before(slot) {
+			throttledTotal.WithLabelValues(t.endpoint, "RateLimited").Inc()
+			return nil, &ThrottledError{Reason: "RateLimited", RetryAfter: slot.Sub(now)}
+		}
+		delete(t.reservations, key)
+	} else if delay := t.limiter.ReserveN(now, 1).DelayFrom(now); delay > 0 {
+		t.reservations[key] = now.Add(delay)
+		throttledTotal.WithLabelValues(t.endpoint, "RateLimited").Inc()
+		return nil, &ThrottledError{Reason: "RateLimited", RetryAfter: delay}
+	}
+
+	t.dequeue(key)
+	t.inFlight++
+	inFlightRequests.WithLabelValues(t.endpoint).Set(float64(t.inFlight))
+	return t.release, nil
+}
+
+func (t *throttle) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inFlight--
+	inFlightRequests.WithLabelValues(t.endpoint).Set(float64(t.inFlight))
+}
+
+// A queued request is admitted if there is a free slot for it after the active requests
+// queued before it. Inactive requests keep their place but don't hold up the others.
+func (t *throttle) admissible(key string, now time.Time) bool {
+	free := t.maxConcurrent - t.inFlight
+	for _, queued := range t.queue {
+		if free <= 0 {
+			return false
+		}
+		if queued == key {
+			return true
+		}
+		if now.Sub(t.queued[queued]) <= throttleQueueActive {
+			free--
+		}
+	}
+	return false
+}
+
+func (t *throttle) dequeue(key string) {
+	for idx, queued := range t.queue {
+		if queued == key {
+			t.queue = append(t.queue[:idx], t.queue[idx+1:]...)
+			break
+		}
+	}
+	delete(t.queued, key)
+}
+
+// Forget queued requests and reservations not seen for long.
+func (t *throttle) dropStale(now time.Time) {
+	queue := t.queue[:0]
+	for _, key := range t.queue {
+		if now.Sub(t.queued[key]) > throttleQueueTimeout {
+			delete(t.queued, key)
+			continue
+		}
+		queue = append(queue, key)
+	}
+	t.queue = queue
+	for key, slot := range t.reservations {
+		if now.Sub(slot) > throttleQueueTimeout {
+			delete(t.reservations, key)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package issuers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+func testThrottle(t *testing.T, spec *api.RateLimit) *throttle {
+	th, err := NewThrottles().get("https://adcs.example.com/certsrv", "issuer", spec)
+	require.NoError(t, err)
+	require.NotNil(t, th)
+	return th
+}
+
+func assertThrottled(t *testing.T, reason string, release func(), err error) {
+	t.Helper()
+	assert.Nil(t, release)
+	if assert.IsType(t, &ThrottledError{}, err) {
+		assert.Equal(t, reason, err.(*ThrottledError).Reason)
+	}
+}
+
+func TestThrottlesGet(t *testing.T) {
+	throttles := NewThrottles()
+	url := "https://adcs.example.com/certsrv"
+	th, err := throttles.get(url, "a", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, th)
+
+	_, err = throttles.get(url, "a", &api.RateLimit{RequestsPerSecond: "fast"})
+	assert.Error(t, err)
+
+	// Issuers of the same endpoint share the throttle with the strictest of their limits.
+	first, err := throttles.get(url, "a", &api.RateLimit{RequestsPerSecond: "2", Burst: 3, MaxConcurrent: 4})
+	require.NoError(t, err)
+	second, err := throttles.get(url, "b", &api.RateLimit{RequestsPerSecond: "5", Burst: 2, MaxConcurrent: 1})
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+	assert.Equal(t, rate.Limit(2), second.limiter.Limit())
+	assert.Equal(t, 2, second.limiter.Burst())
+	assert.Equal(t, 1, second.maxConcurrent)
+
+	// Issuers without limits are limited by the others.
+	third, err := throttles.get(url, "c", nil)
+	require.NoError(t, err)
+	assert.Same(t, first, third)
+
+	// Until their limits are removed.
+	_, err = throttles.get(url, "b", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, first.limiter.Burst())
+	assert.Equal(t, 4, first.maxConcurrent)
+	th, err = throttles.get(url, "a", nil)
+	require.NoError(t, err)
+	assert.Nil(t, th)
+
+	// A request rate without a burst limits the burst to 1.
+	first, err = throttles.get(url, "a", &api.RateLimit{MaxConcurrent: 2})
+	require.NoError(t, err)
+	assert.Equal(t, rate.Inf, first.limiter.Limit())
+	_, err = throttles.get(url, "b", &api.RateLimit{RequestsPerSecond: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, rate.Limit(1), first.limiter.Limit())
+	assert.Equal(t, 1, first.limiter.Burst())
+	assert.Equal(t, 2, first.maxConcurrent)
+}
+
+func TestThrottlesSharedLimiter(t *testing.T) {
+	throttles := NewThrottles()
+	url := "https://adcs.example.com/certsrv"
+	now := time.Now()
+
+	// Requests of alternating issuers with different limits spend the same tokens.
+	a, err := throttles.getAt(url, "a", &api.RateLimit{RequestsPerSecond: "1", Burst: 2}, now)
+	require.NoError(t, err)
+	for _, key := range []string{"1", "2"} {
+		release, err := a.acquireAt(key, now)
+		require.NoError(t, err)
+		release()
+	}
+	b, err := throttles.getAt(url, "b", &api.RateLimit{RequestsPerSecond: "10", Burst: 5}, now)
+	require.NoError(t, err)
+	release, err := b.acquireAt("3", now)
+	assertThrottled(t, "RateLimited", release, err)
+	a, err = throttles.getAt(url, "a", &api.RateLimit{RequestsPerSecond: "1", Burst: 2}, now)
+	require.NoError(t, err)
+	release, err = a.acquireAt("4", now)
+	assertThrottled(t, "RateLimited", release, err)
+
+	// The limits of issuers not seen for long are forgotten.
+	later := now.Add(throttleLimitsTimeout + time.Minute)
+	b, err = throttles.getAt(url, "b", &api.RateLimit{RequestsPerSecond: "10", Burst: 5}, later)
+	require.NoError(t, err)
+	assert.Equal(t, rate.Limit(10), b.limiter.Limit())
+	assert.Equal(t, 5, b.limiter.Burst())
+}
+
+func TestThrottleRateLimit(t *testing.T) {
+	th := testThrottle(t, &api.RateLimit{RequestsPerSecond: "1"})
+	now := time.Now()
+
+	release, err := th.acquireAt("a", now)
+	require.NoError(t, err)
+	release()
+
+	// The next request gets the next slot and keeps it when re-tried early.
+	release, err = th.acquireAt("b", now)
+	assertThrottled(t, "RateLimited", release, err)
+	assert.InDelta(t, float64(time.Second), float64(err.(*ThrottledError).RetryAfter), float64(10*time.Millisecond))
+	release, err = th.acquireAt("b", now.Add(500*time.Millisecond))
+	assertThrottled(t, "RateLimited", release, err)
+
+	release, err = th.acquireAt("b", now.Add(time.Second))
+	require.NoError(t, err)
+	release()
+	assert.Empty(t, th.reservations)
+}
+
+func TestThrottleMaxConcurrent(t *testing.T) {
+	th := testThrottle(t, &api.RateLimit{MaxConcurrent: 2})
+	now := time.Now()
+
+	releaseA, err := th.acquireAt("a", now)
+	require.NoError(t, err)
+	releaseB, err := th.acquireAt("b", now)
+	require.NoError(t, err)
+	release, err := th.acquireAt("c", now)
+	assertThrottled(t, "ConcurrencyLimited", release, err)
+	assert.Equal(t, 2, th.inFlight)
+
+	releaseA()
+	releaseC, err := th.acquireAt("c", now.Add(time.Second))
+	require.NoError(t, err)
+	assert.Empty(t, th.queue)
+	assert.Empty(t, th.queued)
+	releaseB()
+	releaseC()
+	assert.Equal(t, 0, th.inFlight)
+}
+
+func TestThrottleQueueOrder(t *testing.T) {
+	th := testThrottle(t, &api.RateLimit{MaxConcurrent: 1})
+	now := time.Now()
+
+	releaseA, err := th.acquireAt("a", now)
+	require.NoError(t, err)
+	for _, key := range []string{"b", "c", "d"} {
+		release, err := th.acquireAt(key, now)
+		assertThrottled(t, "ConcurrencyLimited", release, err)
+	}
+	assert.Equal(t, []string{"b", "c", "d"}, th.queue)
+
+	// The free slot is kept for the first queued request.
+	releaseA()
+	now = now.Add(concurrencyRetryInterval)
+	release, err := th.acquireAt("d", now)
+	assertThrottled(t, "ConcurrencyLimited", release, err)
+	release, err = th.acquireAt("c", now)
+	assertThrottled(t, "ConcurrencyLimited", release, err)
+	releaseB, err := th.acquireAt("b", now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "d"}, th.queue)
+
+	releaseB()
+	release, err = th.acquireAt("c", now)
+	require.NoError(t, err)
+	release()
+}
+
+func TestThrottleInactiveQueuedRequests(t *testing.T) {
+	th := testThrottle(t, &api.RateLimit{MaxConcurrent: 1})
+	now := time.Now()
+
+	releaseA, err := th.acquireAt("a", now)
+	require.NoError(t, err)
+	for _, key := range []string{"gone", "b"} {
+		release, err := th.acquireAt(key, now)
+		assertThrottled(t, "ConcurrencyLimited", release, err)
+	}
+	releaseA()
+
+	// The first queued request doesn't ask again (e.g. deleted), the next one doesn't wait for it.
+	now = now.Add(throttleQueueActive + time.Second)
+	releaseB, err := th.acquireAt("b", now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gone"}, th.queue)
+	releaseB()
+
+	// Until forgotten it keeps its place when it asks again.
+	releaseC, err := th.acquireAt("c", now)
+	require.NoError(t, err)
+	release, err := th.acquireAt("gone", now)
+	assertThrottled(t, "ConcurrencyLimited", release, err)
+	release, err = th.acquireAt("d", now)
+	assertThrottled(t, "ConcurrencyLimited", release, err)
+	releaseC()
+	release, err = th.acquireAt("d", now)
+	assertThrottled(t, "ConcurrencyLimited", release, err)
+	release, err = th.acquireAt("gone", now)
+	require.NoError(t, err)
+	release()
+
+	// Forgotten after the queue timeout.
+	th.dropStale(now.Add(throttleQueueTimeout + time.Second))
+	assert.Empty(t, th.queue)
+	assert.Empty(t, th.queued)
+}
@@ -0,0 +1,239 @@
+package issuers
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+
+	apiutil "github.com/jetstack/cert-manager/pkg/api/util"
+	cmapi "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
+
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+// Check the issued certificate against the request before it's handed to cert-manager.
+// An error is returned if the certificate is unusable (it doesn't parse or is issued for another key)
+// or, in strict mode, if it has any deviations. Otherwise the deviations are returned,
+// e.g. SANs or usages dropped by the ADCS template.
+// Usages are checked only if explicitly requested as the defaults are up to the ADCS template.
+// The certificate of a CA request must be a CA certificate within the issuer's SubCA policy,
+// the certificate of any other request must not be a CA certificate.
+func (i *Issuer) VerifyCertificate(ar *api.AdcsRequest, certPEM []byte, caPEM []byte, usages []cmapi.KeyUsage, isCA bool) ([]string, error) {
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := parseCSR(ar.Spec.CSRPEM)
+	if err != nil {
+		return nil, err
+	}
+	if err := publicKeyMatches(cert, csr); err != nil {
+		return nil, err
+	}
+	if isCA {
+		// Unusable as a CA whatever the verification mode.
+		if err := i.verifyCACertificate(cert); err != nil {
+			return nil, err
+		}
+	} else if cert.BasicConstraintsValid && cert.IsCA {
+		// It could sign any certificate, it's never handed out unless asked for.
+		return nil, fmt.Errorf("CA certificate (CA:TRUE) issued for a request that isn't for a CA, check the ADCS template")
+	}
+
+	var deviations []string
+	if err := verifyChain(cert, caPEM); err != nil {
+		deviations = append(deviations, err.Error())
+	}
+	deviations = append(deviations, subjectDeviations(cert, csr)...)
+	deviations = append(deviations, sanDeviations(cert, csr)...)
+	deviations = append(deviations, usageDeviations(cert, usages, isCA)...)
+
+	if i.strictVerification && len(deviations) > 0 {
+		return deviations, fmt.Errorf("certificate issued with deviations: %s", strings.Join(deviations, "; "))
+	}
+	return deviations, nil
+}
+
+// Check that the certificate is issued for the CSR's public key.
+func publicKeyMatches(cert *x509.Certificate, csr *x509.CertificateRequest) error {
+	certKey, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return fmt.Errorf("cannot marshal certificate public key: %v", err)
+	}
+	csrKey, err := x509.MarshalPKIXPublicKey(csr.PublicKey)
+	if err != nil {
+		return fmt.Errorf("cannot marshal CSR public key: %v", err)
+	}
+	if !bytes.Equal(certKey, csrKey) {
+		return fmt.Errorf("certificate public key doesn't match the CSR")
+	}
+	return nil
+}
+
+// Check that the certificate chains to one of the CA certificates.
+func verifyChain(cert *x509.Certificate, caPEM []byte) error {
+	cas, err := parseCertificates(caPEM)
+	if err != nil {
+		return fmt.Errorf("cannot verify the chain: %v", err)
+	}
+	roots := x509.NewCertPool()
+	for _, ca := range cas {
+		roots.AddCert(ca)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots: roots,
+		// Validity is not our concern here, only the signatures.
+		CurrentTime: cert.NotBefore,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("certificate doesn't chain to the CA: %v", err)
+	}
+	return nil
+}
+
+func subjectDeviations(cert *x509.Certificate, csr *x509.CertificateRequest) []string {
+	var deviations []string
+	if csr.Subject.CommonName != "" && cert.Subject.CommonName != csr.Subject.CommonName {
+		deviations = append(deviations, fmt.Sprintf("subject common name %q instead of %q", cert.Subject.CommonName, csr.Subject.CommonName))
+	}
+	if missing := missingStrings(cert.Subject.Organization, csr.Subject.Organization); len(missing) > 0 {
+		deviations = append(deviations, fmt.Sprintf("subject organizations missing: %s", strings.Join(missing, ", ")))
+	}
+	return deviations
+}
+
+func sanDeviations(cert *x509.Certificate, csr *x509.CertificateRequest) []string {
+	var deviations []string
+	if missing := missingStrings(cert.DNSNames, csr.DNSNames); len(missing) > 0 {
+		deviations = append(deviations, fmt.Sprintf("DNS names missing: %s", strings.Join(missing, ", ")))
+	}
+	if missing := missingStrings(ipStrings(cert.IPAddresses), ipStrings(csr.IPAddresses)); len(missing) > 0 {
+		deviations = append(deviations, fmt.Sprintf("IP addresses missing: %s", strings.Join(missing, ", ")))
+	}
+	var certURIs, csrURIs []string
+	for _, uri := range cert.URIs {
+		certURIs = append(certURIs, uri.String())
+	}
+	for _, uri := range csr.URIs {
+		csrURIs = append(csrURIs, uri.String())
+	}
+	if missing := missingStrings(certURIs, csrURIs); len(missing) > 0 {
+		deviations = append(deviations, fmt.Sprintf("URIs missing: %s", strings.Join(missing, ", ")))
+	}
+	if missing := missingStrings(cert.EmailAddresses, csr.EmailAddresses); len(missing) > 0 {
+		deviations = append(deviations, fmt.Sprintf("email addresses missing: %s", strings.Join(missing, ", ")))
+	}
+	return deviations
+}
+
+// Certificates without the (extended) key usage extension are not restricted
+// so they're not reported.
+func usageDeviations(cert *x509.Certificate, usages []cmapi.KeyUsage, isCA bool) []string {
+	var deviations []string
+	var missing []string
+	if isCA && cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		missing = append(missing, string(cmapi.UsageCertSign))
+	}
+	for _, usage := range usages {
+		if ku, ok := apiutil.KeyUsageType(usage); ok {
+			if cert.KeyUsage != 0 && cert.KeyUsage&ku == 0 {
+				missing = append(missing, string(usage))
+			}
+		} else if eku, ok := apiutil.ExtKeyUsageType(usage); ok {
+			if len(cert.ExtKeyUsage) > 0 && !hasExtKeyUsage(cert, eku) {
+				missing = append(missing, string(usage))
+			}
+		}
+	}
+	if len(missing) > 0 {
+		deviations = append(deviations, fmt.Sprintf("usages missing: %s", strings.Join(missing, ", ")))
+	}
+	return deviations
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, eku x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == eku || u == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the wanted values not present in have. Comparison is case insensitive.
+func missingStrings(have []string, want []string) []string {
+	var missing []string
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if strings.EqualFold(h, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, w)
+		}
+	}
+	return missing
+}
+
+func ipStrings(ips []net.IP) []string {
+	var out []string
+	for _, ip := range ips {
+		out = append(out, ip.String())
+	}
+	return out
+}
+
+func parseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("cannot decode certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse certificate: %v", err)
+	}
+	return cert, nil
+}
+
+// Parse all the certificates in the PEM bundle.
+func parseCertificates(bundle []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse CA certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no CA certificates found")
+	}
+	return certs, nil
+}
+
+func parseCSR(csrPEM []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil {
+		return nil, fmt.Errorf("cannot decode CSR PEM")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse CSR: %v", err)
+	}
+	return csr, nil
+}
@@ -0,0 +1,152 @@
+package issuers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	cmapi "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chojnack/adcs-issuer/adcs"
+	api "github.com/chojnack/adcs-issuer/api/v1"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+// Create a CA certificate signed by the parent, self-signed if the parent is nil.
+func newTestCA(t *testing.T, name string, parent *testCA) *testCA {
+	ca := &testCA{key: newTestKey(t)}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	signer := &testCA{cert: template, key: ca.key}
+	if parent != nil {
+		signer = parent
+	}
+	ca.cert = signer.issue(t, template, &ca.key.PublicKey)
+	return ca
+}
+
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate, pub interface{}) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, pub, ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func (ca *testCA) pem() []byte {
+	return adcs.EncodeCertificatesPem([]*x509.Certificate{ca.cert})
+}
+
+// Issue a certificate for the CSR as a template would, the template changed by modify.
+func (ca *testCA) issueForCSR(t *testing.T, csr *x509.CertificateRequest, modify func(*x509.Certificate)) []byte {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if modify != nil {
+		modify(template)
+	}
+	cert := ca.issue(t, template, csr.PublicKey)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// Create the request with a CSR for the key.
+func newTestRequest(t *testing.T, key *ecdsa.PrivateKey, template *x509.CertificateRequest) (*api.AdcsRequest, *x509.CertificateRequest) {
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+	ar := &api.AdcsRequest{Spec: api.AdcsRequestSpec{
+		CSRPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+	}}
+	return ar, csr
+}
+
+func TestVerifyCertificate(t *testing.T) {
+	ca := newTestCA(t, "Test CA", nil)
+	ar, csr := newTestRequest(t, newTestKey(t), &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "app.example.com", Organization: []string{"Example"}},
+		DNSNames: []string{"app.example.com", "www.example.com"},
+	})
+	issuer := &Issuer{}
+
+	deviations, err := issuer.VerifyCertificate(ar, ca.issueForCSR(t, csr, nil), ca.pem(), []cmapi.KeyUsage{cmapi.UsageServerAuth}, false)
+	require.NoError(t, err)
+	assert.Empty(t, deviations)
+
+	// The template dropped a SAN and the usage.
+	cert := ca.issueForCSR(t, csr, func(c *x509.Certificate) {
+		c.DNSNames = []string{"app.example.com"}
+		c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	})
+	deviations, err = issuer.VerifyCertificate(ar, cert, ca.pem(), []cmapi.KeyUsage{cmapi.UsageServerAuth}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"DNS names missing: www.example.com", "usages missing: server auth"}, deviations)
+
+	// Strict verification fails on deviations.
+	strict := &Issuer{strictVerification: true}
+	deviations, err = strict.VerifyCertificate(ar, cert, ca.pem(), []cmapi.KeyUsage{cmapi.UsageServerAuth}, false)
+	assert.Error(t, err)
+	assert.Len(t, deviations, 2)
+
+	// Signed by another CA.
+	other := newTestCA(t, "Other CA", nil)
+	deviations, err = issuer.VerifyCertificate(ar, other.issueForCSR(t, csr, nil), ca.pem(), nil, false)
+	require.NoError(t, err)
+	if assert.Len(t, deviations, 1) {
+		assert.Contains(t, deviations[0], "certificate doesn't chain to the CA")
+	}
+}
+
+func TestVerifyCertificatePublicKeyMismatch(t *testing.T) {
+	ca := newTestCA(t, "Test CA", nil)
+	ar, csr := newTestRequest(t, newTestKey(t), &x509.CertificateRequest{Subject: pkix.Name{CommonName: "app.example.com"}})
+	// Issued for the same subject but another key, e.g. an adopted request of another CSR.
+	_, otherCSR := newTestRequest(t, newTestKey(t), &x509.CertificateRequest{Subject: csr.Subject})
+
+	for _, strict := range []bool{false, true} {
+		issuer := &Issuer{strictVerification: strict}
+		_, err := issuer.VerifyCertificate(ar, ca.issueForCSR(t, otherCSR, nil), ca.pem(), nil, false)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "certificate public key doesn't match the CSR")
+		}
+	}
+}
+
+func TestVerifyCertificateUnparsable(t *testing.T) {
+	ca := newTestCA(t, "Test CA", nil)
+	ar, _ := newTestRequest(t, newTestKey(t), &x509.CertificateRequest{Subject: pkix.Name{CommonName: "app.example.com"}})
+
+	_, err := (&Issuer{}).VerifyCertificate(ar, []byte("not a certificate"), ca.pem(), nil, false)
+	assert.Error(t, err)
+}
@@ -16,18 +16,23 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"time"
 
 	adcsv1 "github.com/chojnack/adcs-issuer/api/v1"
+	"github.com/chojnack/adcs-issuer/audit"
 	"github.com/chojnack/adcs-issuer/controllers"
 	"github.com/chojnack/adcs-issuer/issuers"
+	"github.com/chojnack/adcs-issuer/tracing"
 	certmanager "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha2"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -47,14 +52,41 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var clusterResourceNamespace string
+	var certsrvCacheSize int
+	var maxConcurrentRequests int
+	var tracingOptions tracing.Options
+	var auditFile, auditWebhookURL string
+	var recordRetention time.Duration
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&clusterResourceNamespace, "cluster-resource-namespace", "kube-system", "Namespace where cluster-level resources are stored.")
+	flag.IntVar(&maxConcurrentRequests, "max-concurrent-requests", 1, "Number of AdcsRequests processed in parallel.")
+	flag.IntVar(&certsrvCacheSize, "certsrv-cache-size", 64, "Maximum number of ADCS clients (one per issuer) kept for connection reuse.")
+	flag.StringVar(&tracingOptions.Endpoint, "otlp-endpoint", "", "OTLP gRPC endpoint (host:port) the trace spans are exported to. Tracing is disabled if empty.")
+	flag.BoolVar(&tracingOptions.Insecure, "otlp-insecure", false, "Connect to the OTLP endpoint without TLS.")
+	flag.Float64Var(&tracingOptions.SampleRatio, "trace-sample-ratio", 1, "Fraction of the traces sampled, between 0 and 1.")
+	flag.StringVar(&auditFile, "audit-file", "", "File the issuance audit records are appended to as JSON lines.")
+	flag.StringVar(&auditWebhookURL, "audit-webhook-url", "", "URL the issuance audit records are POSTed to as JSON.")
+	flag.DurationVar(&recordRetention, "certificate-record-retention", 0, "Time after a certificate's expiry its AdcsCertificateRecord is removed. Zero keeps the records.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.Logger(true))
 
+	shutdownTracing, err := tracing.Setup(context.Background(), tracingOptions)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	defer func() {
+		// Flush the spans left.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			setupLog.Error(err, "problem shutting down tracing")
+		}
+	}()
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
@@ -76,24 +108,54 @@ func main() {
 		os.Exit(1)
 	}
 
+	var auditor *audit.Auditor
+	if auditFile != "" || auditWebhookURL != "" {
+		var sinks []audit.Sink
+		if auditFile != "" {
+			fileSink, err := audit.NewFileSink(auditFile)
+			if err != nil {
+				setupLog.Error(err, "unable to set up audit")
+				os.Exit(1)
+			}
+			defer fileSink.Close()
+			sinks = append(sinks, fileSink)
+		}
+		if auditWebhookURL != "" {
+			sinks = append(sinks, audit.NewWebhookSink(auditWebhookURL))
+		}
+		if auditor, err = audit.NewAuditor(sinks...); err != nil {
+			setupLog.Error(err, "unable to set up audit")
+			os.Exit(1)
+		}
+	}
+
+	// Shared by the controllers so they use the same certsrv clients and rate limits.
+	issuerFactory := issuers.IssuerFactory{
+		Client:                   mgr.GetClient(),
+		Log:                      ctrl.Log.WithName("factories").WithName("AdcsIssuer"),
+		ClusterResourceNamespace: clusterResourceNamespace,
+		CertsrvCache:             issuers.NewCertsrvCache(certsrvCacheSize),
+		Throttles:                issuers.NewThrottles(),
+	}
+
 	if err = (&controllers.AdcsRequestReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("AdcsRequest"),
-		IssuerFactory: issuers.IssuerFactory{
-			Client:                   mgr.GetClient(),
-			Log:                      ctrl.Log.WithName("factories").WithName("AdcsIssuer"),
-			ClusterResourceNamespace: clusterResourceNamespace,
-		},
+		Client:                       mgr.GetClient(),
+		Log:                          ctrl.Log.WithName("controllers").WithName("AdcsRequest"),
+		IssuerFactory:                issuerFactory,
 		Recorder:                     mgr.GetEventRecorderFor("adcs-requests-controller"),
 		CertificateRequestController: certificateRequestReconciler,
+		MaxConcurrentReconciles:      maxConcurrentRequests,
+		Auditor:                      auditor,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AdcsRequest")
 		os.Exit(1)
 	}
 
 	if err = (&controllers.AdcsIssuerReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("AdcsIssuer"),
+		Client:        mgr.GetClient(),
+		Log:           ctrl.Log.WithName("controllers").WithName("AdcsIssuer"),
+		Recorder:      mgr.GetEventRecorderFor("adcs-issuers-controller"),
+		IssuerFactory: issuerFactory,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AdcsIssuer")
 		os.Exit(1)
@@ -104,13 +166,42 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err = (&controllers.TrustDistributionReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("TrustDistribution"),
+		Recorder: mgr.GetEventRecorderFor("adcs-trustdistribution-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "TrustDistribution")
+		os.Exit(1)
+	}
+
+	if err = (&adcsv1.AdcsRequest{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "AdcsRequest")
+		os.Exit(1)
+	}
+	mgr.GetWebhookServer().Register("/mutate-adcs-certmanager-csf-nokia-com-v1-adcsrequest",
+		&webhook.Admission{Handler: &adcsv1.AdcsRequestAnnotator{Client: mgr.GetClient(), Reader: mgr.GetAPIReader()}})
+	mgr.GetWebhookServer().Register("/mutate-cert-manager-io-v1alpha2-requester",
+		&webhook.Admission{Handler: &adcsv1.RequesterAnnotator{}})
+
 	if err = (&controllers.ClusterAdcsIssuerReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("ClusterAdcsIssuer"),
+		Client:        mgr.GetClient(),
+		Log:           ctrl.Log.WithName("controllers").WithName("ClusterAdcsIssuer"),
+		Recorder:      mgr.GetEventRecorderFor("adcs-clusterissuers-controller"),
+		IssuerFactory: issuerFactory,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterAdcsIssuer")
 		os.Exit(1)
 	}
+
+	if err = (&controllers.AdcsCertificateRecordReconciler{
+		Client:    mgr.GetClient(),
+		Log:       ctrl.Log.WithName("controllers").WithName("AdcsCertificateRecord"),
+		Retention: recordRetention,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "AdcsCertificateRecord")
+		os.Exit(1)
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
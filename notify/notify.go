@@ -0,0 +1,203 @@
+// Package notify POSTs notifications about the issuers' requests and CA certificates to HTTP webhooks.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultPendingThreshold  = 24 * time.Hour
+	defaultCAExpiryThreshold = 30 * 24 * time.Hour
+	defaultMaxAttempts       = 5
+	deliveryTimeout          = 10 * time.Second
+	// Wait before the first retry, doubled for each following one up to maxRetryBackoff.
+	retryBackoff    = 30 * time.Second
+	maxRetryBackoff = time.Hour
+)
+
+// Event notified.
+type Event string
+
+const (
+	Rejected   Event = "Rejected"
+	Errored    Event = "Errored"
+	Pending    Event = "Pending"
+	Issued     Event = "Issued"
+	CAExpiring Event = "CAExpiring"
+)
+
+// Notification is what happened. The fields are available to the payload templates.
+type Notification struct {
+	Event Event `json:"event"`
+	// What the notification is about e.g. the ADCS request ID or the CA certificate serial number.
+	// A notification is delivered once per notifier, event and key.
+	Key     string    `json:"key"`
+	Time    time.Time `json:"time"`
+	Issuer  Issuer    `json:"issuer"`
+	Request *Request  `json:"request,omitempty"`
+	CA      *CA       `json:"ca,omitempty"`
+}
+
+type Issuer struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Request is the AdcsRequest.
+type Request struct {
+	Namespace     string     `json:"namespace"`
+	Name          string     `json:"name"`
+	AdcsRequestId string     `json:"adcsRequestId,omitempty"`
+	State         string     `json:"state"`
+	Reason        string     `json:"reason,omitempty"`
+	Template      string     `json:"template,omitempty"`
+	PendingSince  *time.Time `json:"pendingSince,omitempty"`
+}
+
+// CA is a CA certificate of the issuer.
+type CA struct {
+	Renewal      int       `json:"renewal"`
+	Subject      string    `json:"subject"`
+	SerialNumber string    `json:"serialNumber"`
+	NotAfter     time.Time `json:"notAfter"`
+}
+
+// Config of a notifier. Zero values select the defaults.
+type Config struct {
+	Name string
+	URL  string
+	// Empty means all events.
+	Events            []Event
+	Template          string
+	PendingThreshold  time.Duration
+	CAExpiryThreshold time.Duration
+	MaxAttempts       int
+}
+
+// Notifier POSTs the notifications of the selected events to a webhook.
+type Notifier struct {
+	Name              string
+	url               string
+	events            map[Event]bool
+	template          *template.Template
+	PendingThreshold  time.Duration
+	CAExpiryThreshold time.Duration
+	MaxAttempts       int
+	httpClient        *http.Client
+}
+
+func NewNotifier(c Config) (*Notifier, error) {
+	n := &Notifier{
+		Name:              c.Name,
+		url:               c.URL,
+		events:            map[Event]bool{},
+		PendingThreshold:  c.PendingThreshold,
+		CAExpiryThreshold: c.CAExpiryThreshold,
+		MaxAttempts:       c.MaxAttempts,
+		httpClient:        &http.Client{Timeout: deliveryTimeout},
+	}
+	for _, event := range c.Events {
+		n.events[event] = true
+	}
+	if c.Template != "" {
+		var err error
+		if n.template, err = ParseTemplate(c.Template); err != nil {
+			return nil, fmt.Errorf("notifier %s: %v", c.Name, err)
+		}
+	}
+	if n.PendingThreshold == 0 {
+		n.PendingThreshold = defaultPendingThreshold
+	}
+	if n.CAExpiryThreshold == 0 {
+		n.CAExpiryThreshold = defaultCAExpiryThreshold
+	}
+	if n.MaxAttempts <= 0 {
+		n.MaxAttempts = defaultMaxAttempts
+	}
+	return n, nil
+}
+
+// ParseTemplate parses the payload template.
+func ParseTemplate(text string) (*template.Template, error) {
+	return template.New("payload").Funcs(template.FuncMap{"json": toJSON}).Option("missingkey=error").Parse(text)
+}
+
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// Accepts tells if the notifier sends the notification: the event is selected and
+// the request has been pending or the CA certificate expires within the notifier's thresholds.
+func (n *Notifier) Accepts(notification *Notification, now time.Time) bool {
+	if len(n.events) > 0 && !n.events[notification.Event] {
+		return false
+	}
+	switch notification.Event {
+	case Pending:
+		r := notification.Request
+		return r != nil && r.PendingSince != nil && now.Sub(*r.PendingSince) >= n.PendingThreshold
+	case CAExpiring:
+		return notification.CA != nil && notification.CA.NotAfter.Sub(now) <= n.CAExpiryThreshold
+	}
+	return true
+}
+
+// Payload renders the JSON payload of the notification.
+func (n *Notifier) Payload(notification *Notification) ([]byte, error) {
+	if n.template == nil {
+		return json.Marshal(notification)
+	}
+	var b bytes.Buffer
+	if err := n.template.Execute(&b, notification); err != nil {
+		return nil, err
+	}
+	if !json.Valid(b.Bytes()) {
+		return nil, fmt.Errorf("template output is not valid JSON: %s", b.String())
+	}
+	return b.Bytes(), nil
+}
+
+// Deliver POSTs the notification once. Any response status other than 2xx is an error.
+func (n *Notifier) Deliver(ctx context.Context, notification *Notification) error {
+	payload, err := n.Payload(notification)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", n.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := n.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook response status %s", res.Status)
+	}
+	return nil
+}
+
+// RetryBackoff returns the time to wait after the given number of failed attempts.
+func RetryBackoff(attempts int) time.Duration {
+	backoff := retryBackoff
+	for i := 1; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return backoff
+}
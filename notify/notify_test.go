@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testNotification() *Notification {
+	since := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	return &Notification{
+		Event:  Rejected,
+		Key:    "42",
+		Time:   since.Add(time.Hour),
+		Issuer: Issuer{Kind: "AdcsIssuer", Name: "adcs", Namespace: "default"},
+		Request: &Request{
+			Namespace:     "default",
+			Name:          "test",
+			AdcsRequestId: "42",
+			State:         "rejected",
+			Reason:        `Denied by "policy"`,
+			PendingSince:  &since,
+		},
+	}
+}
+
+func TestTemplatePayload(t *testing.T) {
+	notifier, err := NewNotifier(Config{
+		Name:     "chat",
+		URL:      "http://localhost",
+		Template: `{"text": {{ json (printf "%s %s/%s: %s" .Event .Request.Namespace .Request.Name .Request.Reason) }}}`,
+	})
+	require.NoError(t, err)
+	payload, err := notifier.Payload(testNotification())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"text": "Rejected default/test: Denied by \"policy\""}`, string(payload))
+
+	// Not quoted
+	notifier, err = NewNotifier(Config{Name: "chat", URL: "http://localhost", Template: `{"text": {{ .Request.Reason }}}`})
+	require.NoError(t, err)
+	_, err = notifier.Payload(testNotification())
+	assert.Error(t, err)
+
+	_, err = NewNotifier(Config{Name: "chat", URL: "http://localhost", Template: `{{ .Event `})
+	assert.Error(t, err)
+}
+
+func TestDefaultPayload(t *testing.T) {
+	notifier, err := NewNotifier(Config{Name: "hook", URL: "http://localhost"})
+	require.NoError(t, err)
+	payload, err := notifier.Payload(testNotification())
+	require.NoError(t, err)
+	decoded := new(Notification)
+	require.NoError(t, json.Unmarshal(payload, decoded))
+	assert.Equal(t, testNotification(), decoded)
+}
+
+func TestAccepts(t *testing.T) {
+	now := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	notifier, err := NewNotifier(Config{Name: "hook", URL: "http://localhost", Events: []Event{Pending, CAExpiring}, PendingThreshold: 12 * time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, 30*24*time.Hour, notifier.CAExpiryThreshold)
+
+	assert.False(t, notifier.Accepts(testNotification(), now), "event not selected")
+
+	pending := testNotification()
+	pending.Event = Pending
+	assert.True(t, notifier.Accepts(pending, now))
+	assert.False(t, notifier.Accepts(pending, pending.Request.PendingSince.Add(11*time.Hour)))
+
+	ca := &Notification{Event: CAExpiring, Key: "01", CA: &CA{NotAfter: now.Add(29 * 24 * time.Hour)}}
+	assert.True(t, notifier.Accepts(ca, now))
+	ca.CA.NotAfter = now.Add(31 * 24 * time.Hour)
+	assert.False(t, notifier.Accepts(ca, now))
+
+	all, err := NewNotifier(Config{Name: "all", URL: "http://localhost"})
+	require.NoError(t, err)
+	assert.True(t, all.Accepts(testNotification(), now))
+}
+
+func TestDeliver(t *testing.T) {
+	var bodies []string
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	notifier, err := NewNotifier(Config{Name: "hook", URL: server.URL, Template: `{"key": {{ json .Key }}}`})
+	require.NoError(t, err)
+	require.NoError(t, notifier.Deliver(context.Background(), testNotification()))
+	status = http.StatusBadGateway
+	assert.EqualError(t, notifier.Deliver(context.Background(), testNotification()), "webhook response status 502 Bad Gateway")
+	assert.Equal(t, []string{`{"key": "42"}`, `{"key": "42"}`}, bodies)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, RetryBackoff(1))
+	assert.Equal(t, time.Minute, RetryBackoff(2))
+	assert.Equal(t, 4*time.Minute, RetryBackoff(4))
+	assert.Equal(t, time.Hour, RetryBackoff(10))
+}
@@ -5,6 +5,8 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
@@ -13,8 +15,11 @@ import (
 	mrand "math/rand"
 	"net/http"
 	"os"
+	"path"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"text/template"
 	"time"
@@ -28,6 +33,13 @@ type Certserv struct {
 	certs     []Cert
 	caCert    *x509.Certificate
 	caKey     *rsa.PrivateKey
+	// The issuing CA signed by the root CA. Certificates are issued by it.
+	intermediateCert *x509.Certificate
+	intermediateKey  *rsa.PrivateKey
+	// Certificates revoked through the revocation endpoint. Kept in memory only.
+	revokedMu sync.Mutex
+	revoked   []x509.RevocationListEntry
+	crlNumber int64
 }
 
 var (
@@ -36,6 +48,12 @@ var (
 	caCertFile   = caWorkDir + "/ca/root.pem"
 	caKeyFile    = caWorkDir + "/ca/root.key"
 	caDir        = caWorkDir + "/ca"
+	// The intermediate CA is generated on the first start.
+	intermediateCertFile = caWorkDir + "/ca/intermediate.pem"
+	intermediateKeyFile  = caWorkDir + "/ca/intermediate.key"
+
+	// Base URL of the AIA endpoints put in the issued certificates. Empty means no AIA extension.
+	aiaBaseURL = ""
 
 	tmplCertnewCer   = caWorkDir + "/templates/certnew.cer.tmpl"
 	tmplCertCaRc     = caWorkDir + "/templates/certcarc.asp.tmpl"
@@ -43,6 +61,28 @@ var (
 	tmplUnauthorized = caWorkDir + "/templates/unauth.tmpl"
 )
 
+// Set the directory with the 'ca' and 'templates' subdirectories (default current directory).
+// Must be called before NewCertserv. Used to run the simulator in tests.
+func SetWorkDir(dir string) {
+	caWorkDir = dir
+	caCertFile = caWorkDir + "/ca/root.pem"
+	caKeyFile = caWorkDir + "/ca/root.key"
+	caDir = caWorkDir + "/ca"
+	intermediateCertFile = caWorkDir + "/ca/intermediate.pem"
+	intermediateKeyFile = caWorkDir + "/ca/intermediate.key"
+
+	tmplCertnewCer = caWorkDir + "/templates/certnew.cer.tmpl"
+	tmplCertCaRc = caWorkDir + "/templates/certcarc.asp.tmpl"
+	tmplCertFnsh = caWorkDir + "/templates/certfnsh.asp.tmpl"
+	tmplUnauthorized = caWorkDir + "/templates/unauth.tmpl"
+}
+
+// Set the base URL of the simulator used in the Authority Information Access caIssuers URLs
+// of the issued certificates (e.g. https://adcs-sim:8443). Must be called before NewCertserv.
+func SetAiaBaseURL(url string) {
+	aiaBaseURL = strings.TrimSuffix(url, "/")
+}
+
 type SimOrders struct {
 	reject       bool
 	delay        time.Duration
@@ -50,16 +90,15 @@ type SimOrders struct {
 }
 
 func NewCertserv() (*Certserv, error) {
-	cs := &Certserv{
-		0,
-		nil,
-		nil,
-		nil,
-	}
+	cs := &Certserv{}
 	err := cs.initRootCert()
 	if err != nil {
 		return nil, fmt.Errorf("Error: %s", err.Error())
 	}
+	err = cs.initIntermediateCert()
+	if err != nil {
+		return nil, fmt.Errorf("Error: %s", err.Error())
+	}
 	return cs, nil
 }
 
@@ -82,10 +121,11 @@ func (c *Certserv) HandleCertnewCer(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	if reqId[0] == "CACert" {
-		file, err := ioutil.ReadFile(caCertFile)
+		// The certificate of the issuing CA
+		file, err := ioutil.ReadFile(intermediateCertFile)
 		if err != nil {
-			respondError(w, "Cannot find root CA cert.")
-			res := Resp{"Cannot find root CA cert.", "Error"}
+			respondError(w, "Cannot find intermediate CA cert.")
+			res := Resp{"Cannot find intermediate CA cert.", "Error"}
 			tmpl.Execute(w, res)
 			return
 		}
@@ -175,14 +215,119 @@ func (c *Certserv) HandleCertnewCer(w http.ResponseWriter, req *http.Request) {
 	return
 }
 
+// Like some ADCS web enrollment servers the simulator returns only the issuing CA
+// and not the root in the chain.
 func (c *Certserv) HandleCertnewP7b(w http.ResponseWriter, r *http.Request) {
-	file, err := ioutil.ReadFile(caCertFile)
+	certs := []*x509.Certificate{c.intermediateCert}
+	if reqId := r.FormValue("ReqID"); reqId != "" && reqId != "CACert" {
+		// Issued certificate with its chain
+		file, err := ioutil.ReadFile(fmt.Sprintf("%s/%s.pem", caDir, reqId))
+		if err != nil {
+			respondError(w, fmt.Sprintf("Cannot open certificate %s.", reqId))
+			return
+		}
+		cert, err := pki.DecodeX509CertificateBytes(file)
+		if err != nil {
+			respondError(w, fmt.Sprintf("Cannot decode certificate %s.", reqId))
+			return
+		}
+		certs = append(certs, cert)
+	}
+	der, err := EncodePkcs7(certs)
 	if err != nil {
-		respondError(w, "Cannot find root CA cert.")
+		respondError(w, err.Error())
 		return
 	}
 	w.Header().Add("Content-Type", "application/x-pkcs7-certificates")
-	fmt.Fprintf(w, "%s", file)
+	if r.FormValue("ENC") == "bin" {
+		w.Write(der)
+		return
+	}
+	// Like ADCS the base64 PKCS#7 uses the 'CERTIFICATE' PEM type.
+	pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// Serve the CA certificates (DER) referenced by the AIA caIssuers URLs:
+// /aia/root.crt and /aia/intermediate.crt
+func (c *Certserv) HandleAia(w http.ResponseWriter, r *http.Request) {
+	var cert *x509.Certificate
+	switch path.Base(r.URL.Path) {
+	case "root.crt":
+		cert = c.caCert
+	case "intermediate.crt":
+		cert = c.intermediateCert
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Add("Content-Type", "application/pkix-cert")
+	w.Write(cert.Raw)
+}
+
+// Revoke a certificate issued by the issuing CA like a revocation gateway does:
+// POST {"issuer": "<CA DN>", "serialNumber": "<hex>", "reason": <CRL reason code>}
+func (c *Certserv) HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var revocation struct {
+		Issuer       string `json:"issuer"`
+		SerialNumber string `json:"serialNumber"`
+		Reason       int    `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&revocation); err != nil {
+		respondError(w, "Cannot parse revocation")
+		return
+	}
+	serial, ok := new(big.Int).SetString(revocation.SerialNumber, 16)
+	if !ok {
+		respondError(w, fmt.Sprintf("Invalid serial number %s", revocation.SerialNumber))
+		return
+	}
+	if revocation.Issuer != "" && revocation.Issuer != c.intermediateCert.Subject.String() {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Unknown CA %s\n", revocation.Issuer)
+		return
+	}
+	c.revokedMu.Lock()
+	defer c.revokedMu.Unlock()
+	for _, entry := range c.revoked {
+		if entry.SerialNumber.Cmp(serial) == 0 {
+			fmt.Printf("Certificate %s already revoked\n", revocation.SerialNumber)
+			return
+		}
+	}
+	c.revoked = append(c.revoked, x509.RevocationListEntry{
+		SerialNumber:   serial,
+		RevocationTime: time.Now().UTC(),
+		ReasonCode:     revocation.Reason,
+	})
+	fmt.Printf("Certificate %s revoked, reason %d\n", revocation.SerialNumber, revocation.Reason)
+}
+
+// Serve the CRL (DER) of the issuing CA: /crl/intermediate.crl
+func (c *Certserv) HandleCrl(w http.ResponseWriter, r *http.Request) {
+	if path.Base(r.URL.Path) != "intermediate.crl" {
+		http.NotFound(w, r)
+		return
+	}
+	c.revokedMu.Lock()
+	c.crlNumber++
+	now := time.Now()
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(c.crlNumber),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(time.Hour),
+		RevokedCertificateEntries: c.revoked,
+	}, c.intermediateCert, c.intermediateKey)
+	c.revokedMu.Unlock()
+	if err != nil {
+		respondError(w, err.Error())
+		return
+	}
+	w.Header().Add("Content-Type", "application/pkix-crl")
+	w.Write(der)
 }
 
 func (c *Certserv) HandleCertcarcAsp(w http.ResponseWriter, r *http.Request) {
@@ -259,7 +404,12 @@ func (c *Certserv) HandleCertfnshAsp(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// No delay nor rejection, so send the certificate immediately
-	certPem, err := c.CreateCertificatePem(csr)
+	var certPem []byte
+	if strings.Contains(req.PostForm.Get("CertAttrib"), "CertificateTemplate:SubCA") {
+		certPem, err = c.CreateSubCACertificatePem(csr)
+	} else {
+		certPem, err = c.CreateCertificatePem(csr)
+	}
 	if err != nil {
 		m := "Cannot create certificate"
 		fmt.Printf("%s: %s\n", m, err.Error())
@@ -272,6 +422,15 @@ func (c *Certserv) HandleCertfnshAsp(w http.ResponseWriter, req *http.Request) {
 }
 
 func (c *Certserv) CreateCertificatePem(csr *x509.CertificateRequest) ([]byte, error) {
+	return c.createCertificatePem(csr, false)
+}
+
+// CreateSubCACertificatePem issues a CA certificate (path length 0) like the ADCS 'SubCA' template.
+func (c *Certserv) CreateSubCACertificatePem(csr *x509.CertificateRequest) ([]byte, error) {
+	return c.createCertificatePem(csr, true)
+}
+
+func (c *Certserv) createCertificatePem(csr *x509.CertificateRequest, subCA bool) ([]byte, error) {
 
 	keyUsages := x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
 	// create client certificate template
@@ -282,20 +441,28 @@ func (c *Certserv) CreateCertificatePem(csr *x509.CertificateRequest) ([]byte, e
 		PublicKeyAlgorithm: csr.PublicKeyAlgorithm,
 		PublicKey:          csr.PublicKey,
 
-		SerialNumber:   big.NewInt(mrand.Int63()),
-		Issuer:         c.caCert.Issuer,
-		Subject:        csr.Subject,
-		NotBefore:      time.Now(),
-		NotAfter:       time.Now().Add(365 * 24 * time.Hour),
-		KeyUsage:       keyUsages,
-		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		DNSNames:       csr.DNSNames,
-		EmailAddresses: csr.EmailAddresses,
-		IPAddresses:    csr.IPAddresses,
-		URIs:           csr.URIs,
-	}
-
-	derBytes, err := x509.CreateCertificate(rand.Reader, certTemplate, c.caCert, csr.PublicKey, c.caKey)
+		SerialNumber:          big.NewInt(mrand.Int63()),
+		Subject:               csr.Subject,
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              keyUsages,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:              csr.DNSNames,
+		EmailAddresses:        csr.EmailAddresses,
+		IPAddresses:           csr.IPAddresses,
+		URIs:                  csr.URIs,
+		IssuingCertificateURL: aiaURLs("intermediate.crt"),
+		CRLDistributionPoints: crlURLs(),
+	}
+	if subCA {
+		certTemplate.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		certTemplate.ExtKeyUsage = nil
+		certTemplate.IsCA = true
+		certTemplate.BasicConstraintsValid = true
+		certTemplate.MaxPathLenZero = true
+	}
+
+	derBytes, err := x509.CreateCertificate(rand.Reader, certTemplate, c.intermediateCert, csr.PublicKey, c.intermediateKey)
 	if err != nil {
 		return nil, fmt.Errorf("error creating x509 certificate: %s", err.Error())
 	}
@@ -323,12 +490,13 @@ func (c *Certserv) CreateCertificateChainPem(csr *x509.CertificateRequest) ([]by
 	if err != nil {
 		return nil, err
 	}
-	caBytes, err := ioutil.ReadFile(caCertFile)
-	if err != nil {
-		return nil, fmt.Errorf("Cannot find root CA cert. %s", err.Error())
+	for _, file := range []string{intermediateCertFile, caCertFile} {
+		caBytes, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot find CA cert. %s", err.Error())
+		}
+		bytes = append(bytes, caBytes...)
 	}
-
-	bytes = append(bytes, caBytes...)
 	return bytes, nil
 }
 
@@ -429,3 +597,80 @@ func (c *Certserv) initRootCert() error {
 	fmt.Printf("Startign with id = %d\n", c.currentID)
 	return nil
 }
+
+// Load the intermediate CA or, on the first start, generate it signed by the root CA.
+func (c *Certserv) initIntermediateCert() error {
+	certBytes, certErr := ioutil.ReadFile(intermediateCertFile)
+	keyBytes, keyErr := ioutil.ReadFile(intermediateKeyFile)
+	if os.IsNotExist(certErr) && os.IsNotExist(keyErr) {
+		return c.generateIntermediateCert()
+	}
+	if certErr != nil {
+		return fmt.Errorf("Cannot read intermediate CA cert. %s", certErr.Error())
+	}
+	if keyErr != nil {
+		return fmt.Errorf("Cannot read intermediate CA key. %s", keyErr.Error())
+	}
+	var err error
+	c.intermediateCert, err = pki.DecodeX509CertificateBytes(certBytes)
+	if err != nil {
+		return fmt.Errorf("Cannot decode intermediate CA cert. %s", err.Error())
+	}
+	c.intermediateKey, err = pki.DecodePKCS1PrivateKeyBytes(keyBytes)
+	if err != nil {
+		return fmt.Errorf("Cannot decode intermediate CA key. %s", err.Error())
+	}
+	return nil
+}
+
+func (c *Certserv) generateIntermediateCert() error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return fmt.Errorf("Cannot generate intermediate CA key. %s", err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(mrand.Int63()),
+		Subject:               pkix.Name{CommonName: "ADCS simulator issuing CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              c.caCert.NotAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLenZero:        true,
+		IssuingCertificateURL: aiaURLs("root.crt"),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, c.caCert, &key.PublicKey, c.caKey)
+	if err != nil {
+		return fmt.Errorf("Cannot create intermediate CA cert. %s", err.Error())
+	}
+	c.intermediateCert, err = x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	c.intermediateKey = key
+
+	err = ioutil.WriteFile(intermediateCertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	if err != nil {
+		return fmt.Errorf("Cannot write intermediate CA cert. %s", err.Error())
+	}
+	err = ioutil.WriteFile(intermediateKeyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)
+	if err != nil {
+		return fmt.Errorf("Cannot write intermediate CA key. %s", err.Error())
+	}
+	fmt.Printf("Generated intermediate CA %s\n", intermediateCertFile)
+	return nil
+}
+
+func aiaURLs(name string) []string {
+	if aiaBaseURL == "" {
+		return nil
+	}
+	return []string{aiaBaseURL + "/aia/" + name}
+}
+
+func crlURLs() []string {
+	if aiaBaseURL == "" {
+		return nil
+	}
+	return []string{aiaBaseURL + "/crl/intermediate.crl"}
+}
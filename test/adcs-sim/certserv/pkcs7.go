@@ -0,0 +1,51 @@
+package certserv
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+)
+
+var (
+	oidData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      contentInfo
+	Certificates     []asn1.RawValue `asn1:"optional,set,tag:0"`
+	SignerInfos      asn1.RawValue
+}
+
+// Encode the certificates as a degenerate PKCS#7 SignedData (DER) as ADCS does for certnew.p7b.
+func EncodePkcs7(certs []*x509.Certificate) ([]byte, error) {
+	emptySet := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true}
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: emptySet,
+		ContentInfo:      contentInfo{ContentType: oidData},
+		SignerInfos:      emptySet,
+	}
+	for _, cert := range certs {
+		sd.Certificates = append(sd.Certificates, asn1.RawValue{FullBytes: cert.Raw})
+	}
+	content, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode PKCS#7 signed data: %s", err.Error())
+	}
+	der, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode PKCS#7 content info: %s", err.Error())
+	}
+	return der, nil
+}
@@ -29,6 +29,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/chojnack/adcs-issuer/test/adcs-sim/certserv"
@@ -46,6 +47,7 @@ func main() {
 	port := flag.Int("port", 8443, "Port to listen on")
 	dns := flag.String("dns", "", "Comma separated list of domains for the simulator server certificate")
 	ips := flag.String("ips", "", "Comma separated list of IPs for the simulator server certificate")
+	aiaURL := flag.String("aia-url", "", "Base URL of the simulator put in the AIA extension of the issued certificates (default https://<first dns or ip>:<port>)")
 	flag.Parse()
 
 	caWorkDir, _ := os.Getwd() //TODO refactor
@@ -53,6 +55,14 @@ func main() {
 	serverKey = caWorkDir + "/ca/server.key"
 	serverCsr = caWorkDir + "/ca/server.csr"
 
+	if *aiaURL == "" {
+		host := strings.Split(*dns, ",")[0]
+		if host == "" {
+			host = strings.Split(*ips, ",")[0]
+		}
+		*aiaURL = fmt.Sprintf("https://%s", net.JoinHostPort(host, strconv.Itoa(*port)))
+	}
+	certserv.SetAiaBaseURL(*aiaURL)
 	certserv, err := certserv.NewCertserv()
 	if err != nil {
 		fmt.Printf("Cannot initialize: %s\n", err.Error())
@@ -66,6 +76,9 @@ func main() {
 	http.HandleFunc("/certnew.p7b", certserv.HandleCertnewP7b)
 	http.HandleFunc("/certcarc.asp", certserv.HandleCertcarcAsp)
 	http.HandleFunc("/certfnsh.asp", certserv.HandleCertfnshAsp)
+	http.HandleFunc("/aia/", certserv.HandleAia)
+	http.HandleFunc("/revoke", certserv.HandleRevoke)
+	http.HandleFunc("/crl/", certserv.HandleCrl)
 	log.Fatal(http.ListenAndServeTLS(fmt.Sprintf(":%d", *port), serverPem, serverKey, nil))
 }
 
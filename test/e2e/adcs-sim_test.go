@@ -1,9 +1,29 @@
+//go:build e2e
+// +build e2e
+
 package e2e
 
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chojnack/adcs-issuer/adcs"
+)
+
 func TestADCSSim(t *testing.T) {
 	//adcsSimCertPool := load server CA so the client trusts adcs-sim.
 	adcsSimCertPool := &x509.CertPool{}
-	cs, err := adcs.NewNtlmCertsrv("https://localhost:8443", "", "", adcsSimCertPool, true)
+	cs, err := adcs.NewNtlmCertsrv("https://localhost:8443", "", "", adcsSimCertPool, true, nil, false)
 	assert.NoError(t, err)
 
 	csr := &x509.CertificateRequest{
@@ -29,13 +49,20 @@ func TestADCSSim(t *testing.T) {
 	assert.NoError(t, err)
 
 	const adcsCertTemplate = "BasicSSLWebServer"
-	adcsResponseStatus, desc, id, err := cs.RequestCertificate(pemBuffer.String(), adcsCertTemplate)
+	adcsResponseStatus, desc, id, err := cs.RequestCertificate(context.Background(), pemBuffer.String(), adcsCertTemplate)
 	assert.NoError(t, err)
 
-
 	//TODO assert
 	fmt.Println("adcsResponseStatus", adcsResponseStatus)
 	fmt.Println("desc", desc)
 	fmt.Println("id", id)
-}
 
+	// The CA chain is served as PKCS#7 and must come back as PEM certificates.
+	chain, err := cs.GetCaCertificateChain(context.Background())
+	assert.NoError(t, err)
+	block, _ := pem.Decode([]byte(chain))
+	if assert.NotNil(t, block) {
+		_, err = x509.ParseCertificate(block.Bytes)
+		assert.NoError(t, err)
+	}
+}
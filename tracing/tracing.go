@@ -0,0 +1,116 @@
+// Package tracing sets up the optional OpenTelemetry tracing of the issuer.
+// Without Setup the spans are dropped by the global no-op tracer provider.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	instrumentationName = "github.com/chojnack/adcs-issuer"
+	serviceName         = "adcs-issuer"
+	traceparentHeader   = "traceparent"
+)
+
+// Options of the OTLP exporter.
+type Options struct {
+	// OTLP gRPC endpoint (host:port). Empty disables tracing.
+	Endpoint string
+	// Connect to the endpoint without TLS.
+	Insecure bool
+	// Fraction of the traces sampled, 0 to 1. Spans with a sampled parent are always sampled.
+	SampleRatio float64
+}
+
+// Setup exports the spans with OTLP over gRPC as configured by the options.
+// Returns the function flushing the spans on shutdown.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	if opts.SampleRatio < 0 || opts.SampleRatio > 1 {
+		return nil, fmt.Errorf("trace sample ratio %v not between 0 and 1", opts.SampleRatio)
+	}
+	clientOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		clientOpts = append(clientOpts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create OTLP trace exporter: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// SetupInMemory records all the spans in memory. It's meant for tests.
+func SetupInMemory() *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	return exporter
+}
+
+// Tracer returns the tracer of the issuer's spans.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start the span of a reconcile of the object.
+func StartReconcile(ctx context.Context, controller string, key types.NamespacedName, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	opts = append(opts, trace.WithAttributes(
+		attribute.String("k8s.namespace.name", key.Namespace),
+		attribute.String("k8s.object.name", key.Name),
+	))
+	return Tracer().Start(ctx, controller+".Reconcile", opts...)
+}
+
+// End the span recording the error if any.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Traceparent returns the W3C traceparent of the span in ctx or an empty string
+// if there's no sampled span.
+func Traceparent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get(traceparentHeader)
+}
+
+// SpanContextFromTraceparent parses the W3C traceparent. The span context is invalid
+// if the traceparent is empty or malformed.
+func SpanContextFromTraceparent(traceparent string) trace.SpanContext {
+	carrier := propagation.MapCarrier{traceparentHeader: traceparent}
+	return trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+}
+
+// LinkTo returns the option linking the span to the one with the traceparent, if valid.
+func LinkTo(traceparent string) trace.SpanStartOption {
+	sc := SpanContextFromTraceparent(traceparent)
+	if !sc.IsValid() {
+		return trace.WithLinks()
+	}
+	return trace.WithLinks(trace.Link{SpanContext: sc})
+}
@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestTraceparentLinksReconciles(t *testing.T) {
+	exporter := SetupInMemory()
+
+	ctx, submission := StartReconcile(context.Background(), "CertificateRequestReconciler", types.NamespacedName{Namespace: "default", Name: "test"})
+	traceparent := Traceparent(ctx)
+	End(submission, nil)
+	require.NotEmpty(t, traceparent)
+	assert.Equal(t, submission.SpanContext().TraceID(), SpanContextFromTraceparent(traceparent).TraceID())
+
+	// A later reconcile starts its own trace linked to the submission.
+	_, poll := StartReconcile(context.Background(), "AdcsRequestReconciler", types.NamespacedName{Namespace: "default", Name: "test"}, LinkTo(traceparent))
+	End(poll, errors.New("ADCS unavailable"))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "AdcsRequestReconciler.Reconcile", spans[1].Name)
+	assert.NotEqual(t, spans[0].SpanContext.TraceID(), spans[1].SpanContext.TraceID())
+	require.Len(t, spans[1].Links, 1)
+	assert.Equal(t, spans[0].SpanContext.SpanID(), spans[1].Links[0].SpanContext.SpanID())
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+}
+
+func TestTraceparentWithoutSpan(t *testing.T) {
+	assert.Empty(t, Traceparent(context.Background()))
+	assert.False(t, SpanContextFromTraceparent("").IsValid())
+	assert.False(t, SpanContextFromTraceparent("not a traceparent").IsValid())
+}
+
+func TestSetupWithoutEndpoint(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Options{})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = Setup(context.Background(), Options{Endpoint: "localhost:4317", SampleRatio: 2})
+	assert.Error(t, err)
+}